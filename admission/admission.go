@@ -0,0 +1,154 @@
+// Package admission keeps searches from swamping the host they run on. A
+// Controller runs a limited number of searches at once and queues a bounded
+// number more, turning the rest away so that clients back off; a Budget
+// stops a single search once it has read or computed too much
+package admission
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ErrBusy is returned by Admit when every search slot is taken and the wait
+// queue is full
+var ErrBusy = errors.New("too many searches in progress")
+
+// Bounds on the wait Load suggests to rejected clients
+const (
+	minRetryAfter = 100 * time.Millisecond
+	maxRetryAfter = 30 * time.Second
+)
+
+// heldWeight is the weight of the latest search in the running average of
+// how long searches hold a slot, which starts out at initialHeld
+const (
+	heldWeight  = 0.2
+	initialHeld = time.Second
+)
+
+// Controller admits searches up to a concurrency limit, queueing a bounded
+// number of others until a slot frees up. Freed slots go to the queued
+// searches in the order they arrived; a new search only takes a free slot
+// when none are waiting
+type Controller struct {
+	maxActive int
+	maxQueued int
+
+	mu       sync.Mutex
+	active   int
+	waiting  []chan struct{} // closed to hand the waiting search a slot
+	admitted int64
+	rejected int64
+	held     time.Duration // running average of how long searches hold a slot
+}
+
+// Load is a snapshot of a Controller's activity
+type Load struct {
+	Active    int // searches running
+	MaxActive int
+	Queued    int // searches waiting for a slot
+	MaxQueued int
+	Admitted  int64 // searches admitted since the start
+	Rejected  int64 // searches turned away since the start
+
+	// RetryAfter estimates how long a search turned away now should wait
+	// before trying again
+	RetryAfter time.Duration
+}
+
+// New creates a controller running at most maxActive searches at once, with
+// at most maxQueued more waiting
+func New(maxActive, maxQueued int) *Controller {
+	return &Controller{
+		maxActive: max(maxActive, 1),
+		maxQueued: max(maxQueued, 0),
+		held:      initialHeld,
+	}
+}
+
+// Admit waits for a search slot and returns a function that gives it back.
+// It fails at once with ErrBusy when the queue is full, or with the
+// context's error if ctx ends while waiting
+func (c *Controller) Admit(ctx context.Context) (func(), error) {
+	c.mu.Lock()
+	if c.active < c.maxActive && len(c.waiting) == 0 {
+		c.active++
+		c.admitted++
+		c.mu.Unlock()
+		return c.releaser(), nil
+	}
+	if len(c.waiting) >= c.maxQueued {
+		c.rejected++
+		c.mu.Unlock()
+		return nil, ErrBusy
+	}
+	slot := make(chan struct{})
+	c.waiting = append(c.waiting, slot)
+	c.mu.Unlock()
+
+	select {
+	case <-slot:
+		return c.releaser(), nil
+	case <-ctx.Done():
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if i := slices.Index(c.waiting, slot); i >= 0 {
+		c.waiting = slices.Delete(c.waiting, i, i+1)
+	} else {
+		// The slot was handed over as ctx ended; pass it on
+		c.admitted--
+		c.free()
+	}
+	return nil, ctx.Err()
+}
+
+// releaser returns the function giving back the slot of a search just
+// admitted, which hands it to the longest waiting search, if any
+func (c *Controller) releaser() func() {
+	start := time.Now()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			held := time.Since(start)
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.held += time.Duration(heldWeight * float64(held-c.held))
+			c.free()
+		})
+	}
+}
+
+// free hands a slot given back to the longest waiting search, or leaves it
+// free when none is waiting. c.mu must be held
+func (c *Controller) free() {
+	if len(c.waiting) > 0 {
+		close(c.waiting[0])
+		c.waiting = c.waiting[1:]
+		c.admitted++
+		return
+	}
+	c.active--
+}
+
+// Load reports the controller's current activity
+func (c *Controller) Load() Load {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	load := Load{
+		Active:    c.active,
+		MaxActive: c.maxActive,
+		Queued:    len(c.waiting),
+		MaxQueued: c.maxQueued,
+		Admitted:  c.admitted,
+		Rejected:  c.rejected,
+	}
+	// Everything queued has to go first, a slot's worth at a time
+	wait := c.held * time.Duration(len(c.waiting)+1) / time.Duration(c.maxActive)
+	load.RetryAfter = min(max(wait, minRetryAfter), maxRetryAfter)
+	return load
+}
@@ -0,0 +1,79 @@
+package admission
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"time"
+)
+
+// ErrBudgetExceeded is returned, wrapped with the limit that was hit, once a
+// search has used up its budget
+var ErrBudgetExceeded = errors.New("query budget exceeded")
+
+// Budget bounds the resources a single search may use
+type Budget struct {
+	MaxBytes int64         // bytes of log a search may read, 0 for no limit
+	MaxCPU   time.Duration // CPU time a search may use, 0 for no limit
+}
+
+// Meter tracks the resources one search has used against its budget
+type Meter struct {
+	budget Budget
+	bytes  int64
+	start  time.Duration // CPU clock when metering started
+	locked bool
+}
+
+// Start begins metering a search run by the calling goroutine. To measure
+// CPU time, the goroutine is kept on its current OS thread until Stop, so
+// that the thread's CPU time is the search's alone
+func (b Budget) Start() *Meter {
+	m := &Meter{budget: b}
+	if b.MaxCPU > 0 {
+		runtime.LockOSThread()
+		m.locked = true
+		m.start = cpuClock()
+	}
+	return m
+}
+
+// Stop ends metering. It must be called on the goroutine that called Start
+func (m *Meter) Stop() {
+	if m.locked {
+		runtime.UnlockOSThread()
+		m.locked = false
+	}
+}
+
+// Charge records n bytes read and reports whether the budget is spent
+func (m *Meter) Charge(n int) error {
+	m.bytes += int64(n)
+	if limit := m.budget.MaxBytes; limit > 0 && m.bytes > limit {
+		return fmt.Errorf("%w: read more than %d bytes", ErrBudgetExceeded, limit)
+	}
+	if limit := m.budget.MaxCPU; m.locked && cpuClock()-m.start > limit {
+		return fmt.Errorf("%w: used more than %v of CPU time", ErrBudgetExceeded, limit)
+	}
+	return nil
+}
+
+// Reader returns a reader that charges everything read from r to the meter,
+// failing once the budget is spent
+func (m *Meter) Reader(r io.Reader) io.Reader {
+	return &meteredReader{r: r, m: m}
+}
+
+type meteredReader struct {
+	r io.Reader
+	m *Meter
+}
+
+func (r *meteredReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if chargeErr := r.m.Charge(n); chargeErr != nil {
+		return n, chargeErr
+	}
+	return n, err
+}
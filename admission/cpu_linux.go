@@ -0,0 +1,17 @@
+//go:build linux
+
+package admission
+
+import (
+	"syscall"
+	"time"
+)
+
+// cpuClock returns the CPU time used so far by the calling OS thread
+func cpuClock() time.Duration {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_THREAD, &usage); err != nil {
+		return 0
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
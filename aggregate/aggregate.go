@@ -0,0 +1,152 @@
+// Package aggregate counts search matches by group: the values of chosen
+// fields of each line and, optionally, the time bucket it was logged in. It
+// also finds the most frequent messages once their variable parts are
+// masked out. Each server counts its own matches; the client merges the
+// partial counts of every machine into one table
+package aggregate
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Fields every server can group by
+const (
+	// FieldLevel is the parsed severity level of the line
+	FieldLevel = "level"
+	// FieldFile is the log file the line was found in
+	FieldFile = "file"
+)
+
+// builtinFields lists the fields known without further configuration
+var builtinFields = []string{FieldFile, FieldLevel}
+
+// Spec says how matches are grouped
+type Spec struct {
+	Fields    []string      // names of the fields to group by, in column order
+	Extracted []string      // fields the query extracts from each line, which may be grouped by too
+	Bucket    time.Duration // width of the time buckets, or 0 for no time grouping
+}
+
+// Validate checks that every field is known and the bucket is usable
+func (s Spec) Validate() error {
+	for _, field := range s.Extracted {
+		if slices.Contains(builtinFields, field) {
+			return fmt.Errorf("extracted field %q has the name of a built-in field", field)
+		}
+	}
+	known := append(append([]string(nil), builtinFields...), s.Extracted...)
+
+	seen := map[string]bool{}
+	for _, field := range s.Fields {
+		if !slices.Contains(known, field) {
+			return fmt.Errorf("unknown group-by field %q (known fields: %s)", field, strings.Join(known, ", "))
+		}
+		if seen[field] {
+			return fmt.Errorf("group-by field %q is repeated", field)
+		}
+		seen[field] = true
+	}
+	if s.Bucket < 0 {
+		return fmt.Errorf("bucket width %v is negative", s.Bucket)
+	}
+	if len(s.Fields) == 0 && s.Bucket == 0 {
+		return fmt.Errorf("nothing to group by: give fields, a bucket width or both")
+	}
+	return nil
+}
+
+// Row is the count of one group
+type Row struct {
+	Values []string  // value of each field, in Spec order; empty when a line has none
+	Bucket time.Time // start of the time bucket; zero without buckets or for lines without a timestamp
+	Count  int64
+}
+
+// groupKey identifies a group within a map
+type groupKey struct {
+	values string // field values joined by NUL
+	bucket int64  // bucket start in Unix nanoseconds, 0 when there is none
+}
+
+func keyOf(values []string, bucket time.Time) groupKey {
+	key := groupKey{values: strings.Join(values, "\x00")}
+	if !bucket.IsZero() {
+		key.bucket = bucket.UnixNano()
+	}
+	return key
+}
+
+// Counts accumulates the matches on one server
+type Counts struct {
+	spec   Spec
+	groups map[groupKey]*Row
+	total  int64
+}
+
+// NewCounts creates empty counts grouped according to spec
+func NewCounts(spec Spec) *Counts {
+	return &Counts{spec: spec, groups: map[groupKey]*Row{}}
+}
+
+// Add counts a match with the given field values, logged at t. A zero t
+// means the line has no timestamp
+func (c *Counts) Add(values []string, t time.Time) {
+	var bucket time.Time
+	if c.spec.Bucket > 0 && !t.IsZero() {
+		bucket = t.Truncate(c.spec.Bucket)
+	}
+	key := keyOf(values, bucket)
+	row, ok := c.groups[key]
+	if !ok {
+		row = &Row{Values: append([]string(nil), values...), Bucket: bucket}
+		c.groups[key] = row
+	}
+	row.Count++
+	c.total++
+}
+
+// Total returns the number of matches counted
+func (c *Counts) Total() int64 {
+	return c.total
+}
+
+// Top returns the n largest groups, or all of them if n is 0, in the order
+// of Sort, along with the number of matches in the groups left out
+func (c *Counts) Top(n int) ([]Row, int64) {
+	rows := make([]Row, 0, len(c.groups))
+	for _, row := range c.groups {
+		rows = append(rows, *row)
+	}
+	var other int64
+	if n > 0 && len(rows) > n {
+		sort.Slice(rows, func(i, j int) bool { return byCount(rows[i], rows[j]) })
+		for _, row := range rows[n:] {
+			other += row.Count
+		}
+		rows = rows[:n]
+	}
+	Sort(rows)
+	return rows, other
+}
+
+// Sort orders rows chronologically by bucket, then largest first, then by
+// their values
+func Sort(rows []Row) {
+	sort.Slice(rows, func(i, j int) bool {
+		if !rows[i].Bucket.Equal(rows[j].Bucket) {
+			return rows[i].Bucket.Before(rows[j].Bucket)
+		}
+		return byCount(rows[i], rows[j])
+	})
+}
+
+func byCount(a, b Row) bool {
+	if a.Count != b.Count {
+		return a.Count > b.Count
+	}
+	return strings.Join(a.Values, "\x00") < strings.Join(b.Values, "\x00")
+}
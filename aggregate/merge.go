@@ -0,0 +1,64 @@
+package aggregate
+
+// MergedRow is a group's count across machines
+type MergedRow struct {
+	Row
+	ByMachine map[string]int64 // each machine's share of Count
+}
+
+// Merged combines the groups reported by several machines
+type Merged struct {
+	machines []string
+	groups   map[groupKey]*MergedRow
+	other    map[string]int64
+}
+
+// NewMerged creates an empty merge
+func NewMerged() *Merged {
+	return &Merged{groups: map[groupKey]*MergedRow{}, other: map[string]int64{}}
+}
+
+// Add merges the rows reported by machine, along with the count of matches
+// it left out of them
+func (m *Merged) Add(machine string, rows []Row, other int64) {
+	m.machines = append(m.machines, machine)
+	for _, row := range rows {
+		key := keyOf(row.Values, row.Bucket)
+		merged, ok := m.groups[key]
+		if !ok {
+			merged = &MergedRow{Row: Row{Values: row.Values, Bucket: row.Bucket}, ByMachine: map[string]int64{}}
+			m.groups[key] = merged
+		}
+		merged.Count += row.Count
+		merged.ByMachine[machine] += row.Count
+	}
+	if other > 0 {
+		m.other[machine] += other
+	}
+}
+
+// Machines returns the machines merged, in the order they were added
+func (m *Merged) Machines() []string {
+	return append([]string(nil), m.machines...)
+}
+
+// Rows returns the merged groups in the order of Sort
+func (m *Merged) Rows() []MergedRow {
+	rows := make([]Row, 0, len(m.groups))
+	for _, merged := range m.groups {
+		rows = append(rows, merged.Row)
+	}
+	Sort(rows)
+
+	result := make([]MergedRow, len(rows))
+	for i, row := range rows {
+		result[i] = *m.groups[keyOf(row.Values, row.Bucket)]
+	}
+	return result
+}
+
+// Other returns the matches each machine left out of its rows, because it
+// had more groups than it was allowed to return
+func (m *Merged) Other() map[string]int64 {
+	return m.other
+}
@@ -0,0 +1,51 @@
+package aggregate
+
+import (
+	"regexp"
+	"strings"
+)
+
+// variablePart matches the parts of a message that vary between otherwise
+// identical messages: timestamps, UUIDs, IP addresses, hexadecimal IDs and
+// numbers. Alternatives are tried in order, so the longer forms win
+var variablePart = regexp.MustCompile(
+	`\d{4}-\d{2}-\d{2}(?:[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2})?)?` +
+		`|\d{2}:\d{2}:\d{2}(?:[.,]\d+)?` +
+		`|\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b` +
+		`|\b\d{1,3}(?:\.\d{1,3}){3}(?::\d+)?\b` +
+		`|\b0[xX][0-9a-fA-F]+\b` +
+		`|\b[0-9a-fA-F]*(?:[0-9][0-9a-fA-F]*[a-fA-F]|[a-fA-F][0-9a-fA-F]*[0-9])[0-9a-fA-F]*\b` +
+		`|\d+(?:\.\d+)?`)
+
+// minIDLength is the shortest run of hex digits and letters taken for an ID
+const minIDLength = 6
+
+var digits = regexp.MustCompile(`\d+`)
+
+// Normalize reduces a log message to its template by replacing the parts
+// that vary between occurrences of the same event with placeholders, so
+// "Request 4711 from 10.0.0.7 took 35ms" becomes
+// "Request <n> from <ip> took <n>ms"
+func Normalize(message string) string {
+	normalized := variablePart.ReplaceAllStringFunc(message, func(part string) string {
+		switch {
+		case len(part) == 36 && strings.Count(part, "-") == 4:
+			return "<uuid>"
+		case strings.Count(part, ".") == 3 && !strings.Contains(part, "-"):
+			return "<ip>"
+		case strings.ContainsAny(part, ":-"):
+			return "<ts>"
+		case strings.HasPrefix(part, "0x") || strings.HasPrefix(part, "0X"):
+			return "<id>"
+		case strings.ContainsAny(part, "abcdefABCDEF"):
+			// Short mixes such as "e2e" are more likely words than IDs
+			if len(part) >= minIDLength {
+				return "<id>"
+			}
+			return digits.ReplaceAllString(part, "<n>")
+		default:
+			return "<n>"
+		}
+	})
+	return strings.Join(strings.Fields(normalized), " ")
+}
@@ -0,0 +1,202 @@
+package aggregate
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// Candidate is a key reported by a Sketch with its estimated count. The
+// true count lies between Count-Error and Count
+type Candidate struct {
+	Key     string
+	Count   int64
+	Error   int64
+	Example string // one of the values the key was derived from
+}
+
+// Sketch finds the most frequent keys of a stream in bounded memory, using
+// the Space-Saving algorithm: it keeps a fixed number of counters, and a new
+// key takes over the smallest one, inheriting its count as possible error.
+// Any key occurring more than n/capacity times in a stream of n keys is
+// guaranteed to be tracked
+type Sketch struct {
+	capacity int
+	entries  map[string]*Candidate
+	heap     sketchHeap
+}
+
+// NewSketch creates a sketch with capacity counters
+func NewSketch(capacity int) *Sketch {
+	return &Sketch{capacity: max(capacity, 1), entries: map[string]*Candidate{}}
+}
+
+// Add counts one occurrence of key. example is kept for display when key
+// is first tracked
+func (s *Sketch) Add(key, example string) {
+	if entry, ok := s.entries[key]; ok {
+		entry.Count++
+		heap.Fix(&s.heap, s.heap.index(entry))
+		return
+	}
+	if len(s.entries) < s.capacity {
+		entry := &Candidate{Key: key, Count: 1, Example: example}
+		s.entries[key] = entry
+		heap.Push(&s.heap, entry)
+		return
+	}
+
+	// Replace the least frequent key; the newcomer may have occurred up to
+	// that many times unseen
+	smallest := s.heap.entries[0]
+	delete(s.entries, smallest.Key)
+	*smallest = Candidate{Key: key, Count: smallest.Count + 1, Error: smallest.Count, Example: example}
+	s.entries[key] = smallest
+	heap.Fix(&s.heap, 0)
+}
+
+// Top returns the n keys with the highest counts, most frequent first, and
+// an upper bound on the count of any key not among them
+func (s *Sketch) Top(n int) ([]Candidate, int64) {
+	all := make([]Candidate, 0, len(s.entries))
+	for _, entry := range s.entries {
+		all = append(all, *entry)
+	}
+	sortCandidates(all)
+
+	var threshold int64
+	if len(s.entries) == s.capacity {
+		// Untracked keys occurred at most as often as the smallest counter
+		threshold = s.heap.entries[0].Count
+	}
+	if len(all) > n {
+		threshold = max(threshold, all[n].Count)
+		all = all[:n]
+	}
+	return all, threshold
+}
+
+func sortCandidates(candidates []Candidate) {
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Count != candidates[j].Count {
+			return candidates[i].Count > candidates[j].Count
+		}
+		return candidates[i].Key < candidates[j].Key
+	})
+}
+
+// sketchHeap is a min-heap of counters by count
+type sketchHeap struct {
+	entries   []*Candidate
+	positions map[*Candidate]int
+}
+
+func (h *sketchHeap) index(entry *Candidate) int {
+	return h.positions[entry]
+}
+
+func (h sketchHeap) Len() int           { return len(h.entries) }
+func (h sketchHeap) Less(i, j int) bool { return h.entries[i].Count < h.entries[j].Count }
+
+func (h sketchHeap) Swap(i, j int) {
+	h.entries[i], h.entries[j] = h.entries[j], h.entries[i]
+	h.positions[h.entries[i]] = i
+	h.positions[h.entries[j]] = j
+}
+
+func (h *sketchHeap) Push(x any) {
+	if h.positions == nil {
+		h.positions = map[*Candidate]int{}
+	}
+	entry := x.(*Candidate)
+	h.positions[entry] = len(h.entries)
+	h.entries = append(h.entries, entry)
+}
+
+func (h *sketchHeap) Pop() any {
+	last := h.entries[len(h.entries)-1]
+	h.entries = h.entries[:len(h.entries)-1]
+	delete(h.positions, last)
+	return last
+}
+
+// MergedCandidate is a key's estimated count across machines. The true
+// total lies between Lower and Upper
+type MergedCandidate struct {
+	Key       string
+	Count     int64            // sum of the counts the machines reported
+	Lower     int64            // sum of the machines' lower bounds
+	Upper     int64            // Count plus the most the other machines can have missed
+	ByMachine map[string]int64 // count reported by each machine that listed the key
+	Example   string
+}
+
+// TopMerge combines the candidates of several machines into a global top
+// list. A machine that did not list a key may still have seen it up to its
+// threshold times, which widens the key's bounds
+type TopMerge struct {
+	machines   []string
+	thresholds map[string]int64
+	keys       map[string]*MergedCandidate
+}
+
+// NewTopMerge creates an empty merge
+func NewTopMerge() *TopMerge {
+	return &TopMerge{thresholds: map[string]int64{}, keys: map[string]*MergedCandidate{}}
+}
+
+// Add merges the candidates of machine, which bounds the count of every
+// key it did not list by threshold
+func (m *TopMerge) Add(machine string, candidates []Candidate, threshold int64) {
+	m.machines = append(m.machines, machine)
+	m.thresholds[machine] = threshold
+	for _, candidate := range candidates {
+		merged, ok := m.keys[candidate.Key]
+		if !ok {
+			merged = &MergedCandidate{Key: candidate.Key, ByMachine: map[string]int64{}, Example: candidate.Example}
+			m.keys[candidate.Key] = merged
+		}
+		merged.Count += candidate.Count
+		merged.Lower += candidate.Count - candidate.Error
+		merged.ByMachine[machine] += candidate.Count
+	}
+}
+
+// Machines returns the machines merged, in the order they were added
+func (m *TopMerge) Machines() []string {
+	return append([]string(nil), m.machines...)
+}
+
+// Threshold returns the most times machine may have seen a key it did not
+// list
+func (m *TopMerge) Threshold(machine string) int64 {
+	return m.thresholds[machine]
+}
+
+// Top returns the n keys with the highest merged counts, most frequent
+// first
+func (m *TopMerge) Top(n int) []MergedCandidate {
+	merged := make([]MergedCandidate, 0, len(m.keys))
+	for _, candidate := range m.keys {
+		c := *candidate
+		c.Upper = c.Count
+		for _, machine := range m.machines {
+			if _, listed := c.ByMachine[machine]; !listed {
+				c.Upper += m.thresholds[machine]
+			}
+		}
+		merged = append(merged, c)
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		if merged[i].Count != merged[j].Count {
+			return merged[i].Count > merged[j].Count
+		}
+		if merged[i].Upper != merged[j].Upper {
+			return merged[i].Upper > merged[j].Upper
+		}
+		return merged[i].Key < merged[j].Key
+	})
+	if n > 0 && len(merged) > n {
+		merged = merged[:n]
+	}
+	return merged
+}
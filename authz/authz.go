@@ -0,0 +1,246 @@
+// Package authz authenticates callers, by bearer token or by the
+// certificate they presented over mutual TLS, and decides what each may do
+// according to a local policy file. The policy maps every identity to the
+// log files it may read and the query features it may not use
+package authz
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// Feature is a query capability that the policy can withhold
+type Feature string
+
+// Features the policy can deny
+const (
+	Invert    Feature = "invert"    // select the lines that do not match (grep -v)
+	Context   Feature = "context"   // return lines around each match (grep -A, -B, -C)
+	Records   Feature = "records"   // return matches parsed into records
+	Rotated   Feature = "rotated"   // search rotated copies of the logs
+	Extract   Feature = "extract"   // extract fields from matches
+	Follow    Feature = "follow"    // stream lines as they are logged
+	Aggregate Feature = "aggregate" // count matches by group
+	Top       Feature = "top"       // rank the most frequent messages
+)
+
+// features lists every known feature
+var features = []Feature{Invert, Context, Records, Rotated, Extract, Follow, Aggregate, Top}
+
+// ErrUnauthenticated is returned for callers with no or unknown credentials
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// Identity is a caller known to the policy and what it may do
+type Identity struct {
+	Name         string    `json:"name"`
+	TokenSHA256  []string  `json:"token_sha256"` // hex SHA-256 digests of the bearer tokens that authenticate it
+	Certificates []string  `json:"certificates"` // common names or DNS names of client certificates that authenticate it
+	Files        []string  `json:"files"`        // globs of the log files it may read, matched like file filters
+	Deny         []Feature `json:"deny"`         // features it may not use
+}
+
+// CanRead reports whether the identity may read the log at path, or any
+// rotated copy of it. A nil identity, used when there is no policy, may
+// read everything
+func (id *Identity) CanRead(path string) bool {
+	if id == nil {
+		return true
+	}
+	for _, pattern := range id.Files {
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, filepath.Base(path)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns an error naming the first of wanted that the identity may
+// not use. A nil identity may use everything
+func (id *Identity) Check(wanted []Feature) error {
+	if id == nil {
+		return nil
+	}
+	for _, feature := range wanted {
+		if slices.Contains(id.Deny, feature) {
+			return fmt.Errorf("%s may not use %s", id.Name, feature)
+		}
+	}
+	return nil
+}
+
+// Policy is a parsed policy file
+type Policy struct {
+	Identities []*Identity `json:"identities"`
+
+	tokens       map[string]*Identity // by token digest
+	certificates map[string]*Identity // by certificate name
+}
+
+// LoadPolicy reads and validates the JSON policy file at path
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	policy := &Policy{}
+	if err := decoder.Decode(policy); err != nil {
+		return nil, fmt.Errorf("parsing policy %s: %v", path, err)
+	}
+	if err := policy.index(); err != nil {
+		return nil, fmt.Errorf("policy %s: %v", path, err)
+	}
+	return policy, nil
+}
+
+// index validates the identities and indexes them by credential
+func (p *Policy) index() error {
+	p.tokens = map[string]*Identity{}
+	p.certificates = map[string]*Identity{}
+	names := map[string]bool{}
+	for _, id := range p.Identities {
+		switch {
+		case id.Name == "":
+			return errors.New("an identity has no name")
+		case names[id.Name]:
+			return fmt.Errorf("identity %q is defined more than once", id.Name)
+		case len(id.TokenSHA256) == 0 && len(id.Certificates) == 0:
+			return fmt.Errorf("identity %q has neither tokens nor certificates", id.Name)
+		}
+		names[id.Name] = true
+
+		for _, digest := range id.TokenSHA256 {
+			digest = strings.ToLower(digest)
+			if decoded, err := hex.DecodeString(digest); err != nil || len(decoded) != sha256.Size {
+				return fmt.Errorf("identity %q: %q is not a hex SHA-256 digest", id.Name, digest)
+			}
+			if other, ok := p.tokens[digest]; ok {
+				return fmt.Errorf("identities %q and %q share a token", other.Name, id.Name)
+			}
+			p.tokens[digest] = id
+		}
+		for _, name := range id.Certificates {
+			if other, ok := p.certificates[name]; ok {
+				return fmt.Errorf("identities %q and %q share certificate name %q", other.Name, id.Name, name)
+			}
+			p.certificates[name] = id
+		}
+		for _, pattern := range id.Files {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return fmt.Errorf("identity %q: invalid file glob %q: %v", id.Name, pattern, err)
+			}
+		}
+		for _, feature := range id.Deny {
+			if !slices.Contains(features, feature) {
+				return fmt.Errorf("identity %q: unknown feature %q (known features: %s)", id.Name, feature, featureList())
+			}
+		}
+	}
+	return nil
+}
+
+func featureList() string {
+	names := make([]string, len(features))
+	for i, feature := range features {
+		names[i] = string(feature)
+	}
+	return strings.Join(names, ", ")
+}
+
+// Authenticate identifies the caller of ctx by the bearer token in its
+// authorization metadata or, failing that, by the verified client
+// certificate of its TLS connection
+func (p *Policy) Authenticate(ctx context.Context) (*Identity, error) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, value := range md.Get("authorization") {
+			scheme, token, ok := strings.Cut(value, " ")
+			if !ok || !strings.EqualFold(scheme, "Bearer") {
+				continue
+			}
+			digest := sha256.Sum256([]byte(strings.TrimSpace(token)))
+			if id, ok := p.tokens[hex.EncodeToString(digest[:])]; ok {
+				return id, nil
+			}
+			return nil, fmt.Errorf("%w: unknown bearer token", ErrUnauthenticated)
+		}
+	}
+
+	if caller, ok := peer.FromContext(ctx); ok {
+		if info, ok := caller.AuthInfo.(credentials.TLSInfo); ok && len(info.State.VerifiedChains) > 0 {
+			cert := info.State.VerifiedChains[0][0]
+			for _, name := range append([]string{cert.Subject.CommonName}, cert.DNSNames...) {
+				if id, ok := p.certificates[name]; ok {
+					return id, nil
+				}
+			}
+			return nil, fmt.Errorf("%w: client certificate %q is not in the policy", ErrUnauthenticated, cert.Subject.CommonName)
+		}
+	}
+	return nil, fmt.Errorf("%w: no bearer token or client certificate", ErrUnauthenticated)
+}
+
+// Authorizer holds the current policy, which can be reloaded from its
+// file while the server runs
+type Authorizer struct {
+	path    string
+	current atomic.Pointer[Policy]
+}
+
+// NewAuthorizer loads the policy file at path
+func NewAuthorizer(path string) (*Authorizer, error) {
+	policy, err := LoadPolicy(path)
+	if err != nil {
+		return nil, err
+	}
+	a := &Authorizer{path: path}
+	a.current.Store(policy)
+	return a, nil
+}
+
+// Reload reads the policy file again. On failure the policy loaded before
+// remains in force
+func (a *Authorizer) Reload() error {
+	policy, err := LoadPolicy(a.path)
+	if err != nil {
+		return err
+	}
+	a.current.Store(policy)
+	return nil
+}
+
+// Policy returns the policy in force
+func (a *Authorizer) Policy() *Policy {
+	return a.current.Load()
+}
+
+type identityKey struct{}
+
+// NewContext returns a copy of ctx carrying the authenticated identity
+func NewContext(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns the identity carried by ctx, or nil when the server
+// has no policy
+func FromContext(ctx context.Context) *Identity {
+	id, _ := ctx.Value(identityKey{}).(*Identity)
+	return id
+}
@@ -0,0 +1,85 @@
+// Package cache provides a least-recently-used cache bounded by the total
+// size of its values
+package cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// LRU maps keys to values, evicting the least recently used values once
+// their total size exceeds the capacity. It is safe for concurrent use
+type LRU[K comparable, V any] struct {
+	mu        sync.Mutex
+	capacity  int64
+	size      int64
+	order     *list.List // most recently used first
+	items     map[K]*list.Element
+	evictions int64
+}
+
+type item[K comparable, V any] struct {
+	key   K
+	value V
+	size  int64
+}
+
+// Stats describes the contents of a cache
+type Stats struct {
+	Entries   int
+	Size      int64 // total size of the values
+	Evictions int64 // values evicted to make room since the cache was created
+}
+
+// New creates an empty cache holding values of up to capacity in total
+func New[K comparable, V any](capacity int64) *LRU[K, V] {
+	return &LRU[K, V]{capacity: capacity, order: list.New(), items: map[K]*list.Element{}}
+}
+
+// Get returns the value stored under key and marks it as recently used
+func (c *LRU[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.items[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*item[K, V]).value, true
+}
+
+// Put stores value under key, replacing any value already there. A value
+// larger than an eighth of the capacity is not stored, so that a single
+// large value cannot flush the rest of the cache
+func (c *LRU[K, V]) Put(key K, value V, size int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.items[key]; ok {
+		c.remove(elem)
+	}
+	if size > c.capacity/8 {
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&item[K, V]{key: key, value: value, size: size})
+	c.size += size
+	for c.size > c.capacity {
+		c.remove(c.order.Back())
+		c.evictions++
+	}
+}
+
+// Stats reports the contents of the cache
+func (c *LRU[K, V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Stats{Entries: len(c.items), Size: c.size, Evictions: c.evictions}
+}
+
+// remove drops elem; c.mu must be held
+func (c *LRU[K, V]) remove(elem *list.Element) {
+	it := c.order.Remove(elem).(*item[K, V])
+	delete(c.items, it.key)
+	c.size -= it.size
+}
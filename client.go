@@ -1,24 +1,46 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"os"
+	"os/signal"
 	"sort"
 	"strings"
 	"sync"
+	"syscall"
+	"text/tabwriter"
 	"time"
 
+	"github.com/sujayx23/g71_test/aggregate"
+	"github.com/sujayx23/g71_test/grepopts"
+	"github.com/sujayx23/g71_test/logparse"
 	pb "github.com/sujayx23/g71_test/logquery"
+	"github.com/sujayx23/g71_test/query"
+	"github.com/sujayx23/g71_test/search"
+	"github.com/sujayx23/g71_test/tlsconfig"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 // ServerConfig represents a server configuration
 type ServerConfig struct {
 	MachineID string
 	Address   string
+	PageToken string // continues a paginated query where this server's last page stopped
 }
 
 // QueryResult represents the result from a single server
@@ -32,18 +54,119 @@ type QueryResult struct {
 type LogQueryClient struct {
 	servers []ServerConfig
 	timeout time.Duration
+	// checkHealth skips servers whose health check reports NOT_SERVING,
+	// or that do not answer it, before searching them
+	checkHealth bool
+	// creds secures connections to the servers; plaintext by default
+	creds credentials.TransportCredentials
+	// token authenticates every call to servers with an auth policy
+	token string
 }
 
 // NewLogQueryClient creates a new client instance
 func NewLogQueryClient(servers []ServerConfig, timeout time.Duration) *LogQueryClient {
 	return &LogQueryClient{
-		servers: servers,
-		timeout: timeout,
+		servers:     servers,
+		timeout:     timeout,
+		checkHealth: true,
+		creds:       insecure.NewCredentials(),
 	}
 }
 
-// QueryAllServers queries all configured servers concurrently
-func (c *LogQueryClient) QueryAllServers(pattern, options string) []QueryResult {
+// retryPolicy retries searches that a busy server turns away with
+// RESOURCE_EXHAUSTED, backing off exponentially or for as long as the
+// server's retry pushback asks. Searches stopped by their budget come with
+// a pushback that rules out retrying
+const retryPolicy = `{"methodConfig": [{
+	"name": [{"service": "logquery.LogQuery"}],
+	"retryPolicy": {
+		"maxAttempts": 4,
+		"initialBackoff": "0.5s",
+		"maxBackoff": "5s",
+		"backoffMultiplier": 2,
+		"retryableStatusCodes": ["RESOURCE_EXHAUSTED"]
+	}
+}]}`
+
+// dial connects to a server
+func (c *LogQueryClient) dial(address string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	opts = append([]grpc.DialOption{
+		grpc.WithTransportCredentials(c.creds),
+		grpc.WithDefaultServiceConfig(retryPolicy),
+	}, opts...)
+	if c.token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(bearerToken(c.token)))
+	}
+	return grpc.Dial(address, opts...)
+}
+
+// bearerToken sends a token in the authorization metadata of every call
+type bearerToken string
+
+func (t bearerToken) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+// RequireTransportSecurity keeps the token off plaintext connections,
+// where anyone watching could replay it
+func (bearerToken) RequireTransportSecurity() bool {
+	return true
+}
+
+// tokenEnv names the environment variable holding the bearer token when
+// no token file is given
+const tokenEnv = "LOGQUERY_TOKEN"
+
+// readToken returns the bearer token from file, or from the environment
+// when file is empty
+func readToken(file string) (string, error) {
+	if file == "" {
+		return strings.TrimSpace(os.Getenv(tokenEnv)), nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("%s is empty", file)
+	}
+	return token, nil
+}
+
+// healthCheckTimeout bounds the health check made before searching a
+// server, so an unresponsive one is skipped rather than waited on
+const healthCheckTimeout = 2 * time.Second
+
+// connect connects to a server in order to search it. Unless health
+// checks are disabled, a server that reports NOT_SERVING, typically because
+// it cannot read its logs, or that does not answer is skipped with an error.
+// Servers without the health service are searched anyway
+func (c *LogQueryClient) connect(server ServerConfig, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	conn, err := c.dial(server.Address, opts...)
+	if err != nil || !c.checkHealth {
+		return conn, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), min(c.timeout, healthCheckTimeout))
+	defer cancel()
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: pb.LogQuery_ServiceDesc.ServiceName})
+	switch {
+	case status.Code(err) == codes.Unimplemented:
+		return conn, nil
+	case err != nil:
+		conn.Close()
+		return nil, fmt.Errorf("health check failed: %v", status.Convert(err).Message())
+	case resp.Status != healthpb.HealthCheckResponse_SERVING:
+		conn.Close()
+		return nil, fmt.Errorf("server reports %v, skipped", resp.Status)
+	}
+	return conn, nil
+}
+
+// QueryAllServers queries all configured servers concurrently. req is used
+// as a template; each server receives a copy addressed to its machine ID
+func (c *LogQueryClient) QueryAllServers(req *pb.QueryRequest) []QueryResult {
 	var wg sync.WaitGroup
 	results := make([]QueryResult, len(c.servers))
 	resultChan := make(chan QueryResult, len(c.servers))
@@ -53,7 +176,7 @@ func (c *LogQueryClient) QueryAllServers(pattern, options string) []QueryResult
 		wg.Add(1)
 		go func(index int, srv ServerConfig) {
 			defer wg.Done()
-			result := c.queryServer(srv, pattern, options)
+			result := c.queryServer(srv, req)
 			result.MachineID = srv.MachineID
 			resultChan <- result
 		}(i, server)
@@ -80,13 +203,13 @@ func (c *LogQueryClient) QueryAllServers(pattern, options string) []QueryResult
 }
 
 // queryServer queries a single server
-func (c *LogQueryClient) queryServer(server ServerConfig, pattern, options string) QueryResult {
+func (c *LogQueryClient) queryServer(server ServerConfig, template *pb.QueryRequest) QueryResult {
 	// Create context with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
 	defer cancel()
 
 	// Connect to server
-	conn, err := grpc.Dial(server.Address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := c.connect(server)
 	if err != nil {
 		return QueryResult{
 			Error: fmt.Errorf("failed to connect to %s: %v", server.Address, err),
@@ -98,10 +221,10 @@ func (c *LogQueryClient) queryServer(server ServerConfig, pattern, options strin
 	client := pb.NewLogQueryClient(conn)
 
 	// Create request
-	req := &pb.QueryRequest{
-		Pattern:   pattern,
-		Options:   options,
-		MachineId: server.MachineID,
+	req := proto.Clone(template).(*pb.QueryRequest)
+	req.MachineId = server.MachineID
+	if server.PageToken != "" {
+		req.PageToken = server.PageToken
 	}
 
 	// Execute query
@@ -117,14 +240,977 @@ func (c *LogQueryClient) queryServer(server ServerConfig, pattern, options strin
 	}
 }
 
+// IndexStatusResult is the index report of a single server
+type IndexStatusResult struct {
+	MachineID string
+	Response  *pb.IndexStatusResponse
+	Error     error
+}
+
+// IndexStatusAll asks every configured server how up to date its trigram
+// indexes are, concurrently. Results are in server order
+func (c *LogQueryClient) IndexStatusAll(req *pb.IndexStatusRequest) []IndexStatusResult {
+	var wg sync.WaitGroup
+	results := make([]IndexStatusResult, len(c.servers))
+	for i, server := range c.servers {
+		wg.Add(1)
+		go func(index int, srv ServerConfig) {
+			defer wg.Done()
+			results[index] = c.indexStatus(srv, req)
+			results[index].MachineID = srv.MachineID
+		}(i, server)
+	}
+	wg.Wait()
+	return results
+}
+
+// indexStatus fetches the index report of a single server
+func (c *LogQueryClient) indexStatus(server ServerConfig, req *pb.IndexStatusRequest) IndexStatusResult {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	conn, err := c.dial(server.Address)
+	if err != nil {
+		return IndexStatusResult{Error: fmt.Errorf("failed to connect to %s: %v", server.Address, err)}
+	}
+	defer conn.Close()
+
+	response, err := pb.NewLogQueryClient(conn).IndexStatus(ctx, req)
+	if err != nil {
+		return IndexStatusResult{Error: fmt.Errorf("index status failed on %s: %v", server.Address, err)}
+	}
+	return IndexStatusResult{Response: response}
+}
+
+// PrintIndexStatus prints one row per log file per server
+func PrintIndexStatus(results []IndexStatusResult, now time.Time) {
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "MACHINE\tFILE\tSTATE\tSIZE\tINDEXED\tLAG\tBLOCKS\tUPDATED\tREBUILDS")
+	var problems []string
+	for _, result := range results {
+		switch {
+		case result.Error != nil:
+			problems = append(problems, fmt.Sprintf("MACHINE_%s: %v", result.MachineID, result.Error))
+			continue
+		case !result.Response.Enabled:
+			problems = append(problems, fmt.Sprintf("MACHINE_%s: indexing is disabled (start the server with -index-dir)", result.MachineID))
+			continue
+		}
+		for _, file := range result.Response.Files {
+			updated := "-"
+			if file.Updated != nil {
+				updated = now.Sub(file.Updated.AsTime()).Round(time.Second).String() + " ago"
+			}
+			state := strings.ToLower(strings.TrimPrefix(file.State.String(), "INDEX_STATE_"))
+			fmt.Fprintf(table, "MACHINE_%s\t%s\t%s\t%d\t%d\t%d\t%d\t%s\t%d\n",
+				result.MachineID, file.Filename, state, file.FileSize, file.IndexedBytes,
+				file.LagBytes, file.Blocks, updated, file.Rebuilds)
+			if file.Error != "" {
+				problems = append(problems, fmt.Sprintf("MACHINE_%s: %s: %s", result.MachineID, file.Filename, file.Error))
+			}
+		}
+	}
+	table.Flush()
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+}
+
+// ListFilesResult is the file list of a single server
+type ListFilesResult struct {
+	MachineID string
+	Response  *pb.ListFilesResponse
+	Error     error
+}
+
+// ListFilesAll asks every configured server which log files it can
+// search, concurrently. Results are in server order
+func (c *LogQueryClient) ListFilesAll(req *pb.ListFilesRequest) []ListFilesResult {
+	var wg sync.WaitGroup
+	results := make([]ListFilesResult, len(c.servers))
+	for i, server := range c.servers {
+		wg.Add(1)
+		go func(index int, srv ServerConfig) {
+			defer wg.Done()
+			results[index] = c.listFiles(srv, req)
+			results[index].MachineID = srv.MachineID
+		}(i, server)
+	}
+	wg.Wait()
+	return results
+}
+
+// listFiles fetches the file list of a single server
+func (c *LogQueryClient) listFiles(server ServerConfig, req *pb.ListFilesRequest) ListFilesResult {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	conn, err := c.dial(server.Address)
+	if err != nil {
+		return ListFilesResult{Error: fmt.Errorf("failed to connect to %s: %v", server.Address, err)}
+	}
+	defer conn.Close()
+
+	response, err := pb.NewLogQueryClient(conn).ListFiles(ctx, req)
+	if err != nil {
+		return ListFilesResult{Error: fmt.Errorf("listing files failed on %s: %v", server.Address, err)}
+	}
+	return ListFilesResult{Response: response}
+}
+
+// PrintFiles prints one row per log file per server, followed by the
+// totals across the cluster. Estimated line counts are marked with ~
+func PrintFiles(results []ListFilesResult) {
+	const layout = "2006-01-02 15:04:05"
+	formatTime := func(t *timestamppb.Timestamp) string {
+		if t == nil {
+			return "-"
+		}
+		return t.AsTime().Local().Format(layout)
+	}
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "MACHINE\tFILE\tSIZE\tMODIFIED\tLINES\tFIRST\tLAST\tCOMPRESSION")
+	var problems []string
+	var files, servers int
+	var size, lines int64
+	var first, last *timestamppb.Timestamp
+	for _, result := range results {
+		if result.Error != nil {
+			problems = append(problems, fmt.Sprintf("MACHINE_%s: %v", result.MachineID, result.Error))
+			continue
+		}
+		servers++
+		for _, file := range result.Response.Files {
+			if file.Error != "" {
+				problems = append(problems, fmt.Sprintf("MACHINE_%s: %s: %s", result.MachineID, file.Filename, file.Error))
+				continue
+			}
+			count := fmt.Sprint(file.Lines)
+			if !file.LinesExact {
+				count = "~" + count
+			}
+			compression := strings.ToLower(strings.TrimPrefix(file.Compression.String(), "COMPRESSION_"))
+			fmt.Fprintf(table, "MACHINE_%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n",
+				result.MachineID, file.Filename, file.Size, formatTime(file.Modified), count,
+				formatTime(file.FirstTimestamp), formatTime(file.LastTimestamp), compression)
+
+			files++
+			size += file.Size
+			lines += file.Lines
+			if file.FirstTimestamp != nil && (first == nil || file.FirstTimestamp.AsTime().Before(first.AsTime())) {
+				first = file.FirstTimestamp
+			}
+			if file.LastTimestamp != nil && (last == nil || file.LastTimestamp.AsTime().After(last.AsTime())) {
+				last = file.LastTimestamp
+			}
+		}
+	}
+	table.Flush()
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	fmt.Printf("\n%d files on %d/%d servers: %d bytes, about %d lines, logged from %s to %s\n",
+		files, servers, len(results), size, lines, formatTime(first), formatTime(last))
+}
+
+// ServerLoadResult is the search load reported by a single server
+type ServerLoadResult struct {
+	MachineID string
+	Response  *pb.ServerLoadResponse
+	Error     error
+}
+
+// ServerLoadAll asks every configured server how busy it is with searches,
+// concurrently. Results are in server order
+func (c *LogQueryClient) ServerLoadAll() []ServerLoadResult {
+	var wg sync.WaitGroup
+	results := make([]ServerLoadResult, len(c.servers))
+	for i, server := range c.servers {
+		wg.Add(1)
+		go func(index int, srv ServerConfig) {
+			defer wg.Done()
+			results[index] = c.serverLoad(srv)
+			results[index].MachineID = srv.MachineID
+		}(i, server)
+	}
+	wg.Wait()
+	return results
+}
+
+// serverLoad fetches the load of a single server
+func (c *LogQueryClient) serverLoad(server ServerConfig) ServerLoadResult {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	conn, err := c.dial(server.Address)
+	if err != nil {
+		return ServerLoadResult{Error: fmt.Errorf("failed to connect to %s: %v", server.Address, err)}
+	}
+	defer conn.Close()
+
+	response, err := pb.NewLogQueryClient(conn).ServerLoad(ctx, &pb.ServerLoadRequest{})
+	if err != nil {
+		return ServerLoadResult{Error: fmt.Errorf("load report failed on %s: %v", server.Address, err)}
+	}
+	return ServerLoadResult{Response: response}
+}
+
+// PrintServerLoad prints one row per server with its running and queued
+// searches against their limits, its counts of turned away searches and
+// its per-search budgets
+func PrintServerLoad(results []ServerLoadResult) {
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "MACHINE\tRUNNING\tQUEUED\tADMITTED\tREJECTED\tOVER BUDGET\tRETRY AFTER\tBYTE BUDGET\tCPU BUDGET\tCACHE HIT/PARTIAL/MISS\tCACHE MB")
+	var problems []string
+	for _, result := range results {
+		if result.Error != nil {
+			problems = append(problems, fmt.Sprintf("MACHINE_%s: %v", result.MachineID, result.Error))
+			continue
+		}
+		load := result.Response
+		bytes, cpu := "-", "-"
+		if load.MaxQueryBytes > 0 {
+			bytes = fmt.Sprint(load.MaxQueryBytes)
+		}
+		if load.MaxQueryCpu != nil {
+			cpu = load.MaxQueryCpu.AsDuration().String()
+		}
+		cacheUse, cacheSize := "off", "-"
+		if cache := load.Cache; cache.GetEnabled() {
+			cacheUse = fmt.Sprintf("%d/%d/%d", cache.Hits, cache.PartialHits, cache.Misses)
+			cacheSize = fmt.Sprintf("%.1f/%.0f", float64(cache.Bytes)/(1<<20), float64(cache.Capacity)/(1<<20))
+		}
+		fmt.Fprintf(table, "MACHINE_%s\t%d/%d\t%d/%d\t%d\t%d\t%d\t%v\t%s\t%s\t%s\t%s\n",
+			result.MachineID, load.ActiveSearches, load.MaxActiveSearches, load.QueuedSearches, load.MaxQueuedSearches,
+			load.Admitted, load.Rejected, load.BudgetExceeded, load.RetryAfter.AsDuration().Round(time.Millisecond), bytes, cpu,
+			cacheUse, cacheSize)
+	}
+	table.Flush()
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+}
+
+// StreamAllServers queries all configured servers concurrently using the
+// streaming RPC. onMatches is called for each batch of matches as it
+// arrives; calls are serialized so the callback needs no locking. The
+// returned results carry counts and status but not the streamed matches
+func (c *LogQueryClient) StreamAllServers(req *pb.QueryRequest, onMatches func(machineID, filename string, matches []*pb.Match)) []QueryResult {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	results := make([]QueryResult, len(c.servers))
+
+	deliver := func(machineID, filename string, matches []*pb.Match) {
+		mu.Lock()
+		defer mu.Unlock()
+		onMatches(machineID, filename, matches)
+	}
+
+	// Stream from each server concurrently
+	for i, server := range c.servers {
+		wg.Add(1)
+		go func(index int, srv ServerConfig) {
+			defer wg.Done()
+			result := c.streamServer(srv, req, deliver)
+			result.MachineID = srv.MachineID
+			results[index] = result
+		}(i, server)
+	}
+
+	wg.Wait()
+	return results
+}
+
+// streamServer streams query results from a single server
+func (c *LogQueryClient) streamServer(server ServerConfig, template *pb.QueryRequest, onMatches func(machineID, filename string, matches []*pb.Match)) QueryResult {
+	// Create context with timeout
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	// Connect to server
+	conn, err := c.connect(server)
+	if err != nil {
+		return QueryResult{
+			Error: fmt.Errorf("failed to connect to %s: %v", server.Address, err),
+		}
+	}
+	defer conn.Close()
+
+	client := pb.NewLogQueryClient(conn)
+	req := proto.Clone(template).(*pb.QueryRequest)
+	req.MachineId = server.MachineID
+	if server.PageToken != "" {
+		req.PageToken = server.PageToken
+	}
+
+	stream, err := client.StreamQueryLogs(ctx, req)
+	if err != nil {
+		return QueryResult{
+			Error: fmt.Errorf("query failed on %s: %v", server.Address, err),
+		}
+	}
+
+	// Receive batches until the trailer arrives
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			return QueryResult{
+				Error: fmt.Errorf("stream from %s ended without a trailer", server.Address),
+			}
+		}
+		if err != nil {
+			return QueryResult{
+				Error: fmt.Errorf("query failed on %s: %v", server.Address, err),
+			}
+		}
+
+		if len(chunk.Matches) > 0 {
+			onMatches(server.MachineID, chunk.Filename, chunk.Matches)
+		}
+
+		if trailer := chunk.Trailer; trailer != nil {
+			return QueryResult{
+				Response: &pb.QueryResponse{
+					MachineId:     chunk.MachineId,
+					LineCount:     trailer.LineCount,
+					Filename:      chunk.Filename,
+					Error:         trailer.Error,
+					Success:       trailer.Success,
+					Files:         trailer.Files,
+					NextPageToken: trailer.NextPageToken,
+					Truncated:     trailer.Truncated,
+					BytesScanned:  trailer.BytesScanned,
+				},
+			}
+		}
+	}
+}
+
+// AggregateResult is the aggregation computed by a single server
+type AggregateResult struct {
+	MachineID string
+	Response  *pb.AggregateResponse
+	Error     error
+}
+
+// AggregateAllServers asks every configured server to count the lines its
+// query selects by group, concurrently. Results are in server order
+func (c *LogQueryClient) AggregateAllServers(req *pb.AggregateRequest) []AggregateResult {
+	var wg sync.WaitGroup
+	results := make([]AggregateResult, len(c.servers))
+	for i, server := range c.servers {
+		wg.Add(1)
+		go func(index int, srv ServerConfig) {
+			defer wg.Done()
+			results[index] = c.aggregateServer(srv, req)
+			results[index].MachineID = srv.MachineID
+		}(i, server)
+	}
+	wg.Wait()
+	return results
+}
+
+// aggregateServer runs an aggregation on a single server
+func (c *LogQueryClient) aggregateServer(server ServerConfig, template *pb.AggregateRequest) AggregateResult {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	conn, err := c.connect(server)
+	if err != nil {
+		return AggregateResult{Error: fmt.Errorf("failed to connect to %s: %v", server.Address, err)}
+	}
+	defer conn.Close()
+
+	req := proto.Clone(template).(*pb.AggregateRequest)
+	req.Query.MachineId = server.MachineID
+	response, err := pb.NewLogQueryClient(conn).Aggregate(ctx, req)
+	if err != nil {
+		return AggregateResult{Error: fmt.Errorf("aggregation failed on %s: %v", server.Address, err)}
+	}
+	return AggregateResult{Response: response}
+}
+
+// aggregateFailure is a machine or file whose matches are missing from an
+// aggregation
+type aggregateFailure struct {
+	Machine string `json:"machine"`
+	File    string `json:"file,omitempty"`
+	Error   string `json:"error"`
+}
+
+// mergeAggregates merges the counts of every machine that answered and
+// returns them with the number of lines they cover and what went wrong
+func mergeAggregates(results []AggregateResult) (*aggregate.Merged, int64, []aggregateFailure) {
+	merged := aggregate.NewMerged()
+	var total int64
+	var failures []aggregateFailure
+	for _, result := range results {
+		switch {
+		case result.Error != nil:
+			failures = append(failures, aggregateFailure{Machine: result.MachineID, Error: result.Error.Error()})
+			continue
+		case !result.Response.Success:
+			failures = append(failures, aggregateFailure{Machine: result.MachineID, Error: result.Response.Error})
+			continue
+		}
+		rows := make([]aggregate.Row, 0, len(result.Response.Groups))
+		for _, group := range result.Response.Groups {
+			row := aggregate.Row{Values: group.Values, Count: group.Count}
+			if group.Bucket != nil {
+				row.Bucket = group.Bucket.AsTime().Local()
+			}
+			rows = append(rows, row)
+		}
+		merged.Add(result.MachineID, rows, result.Response.OtherCount)
+		total += result.Response.LineCount
+		for _, file := range result.Response.Files {
+			if file.Error != "" {
+				failures = append(failures, aggregateFailure{Machine: result.MachineID, File: file.Filename, Error: file.Error})
+			}
+		}
+	}
+	return merged, total, failures
+}
+
+// PrintAggregate merges the counts of every machine and prints them as a
+// table with a column per machine, followed by any failures
+func PrintAggregate(results []AggregateResult, req *pb.AggregateRequest) {
+	merged, total, failures := mergeAggregates(results)
+
+	// Header: the bucket, the group-by fields, the total and each machine
+	machines := merged.Machines()
+	bucketed := req.Bucket != nil
+	var header []string
+	if bucketed {
+		header = append(header, "BUCKET")
+	}
+	for _, field := range req.GroupBy {
+		header = append(header, strings.ToUpper(field))
+	}
+	header = append(header, "TOTAL")
+	for _, machine := range machines {
+		header = append(header, "MACHINE_"+machine)
+	}
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, strings.Join(header, "\t"))
+	printRow := func(labels []string, count int64, byMachine map[string]int64) {
+		cells := append([]string(nil), labels...)
+		cells = append(cells, fmt.Sprint(count))
+		for _, machine := range machines {
+			cells = append(cells, fmt.Sprint(byMachine[machine]))
+		}
+		fmt.Fprintln(table, strings.Join(cells, "\t"))
+	}
+	for _, row := range merged.Rows() {
+		var labels []string
+		if bucketed {
+			labels = append(labels, formatBucket(row.Bucket))
+		}
+		for _, value := range row.Values {
+			if value == "" {
+				value = "-"
+			}
+			labels = append(labels, value)
+		}
+		printRow(labels, row.Count, row.ByMachine)
+	}
+
+	// Blank labels for the summary rows, with the name in the first column
+	summary := func(name string) []string {
+		labels := make([]string, len(header)-1-len(machines))
+		labels[0] = name
+		return labels
+	}
+	if other := merged.Other(); len(other) > 0 {
+		var count int64
+		for _, n := range other {
+			count += n
+		}
+		printRow(summary("(other groups)"), count, other)
+	}
+	table.Flush()
+
+	fmt.Printf("\nTotal matching lines: %d\n", total)
+	for _, failure := range failures {
+		if failure.File != "" {
+			fmt.Printf("⚠️  MACHINE_%s: %s: %s\n", failure.Machine, failure.File, failure.Error)
+		} else {
+			fmt.Printf("❌ MACHINE_%s: %s\n", failure.Machine, failure.Error)
+		}
+	}
+}
+
+// jsonGroup is the JSON form of a merged group printed with -json
+type jsonGroup struct {
+	Bucket   string            `json:"bucket,omitempty"`
+	Fields   map[string]string `json:"fields,omitempty"`
+	Count    int64             `json:"count"`
+	Machines map[string]int64  `json:"machines"`
+}
+
+// jsonAggregate is the JSON form of an aggregation printed with -json
+type jsonAggregate struct {
+	Groups     []jsonGroup        `json:"groups"`
+	Other      *jsonGroup         `json:"other,omitempty"` // matches in groups the servers left out
+	TotalLines int64              `json:"total_lines"`
+	Errors     []aggregateFailure `json:"errors,omitempty"`
+}
+
+// PrintAggregateJSON merges the counts of every machine and prints them as
+// a single JSON object
+func PrintAggregateJSON(results []AggregateResult, req *pb.AggregateRequest) error {
+	merged, total, failures := mergeAggregates(results)
+	out := jsonAggregate{Groups: []jsonGroup{}, TotalLines: total, Errors: failures}
+	for _, row := range merged.Rows() {
+		group := jsonGroup{Count: row.Count, Machines: row.ByMachine}
+		if !row.Bucket.IsZero() {
+			group.Bucket = row.Bucket.Format(time.RFC3339)
+		}
+		if len(req.GroupBy) > 0 {
+			group.Fields = map[string]string{}
+			for i, field := range req.GroupBy {
+				group.Fields[field] = row.Values[i]
+			}
+		}
+		out.Groups = append(out.Groups, group)
+	}
+	if other := merged.Other(); len(other) > 0 {
+		out.Other = &jsonGroup{Machines: other}
+		for _, n := range other {
+			out.Other.Count += n
+		}
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(out)
+}
+
+// formatBucket renders the start of a time bucket; lines without a
+// timestamp fall in the unnamed bucket
+func formatBucket(bucket time.Time) string {
+	if bucket.IsZero() {
+		return "(no timestamp)"
+	}
+	return bucket.Format("2006-01-02 15:04:05")
+}
+
+// TopMessagesResult is the top message candidates of a single server
+type TopMessagesResult struct {
+	MachineID string
+	Response  *pb.TopMessagesResponse
+	Error     error
+}
+
+// TopMessagesAll asks every configured server for the most frequent
+// normalized messages among the lines its query selects, concurrently.
+// Results are in server order
+func (c *LogQueryClient) TopMessagesAll(req *pb.TopMessagesRequest) []TopMessagesResult {
+	var wg sync.WaitGroup
+	results := make([]TopMessagesResult, len(c.servers))
+	for i, server := range c.servers {
+		wg.Add(1)
+		go func(index int, srv ServerConfig) {
+			defer wg.Done()
+			results[index] = c.topMessagesServer(srv, req)
+			results[index].MachineID = srv.MachineID
+		}(i, server)
+	}
+	wg.Wait()
+	return results
+}
+
+// topMessagesServer asks a single server for its top message candidates
+func (c *LogQueryClient) topMessagesServer(server ServerConfig, template *pb.TopMessagesRequest) TopMessagesResult {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	conn, err := c.connect(server)
+	if err != nil {
+		return TopMessagesResult{Error: fmt.Errorf("failed to connect to %s: %v", server.Address, err)}
+	}
+	defer conn.Close()
+
+	req := proto.Clone(template).(*pb.TopMessagesRequest)
+	req.Query.MachineId = server.MachineID
+	response, err := pb.NewLogQueryClient(conn).TopMessages(ctx, req)
+	if err != nil {
+		return TopMessagesResult{Error: fmt.Errorf("top messages failed on %s: %v", server.Address, err)}
+	}
+	return TopMessagesResult{Response: response}
+}
+
+// MergeTopMessages combines the candidates of every machine that answered,
+// returning the merge and the failures to report
+func MergeTopMessages(results []TopMessagesResult) (*aggregate.TopMerge, int64, []string) {
+	merged := aggregate.NewTopMerge()
+	var total int64
+	var problems []string
+	for _, result := range results {
+		switch {
+		case result.Error != nil:
+			problems = append(problems, fmt.Sprintf("❌ MACHINE_%s: Error - %v", result.MachineID, result.Error))
+			continue
+		case !result.Response.Success:
+			problems = append(problems, fmt.Sprintf("❌ MACHINE_%s: %s", result.MachineID, result.Response.Error))
+			continue
+		}
+		candidates := make([]aggregate.Candidate, 0, len(result.Response.Messages))
+		for _, message := range result.Response.Messages {
+			candidates = append(candidates, aggregate.Candidate{
+				Key:     message.Message,
+				Count:   message.Count,
+				Error:   message.Error,
+				Example: message.Example,
+			})
+		}
+		merged.Add(result.MachineID, candidates, result.Response.Threshold)
+		total += result.Response.LineCount
+		for _, file := range result.Response.Files {
+			if file.Error != "" {
+				problems = append(problems, fmt.Sprintf("⚠️  MACHINE_%s: %s: %s", result.MachineID, file.Filename, file.Error))
+			}
+		}
+	}
+	return merged, total, problems
+}
+
+// PrintTopMessages merges the candidates of every machine and prints the n
+// most frequent messages as a table with a column per machine. Counts that
+// are estimates are shown with the range the true count lies in, and a
+// machine that did not list a message shows the most it can have seen
+func PrintTopMessages(results []TopMessagesResult, n int) {
+	merged, total, problems := MergeTopMessages(results)
+	machines := merged.Machines()
+
+	header := []string{"RANK", "COUNT", "RANGE"}
+	for _, machine := range machines {
+		header = append(header, "MACHINE_"+machine)
+	}
+	header = append(header, "MESSAGE")
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, strings.Join(header, "\t"))
+	for i, candidate := range merged.Top(n) {
+		bounds := "exact"
+		if candidate.Lower != candidate.Count || candidate.Upper != candidate.Count {
+			bounds = fmt.Sprintf("%d-%d", candidate.Lower, candidate.Upper)
+		}
+		cells := []string{fmt.Sprint(i + 1), fmt.Sprint(candidate.Count), bounds}
+		for _, machine := range machines {
+			count, listed := candidate.ByMachine[machine]
+			switch threshold := merged.Threshold(machine); {
+			case listed:
+				cells = append(cells, fmt.Sprint(count))
+			case threshold > 0:
+				cells = append(cells, fmt.Sprintf("≤%d", threshold))
+			default:
+				cells = append(cells, "0")
+			}
+		}
+		cells = append(cells, candidate.Key)
+		fmt.Fprintln(table, strings.Join(cells, "\t"))
+	}
+	table.Flush()
+
+	fmt.Printf("\nTotal matching lines: %d\n", total)
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+}
+
+// Delays between attempts to reconnect a follow to a server, doubling from
+// the first up to the second
+const (
+	followRetryMin = time.Second
+	followRetryMax = 30 * time.Second
+)
+
+// FollowAllServers follows every configured server until ctx is canceled,
+// calling onMatches for each batch of newly logged matches; calls are
+// serialized so the callback needs no locking. Servers that cannot be
+// reached or drop the stream are retried with growing delays, except when
+// they reject the request itself
+func (c *LogQueryClient) FollowAllServers(ctx context.Context, req *pb.QueryRequest, onMatches func(machineID, filename string, matches []*pb.Match)) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	deliver := func(machineID, filename string, matches []*pb.Match) {
+		mu.Lock()
+		defer mu.Unlock()
+		onMatches(machineID, filename, matches)
+	}
+
+	for _, server := range c.servers {
+		wg.Add(1)
+		go func(srv ServerConfig) {
+			defer wg.Done()
+			c.followServer(ctx, srv, req, deliver)
+		}(server)
+	}
+	wg.Wait()
+}
+
+// followServer follows a single server, reconnecting whenever the stream
+// breaks. Lines logged while disconnected are not replayed
+func (c *LogQueryClient) followServer(ctx context.Context, server ServerConfig, req *pb.QueryRequest, onMatches func(machineID, filename string, matches []*pb.Match)) {
+	delay := followRetryMin
+	for attempt := 0; ; attempt++ {
+		connected, err := c.followOnce(ctx, server, req, attempt > 0, onMatches)
+		if ctx.Err() != nil {
+			return
+		}
+		switch status.Code(err) {
+		case codes.InvalidArgument, codes.Unimplemented, codes.PermissionDenied:
+			log.Printf("MACHINE_%s: %v", server.MachineID, err)
+			return
+		}
+		if connected {
+			delay = followRetryMin
+		}
+		log.Printf("MACHINE_%s: %v; reconnecting in %v", server.MachineID, err, delay)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, followRetryMax)
+	}
+}
+
+// followOnce runs one follow stream until it breaks. It reports whether the
+// server accepted the stream before it did
+func (c *LogQueryClient) followOnce(ctx context.Context, server ServerConfig, template *pb.QueryRequest, reconnect bool, onMatches func(machineID, filename string, matches []*pb.Match)) (bool, error) {
+	// Keepalive pings notice a server that disappears without closing the
+	// connection, which an idle stream would otherwise wait on forever
+	conn, err := c.connect(server,
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{Time: 15 * time.Second, Timeout: 10 * time.Second}))
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to %s: %v", server.Address, err)
+	}
+	defer conn.Close()
+
+	req := proto.Clone(template).(*pb.QueryRequest)
+	req.MachineId = server.MachineID
+	stream, err := pb.NewLogQueryClient(conn).FollowLogs(ctx, req)
+	if err != nil {
+		return false, fmt.Errorf("follow failed on %s: %w", server.Address, err)
+	}
+	// The server sends headers once it has started following
+	if _, err := stream.Header(); err != nil {
+		return false, fmt.Errorf("follow failed on %s: %w", server.Address, err)
+	}
+	if reconnect {
+		log.Printf("MACHINE_%s: reconnected to %s", server.MachineID, server.Address)
+	}
+
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			return true, fmt.Errorf("%s ended the stream", server.Address)
+		}
+		if err != nil {
+			return true, fmt.Errorf("follow failed on %s: %w", server.Address, err)
+		}
+		if len(chunk.Matches) > 0 {
+			onMatches(server.MachineID, chunk.Filename, chunk.Matches)
+		}
+		if trailer := chunk.Trailer; trailer != nil {
+			return true, fmt.Errorf("follow failed on %s: %s", server.Address, trailer.Error)
+		}
+	}
+}
+
+// ANSI escape sequences used to highlight matches, as grep --color does
+const (
+	colorMatch = "\x1b[01;31m"
+	colorReset = "\x1b[m"
+)
+
+// matchPrinter renders matches grep-style: matching lines as
+// MACHINE_<id>:<file>:<line>, context lines as MACHINE_<id>:<file>-<line>,
+// and "--" between non-adjacent groups from the same machine and file
+type matchPrinter struct {
+	prefix      string
+	color       bool // highlight match spans with ANSI colour
+	lineNumbers bool // prefix each line with its line number, like grep -n
+	gaps        bool // print "--" between non-adjacent groups
+	lastLine    map[string]int64
+}
+
+// newMatchPrinter creates a printer that starts each output line with prefix
+func newMatchPrinter(prefix string, color, lineNumbers bool) *matchPrinter {
+	return &matchPrinter{
+		prefix:      prefix,
+		color:       color,
+		lineNumbers: lineNumbers,
+		gaps:        true,
+		lastLine:    make(map[string]int64),
+	}
+}
+
+// Print renders a batch of matches from one machine and file
+func (p *matchPrinter) Print(machineID, filename string, matches []*pb.Match) {
+	key := machineID + "\x00" + filename
+	for _, match := range matches {
+		first := match.LineNumber - int64(len(match.Before))
+		if last, ok := p.lastLine[key]; ok && p.gaps && first > last+1 {
+			fmt.Printf("%s--\n", p.prefix)
+		}
+
+		for i, line := range match.Before {
+			p.printLine(machineID, filename, "-", first+int64(i), line)
+		}
+		p.printLine(machineID, filename, ":", match.LineNumber, p.highlight(match))
+		for i, line := range match.After {
+			p.printLine(machineID, filename, "-", match.LineNumber+1+int64(i), line)
+		}
+
+		p.lastLine[key] = match.LineNumber + int64(len(match.After))
+	}
+}
+
+// printLine prints one output line; sep is ":" for matches and "-" for context
+func (p *matchPrinter) printLine(machineID, filename, sep string, number int64, text string) {
+	if p.lineNumbers {
+		fmt.Printf("%sMACHINE_%s:%s%s%d%s%s\n", p.prefix, machineID, filename, sep, number, sep, text)
+		return
+	}
+	fmt.Printf("%sMACHINE_%s:%s%s%s\n", p.prefix, machineID, filename, sep, text)
+}
+
+// highlight returns the matching line with its spans wrapped in colour codes
+// when colour output is enabled
+func (p *matchPrinter) highlight(match *pb.Match) string {
+	if !p.color || len(match.Spans) == 0 {
+		return match.Line
+	}
+
+	var b strings.Builder
+	pos := 0
+	for _, span := range match.Spans {
+		start, end := int(span.Start), int(span.End)
+		// Ignore spans that overlap or fall outside the line
+		if start < pos || end > len(match.Line) || start >= end {
+			continue
+		}
+		b.WriteString(match.Line[pos:start])
+		b.WriteString(colorMatch)
+		b.WriteString(match.Line[start:end])
+		b.WriteString(colorReset)
+		pos = end
+	}
+	b.WriteString(match.Line[pos:])
+	return b.String()
+}
+
+// jsonRecord is the JSON form of a parsed match printed with -records
+type jsonRecord struct {
+	Machine    string            `json:"machine"`
+	File       string            `json:"file"`
+	LineNumber int64             `json:"line_number"`
+	Timestamp  string            `json:"timestamp,omitempty"`
+	Level      string            `json:"level,omitempty"`
+	Message    string            `json:"message"`
+	Raw        string            `json:"raw"`
+	Fields     map[string]string `json:"fields,omitempty"`
+}
+
+// newJSONRecord builds the JSON form of a match, falling back to the raw
+// line when the server did not return a parsed record
+func newJSONRecord(machineID, filename string, match *pb.Match) jsonRecord {
+	record := jsonRecord{
+		Machine:    machineID,
+		File:       filename,
+		LineNumber: match.LineNumber,
+		Message:    match.Line,
+		Raw:        match.Line,
+		Fields:     match.Fields,
+	}
+	if r := match.Record; r != nil {
+		record.Level = r.Level
+		record.Message = r.Message
+		if r.Timestamp != nil {
+			record.Timestamp = r.Timestamp.AsTime().Local().Format(time.RFC3339)
+		}
+	}
+	return record
+}
+
+// timeFlagLayouts are the absolute time formats accepted by -since and -until
+var timeFlagLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseTimeFlag parses a -since/-until value: either a duration relative to
+// now, such as "15m" or "2h30m", or an absolute time in local time
+func parseTimeFlag(value string, now time.Time) (*timestamppb.Timestamp, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		if d < 0 {
+			return nil, fmt.Errorf("relative time %q must not be negative", value)
+		}
+		return timestamppb.New(now.Add(-d)), nil
+	}
+	for _, layout := range timeFlagLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return timestamppb.New(t), nil
+		}
+	}
+	return nil, fmt.Errorf("cannot parse %q as a duration (e.g. 15m) or time (e.g. 2024-01-15 10:30:00)", value)
+}
+
+// parseLevelFlag parses a -level value: "ERROR+" selects ERROR and anything
+// more severe, while "ERROR" or "WARN,ERROR" select exactly those levels
+func parseLevelFlag(value string) (pb.Level, []pb.Level, error) {
+	if value == "" {
+		return pb.Level_LEVEL_UNSPECIFIED, nil, nil
+	}
+	parse := func(name string) (pb.Level, error) {
+		severity := logparse.ParseSeverity(strings.TrimSpace(name))
+		if severity == logparse.SeverityUnknown {
+			return pb.Level_LEVEL_UNSPECIFIED, fmt.Errorf("unknown level %q (use DEBUG, INFO, WARN, ERROR or CRITICAL)", name)
+		}
+		return pb.Level(severity), nil
+	}
+
+	if name, ok := strings.CutSuffix(value, "+"); ok {
+		minLevel, err := parse(name)
+		return minLevel, nil, err
+	}
+	var levels []pb.Level
+	for _, name := range strings.Split(value, ",") {
+		level, err := parse(name)
+		if err != nil {
+			return pb.Level_LEVEL_UNSPECIFIED, nil, err
+		}
+		levels = append(levels, level)
+	}
+	return pb.Level_LEVEL_UNSPECIFIED, levels, nil
+}
+
+// isTerminal reports whether f is attached to a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
 // PrintResults formats and prints the query results
-func (c *LogQueryClient) PrintResults(results []QueryResult, pattern string, countOnly bool) {
+func (c *LogQueryClient) PrintResults(results []QueryResult, pattern string, countOnly bool, printer *matchPrinter) {
 	fmt.Printf("\n=== Distributed Log Query Results ===\n")
 	fmt.Printf("Pattern: %s\n", pattern)
 	fmt.Printf("Servers queried: %d\n\n", len(results))
 
 	totalLines := 0
 	successfulServers := 0
+	totalBytes := int64(0)
 
 	// Sort results by machine ID for consistent output
 	sort.Slice(results, func(i, j int) bool {
@@ -145,6 +1231,7 @@ func (c *LogQueryClient) PrintResults(results []QueryResult, pattern string, cou
 		successfulServers++
 		lineCount := result.Response.LineCount
 		totalLines += int(lineCount)
+		totalBytes += result.Response.BytesScanned
 
 		if countOnly {
 			// Count-only mode: just show the count (like grep -c)
@@ -157,38 +1244,243 @@ func (c *LogQueryClient) PrintResults(results []QueryResult, pattern string, cou
 			} else {
 				fmt.Printf("✅ MACHINE_%s: Found %d matching lines in %s\n",
 					result.MachineID, lineCount, result.Response.Filename)
+			}
+		}
 
-				// Print matching lines
-				for _, line := range result.Response.Lines {
-					fmt.Printf("   MACHINE_%s:%s\n", result.MachineID, line)
-				}
+		// Per-file breakdown: counts when several files were searched,
+		// read errors, and any matches returned by a unary query
+		for _, file := range result.Response.Files {
+			if file.Error != "" {
+				fmt.Printf("   ⚠️  %s: %s\n", file.Filename, file.Error)
+				continue
+			}
+			if len(result.Response.Files) > 1 {
+				fmt.Printf("   %s: %d\n", file.Filename, file.LineCount)
+			}
+			if !countOnly {
+				printer.Print(result.MachineID, file.Filename, file.Matches)
 			}
 		}
+		if result.Response.Truncated {
+			fmt.Printf("   ... more matches available\n")
+		}
 		fmt.Println()
 	}
 
 	// Summary
 	fmt.Printf("=== Summary ===\n")
 	fmt.Printf("Total matching lines: %d\n", totalLines)
+	fmt.Printf("Total bytes scanned: %d\n", totalBytes)
 	fmt.Printf("Successful servers: %d/%d\n", successfulServers, len(results))
 	fmt.Printf("Failed servers: %d\n", len(results)-successfulServers)
 }
 
 func main() {
 	// Parse command line flags
-	options := flag.String("options", "", "Grep options (e.g., '-i', '-E', '-v')")
+	options := flag.String("options", "", "Grep options (-i, -v, -w, -x, -c, -E, -F, -G, -m N, -A N, -B N, -C N)")
 	servers := flag.String("servers", "localhost:8080,localhost:8081,localhost:8082",
 		"Comma-separated list of server addresses")
 	timeout := flag.Duration("timeout", 10*time.Second, "Timeout for each server query")
 	countOnly := flag.Bool("c", false, "Show only count of matching lines (like grep -c)")
-	flag.Parse()
+	files := flag.String("files", "", "Glob restricting which log files each server searches")
+	rotated := flag.Bool("rotated", false, "Also search rotated and compressed copies of each log")
+	lineNumbers := flag.Bool("n", false, "Prefix each line with its line number (like grep -n)")
+	color := flag.String("color", "auto", "Highlight matches: auto (when stdout is a terminal), always or never")
+	since := flag.String("since", "", "Only lines logged at or after this time: a duration ago (15m, 2h) or a time (2024-01-15 10:30:00)")
+	until := flag.String("until", "", "Only lines logged before this time: a duration ago (15m, 2h) or a time (2024-01-15 10:30:00)")
+	records := flag.Bool("records", false, "Print each match as a JSON object with the parsed timestamp, level and message")
+	layout := flag.String("layout", "", "Go time layout of each log line's leading timestamp (default \"2006-01-02 15:04:05\")")
+	queryExpr := flag.String("query", "", "Boolean query instead of a pattern, e.g. 'ERROR AND (database OR \"connection pool\") NOT /time.?out/'")
+	limit := flag.Int("limit", 0, "Show at most this many matches per server, then offer to fetch more (0 for no limit)")
+	level := flag.String("level", "", "Only lines at these levels (WARN,ERROR) or at a level and above (ERROR+)")
+	follow := flag.Bool("follow", false, "Keep streaming matching lines from every server as they are logged, until interrupted (like tail -f | grep)")
+	extract := flag.String("extract", "", "Go regular expression whose named groups, e.g. 'user_(?P<uid>[0-9]+)', become fields of each match (default: an -E pattern with named groups)")
+	groupBy := flag.String("group-by", "", "Count matches per group instead of listing them, by these comma-separated fields: level, file or a field named in -extract")
+	bucket := flag.Duration("bucket", 0, "Count matches per time bucket of this width (e.g. 1m) instead of listing them, by each line's timestamp")
+	top := flag.Int("top", 0, "Instead of listing matches, show the N most frequent messages, with numbers, IDs and timestamps masked out")
+	jsonOutput := flag.Bool("json", false, "Print -group-by and -bucket results as JSON instead of a table")
+	showLoad := flag.Bool("load", false, "Instead of searching, show how busy each server is with searches and its per-search budgets")
+	indexStatus := flag.Bool("index-status", false, "Instead of searching, show how up to date each server's trigram indexes are")
+	useTLS := flag.Bool("tls", false, "Connect to the servers over TLS, verifying them against the system's CAs unless -tls-ca is given")
+	tlsCA := flag.String("tls-ca", "", "PEM CAs that server certificates must be signed by (implies -tls)")
+	tlsCert := flag.String("tls-cert", "", "PEM client certificate to present to servers that verify clients (implies -tls)")
+	tlsKey := flag.String("tls-key", "", "PEM private key of -tls-cert")
+	tlsServerName := flag.String("tls-server-name", "", "Host name expected in server certificates instead of the one dialed")
+	tokenFile := flag.String("token-file", "", "File holding the bearer token to authenticate with (default: $"+tokenEnv+"); needs TLS")
+	healthCheck := flag.Bool("health-check", true, "Check each server's health before searching it, skipping servers that report NOT_SERVING or do not answer within 2s")
 
-	// Get pattern from positional arguments (grep-like format)
+	// A leading "files" lists the log files every server can search
+	// instead; a pattern that happens to be "files" can follow any flag
+	arguments := os.Args[1:]
+	listFiles := len(arguments) > 0 && arguments[0] == "files"
+	if listFiles {
+		arguments = arguments[1:]
+	}
+	flag.CommandLine.Parse(arguments)
+
+	// Get pattern from positional arguments (grep-like format), unless a
+	// boolean query is given instead
 	args := flag.Args()
-	if len(args) == 0 {
-		log.Fatal("Pattern is required. Usage: ./client-grpc <pattern> [options]")
+	var pattern string
+	switch {
+	case listFiles && len(args) > 0:
+		log.Fatalf("Unexpected arguments after files: %s", strings.Join(args, " "))
+	case *indexStatus || *showLoad || listFiles:
+		// Reports on the servers rather than searching them
+	case *queryExpr != "" && len(args) > 0:
+		log.Fatal("Give either a pattern or -query, not both")
+	case *queryExpr != "":
+		// Catch syntax errors before contacting any server
+		if _, err := query.Parse(*queryExpr); err != nil {
+			log.Fatalf("Invalid -query: %v", err)
+		}
+	case len(args) == 0:
+		log.Fatal("Pattern is required. Usage: ./client-grpc <pattern> [options], or ./client-grpc files [options] to list the log files")
+	default:
+		pattern = args[0]
+	}
+
+	// Translate grep-style options into typed query options
+	queryOptions, err := grepopts.Parse(*options)
+	if err != nil {
+		log.Fatalf("Invalid options: %v", err)
+	}
+	if *countOnly {
+		// No need to ship matching lines just to count them
+		queryOptions.CountOnly = true
+	}
+
+	// Resolve the time window relative to a single instant
+	now := time.Now()
+	sinceTime, err := parseTimeFlag(*since, now)
+	if err != nil {
+		log.Fatalf("Invalid -since: %v", err)
+	}
+	untilTime, err := parseTimeFlag(*until, now)
+	if err != nil {
+		log.Fatalf("Invalid -until: %v", err)
+	}
+
+	if *limit < 0 {
+		log.Fatalf("Invalid -limit %d: must not be negative", *limit)
+	}
+
+	minLevel, levels, err := parseLevelFlag(*level)
+	if err != nil {
+		log.Fatalf("Invalid -level: %v", err)
+	}
+
+	// An extended regular expression with named groups extracts its own
+	// fields, so '-options=-E user_(?P<uid>[0-9]+)' can group by uid
+	extractExpr := *extract
+	if extractExpr == "" && queryOptions.RegexFlavor == pb.RegexFlavor_REGEX_FLAVOR_EXTENDED {
+		if _, err := search.NewExtractor(pattern, false); err == nil {
+			extractExpr = pattern
+		}
+	}
+	var extractedFields []string
+	if extractExpr != "" {
+		extractor, err := search.NewExtractor(extractExpr, queryOptions.CaseInsensitive)
+		if err != nil {
+			log.Fatalf("Invalid -extract: %v", err)
+		}
+		extractedFields = extractor.Fields()
+	}
+
+	var groupFields []string
+	for _, field := range strings.Split(*groupBy, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			groupFields = append(groupFields, field)
+		}
+	}
+	aggregating := len(groupFields) > 0 || *bucket != 0
+	if aggregating {
+		if err := (aggregate.Spec{Fields: groupFields, Extracted: extractedFields, Bucket: *bucket}).Validate(); err != nil {
+			log.Fatalf("Invalid -group-by or -bucket: %v", err)
+		}
+		// Aggregation returns counts, not lines
+		var conflict string
+		switch {
+		case *follow:
+			conflict = "-follow"
+		case queryOptions.CountOnly:
+			conflict = "-c"
+		case queryOptions.BeforeContext > 0 || queryOptions.AfterContext > 0:
+			conflict = "context lines (-A, -B, -C)"
+		case *limit > 0:
+			conflict = "-limit"
+		case *records:
+			conflict = "-records"
+		}
+		if conflict != "" {
+			log.Fatalf("-group-by and -bucket cannot be combined with %s", conflict)
+		}
+	}
+
+	if *jsonOutput && !aggregating {
+		log.Fatal("-json only applies to -group-by and -bucket; use -records for matches as JSON")
+	}
+
+	if *top < 0 {
+		log.Fatalf("Invalid -top %d: must not be negative", *top)
+	}
+	if *top > 0 {
+		// Like aggregation, -top returns counts, not lines
+		var conflict string
+		switch {
+		case aggregating:
+			conflict = "-group-by and -bucket"
+		case *follow:
+			conflict = "-follow"
+		case queryOptions.CountOnly:
+			conflict = "-c"
+		case queryOptions.BeforeContext > 0 || queryOptions.AfterContext > 0:
+			conflict = "context lines (-A, -B, -C)"
+		case *limit > 0:
+			conflict = "-limit"
+		case *records:
+			conflict = "-records"
+		}
+		if conflict != "" {
+			log.Fatalf("-top cannot be combined with %s", conflict)
+		}
+	}
+
+	if *follow {
+		// A follow never finishes, so anything that needs the end of the
+		// results is out
+		var conflict string
+		switch {
+		case queryOptions.CountOnly:
+			conflict = "-c"
+		case queryOptions.MaxCount > 0:
+			conflict = "-m"
+		case queryOptions.BeforeContext > 0 || queryOptions.AfterContext > 0:
+			conflict = "context lines (-A, -B, -C)"
+		case *limit > 0:
+			conflict = "-limit"
+		case *rotated:
+			conflict = "-rotated"
+		case *since != "" || *until != "":
+			conflict = "-since and -until"
+		}
+		if conflict != "" {
+			log.Fatalf("-follow cannot be combined with %s", conflict)
+		}
+	}
+
+	// Decide whether to highlight matches
+	var useColor bool
+	switch *color {
+	case "auto":
+		useColor = isTerminal(os.Stdout)
+	case "always":
+		useColor = true
+	case "never":
+		useColor = false
+	default:
+		log.Fatalf("Invalid -color value %q: use auto, always or never", *color)
 	}
-	pattern := args[0]
 
 	// Parse server list
 	serverList := strings.Split(*servers, ",")
@@ -209,20 +1501,215 @@ func main() {
 		}
 	}
 
+	// Encrypt connections when asked to, or when given TLS files
+	var creds credentials.TransportCredentials = insecure.NewCredentials()
+	if *useTLS || *tlsCA != "" || *tlsCert != "" || *tlsKey != "" || *tlsServerName != "" {
+		config, err := tlsconfig.ClientConfig(tlsconfig.Files{Cert: *tlsCert, Key: *tlsKey, CA: *tlsCA}, *tlsServerName)
+		if err != nil {
+			log.Fatalf("Invalid TLS configuration: %v", err)
+		}
+		creds = credentials.NewTLS(config)
+	}
+	token, err := readToken(*tokenFile)
+	if err != nil {
+		log.Fatalf("Invalid -token-file: %v", err)
+	}
+	if token != "" && creds.Info().SecurityProtocol != "tls" {
+		log.Fatal("A bearer token is only sent over TLS; add -tls or -tls-ca")
+	}
+
 	// Create client
 	client := NewLogQueryClient(serverConfigs, *timeout)
+	client.checkHealth = *healthCheck
+	client.creds = creds
+	client.token = token
+
+	if *showLoad {
+		PrintServerLoad(client.ServerLoadAll())
+		return
+	}
+
+	if listFiles {
+		PrintFiles(client.ListFilesAll(&pb.ListFilesRequest{
+			FileFilter:      *files,
+			IncludeRotated:  *rotated,
+			TimestampLayout: *layout,
+		}))
+		return
+	}
+
+	if *indexStatus {
+		PrintIndexStatus(client.IndexStatusAll(&pb.IndexStatusRequest{
+			FileFilter:     *files,
+			IncludeRotated: *rotated,
+		}), time.Now())
+		return
+	}
+
+	req := &pb.QueryRequest{
+		Pattern:         pattern,
+		Query:           *queryExpr,
+		QueryOptions:    queryOptions,
+		FileFilter:      *files,
+		IncludeRotated:  *rotated,
+		Since:           sinceTime,
+		Until:           untilTime,
+		TimestampLayout: *layout,
+		ParseRecords:    *records,
+		MinLevel:        minLevel,
+		Levels:          levels,
+		MaxResults:      int32(*limit),
+		Extract:         extractExpr,
+	}
+
+	searchText := pattern
+	if *queryExpr != "" {
+		searchText = *queryExpr
+	}
+
+	if aggregating {
+		aggReq := &pb.AggregateRequest{Query: req, GroupBy: groupFields}
+		if *bucket != 0 {
+			aggReq.Bucket = durationpb.New(*bucket)
+		}
+		if *jsonOutput {
+			if err := PrintAggregateJSON(client.AggregateAllServers(aggReq), aggReq); err != nil {
+				log.Fatalf("Failed to write JSON: %v", err)
+			}
+			return
+		}
+		fmt.Printf("Aggregating matches of '%s' from %d servers\n\n", searchText, len(serverConfigs))
+		start := time.Now()
+		PrintAggregate(client.AggregateAllServers(aggReq), aggReq)
+		fmt.Printf("Total query time: %v\n", time.Since(start))
+		return
+	}
+
+	if *top > 0 {
+		fmt.Printf("Finding the %d most frequent messages matching '%s' on %d servers\n\n", *top, searchText, len(serverConfigs))
+		start := time.Now()
+		PrintTopMessages(client.TopMessagesAll(&pb.TopMessagesRequest{Query: req, K: int32(*top)}), *top)
+		fmt.Printf("Total query time: %v\n", time.Since(start))
+		return
+	}
+
+	if *follow {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		printer := newMatchPrinter("", useColor, *lineNumbers)
+		// Consecutive live matches are rarely adjacent lines; separating
+		// them would only add noise
+		printer.gaps = false
+		emit := printer.Print
+		if *records {
+			encoder := json.NewEncoder(os.Stdout)
+			emit = func(machineID, filename string, matches []*pb.Match) {
+				for _, match := range matches {
+					if err := encoder.Encode(newJSONRecord(machineID, filename, match)); err != nil {
+						log.Fatalf("Failed to write record: %v", err)
+					}
+				}
+			}
+		} else {
+			fmt.Printf("Following %d servers for pattern: '%s' (interrupt to stop)\n", len(serverConfigs), searchText)
+		}
+		client.FollowAllServers(ctx, req, emit)
+		return
+	}
+
+	if *records {
+		// Emit one JSON object per match on stdout, keeping stdout
+		// machine-readable; failures are reported on stderr
+		encoder := json.NewEncoder(os.Stdout)
+		results := client.StreamAllServers(req, func(machineID, filename string, matches []*pb.Match) {
+			for _, match := range matches {
+				if err := encoder.Encode(newJSONRecord(machineID, filename, match)); err != nil {
+					log.Fatalf("Failed to write record: %v", err)
+				}
+			}
+		})
+		for _, result := range results {
+			if result.Error != nil {
+				log.Printf("MACHINE_%s: %v", result.MachineID, result.Error)
+			} else if !result.Response.Success {
+				log.Printf("MACHINE_%s: %s", result.MachineID, result.Response.Error)
+			} else if result.Response.Truncated {
+				log.Printf("MACHINE_%s: output stopped at -limit %d", result.MachineID, *limit)
+			}
+		}
+		return
+	}
 
 	// Execute distributed query
-	fmt.Printf("Querying %d servers for pattern: '%s'\n", len(serverConfigs), pattern)
+	fmt.Printf("Querying %d servers for pattern: '%s'\n", len(serverConfigs), searchText)
 	if *options != "" {
 		fmt.Printf("Using grep options: %s\n", *options)
 	}
 
-	start := time.Now()
-	results := client.QueryAllServers(pattern, *options)
-	duration := time.Since(start)
+	// With -limit, fetch one page at a time for as long as the user asks
+	// for more
+	printer := newMatchPrinter("", useColor, *lineNumbers)
+	stdin := bufio.NewReader(os.Stdin)
+	for {
+		start := time.Now()
+		var results []QueryResult
+		if *countOnly {
+			results = client.QueryAllServers(req)
+		} else {
+			// Print matches as they arrive from each server
+			fmt.Println()
+			results = client.StreamAllServers(req, printer.Print)
+		}
+		duration := time.Since(start)
+
+		// Print results
+		client.PrintResults(results, searchText, *countOnly, newMatchPrinter("   ", useColor, *lineNumbers))
+		fmt.Printf("Total query time: %v\n", duration)
 
-	// Print results
-	client.PrintResults(results, pattern, *countOnly)
-	fmt.Printf("Total query time: %v\n", duration)
+		remaining := nextPageServers(serverConfigs, results)
+		if len(remaining) == 0 || !promptMore(stdin, len(remaining)) {
+			return
+		}
+		client = NewLogQueryClient(remaining, *timeout)
+		client.checkHealth = *healthCheck
+		client.creds = creds
+		client.token = token
+	}
+}
+
+// nextPageServers returns the servers whose results were cut short by
+// -limit, each set up to continue from where its page stopped
+func nextPageServers(servers []ServerConfig, results []QueryResult) []ServerConfig {
+	tokens := map[string]string{}
+	for _, result := range results {
+		if result.Response != nil && result.Response.Truncated {
+			tokens[result.MachineID] = result.Response.NextPageToken
+		}
+	}
+
+	var remaining []ServerConfig
+	for _, server := range servers {
+		if token, ok := tokens[server.MachineID]; ok {
+			server.PageToken = token
+			remaining = append(remaining, server)
+		}
+	}
+	return remaining
+}
+
+// promptMore asks whether to fetch the next page. Without a terminal to ask
+// on it just notes that more results exist
+func promptMore(stdin *bufio.Reader, servers int) bool {
+	if !isTerminal(os.Stdin) {
+		fmt.Printf("More matches are available from %d servers; run interactively to page through them\n", servers)
+		return false
+	}
+	fmt.Printf("-- More from %d servers? [Enter to continue, q to quit] ", servers)
+	answer, err := stdin.ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.TrimSpace(answer)
+	return answer == "" || strings.EqualFold(answer, "y") || strings.EqualFold(answer, "more")
 }
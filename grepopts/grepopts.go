@@ -0,0 +1,78 @@
+// Package grepopts translates grep-style option strings given on the client
+// command line into the typed QueryOptions message understood by servers
+package grepopts
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	pb "github.com/sujayx23/g71_test/logquery"
+)
+
+// Parse translates an option string such as "-i -v", "-iE" or "-A 2 -m5"
+// into QueryOptions. Options that servers do not support are rejected here
+// rather than being sent over the wire
+func Parse(options string) (*pb.QueryOptions, error) {
+	opts := &pb.QueryOptions{}
+	fields := strings.Fields(options)
+
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		if len(field) < 2 || field[0] != '-' || field[1] == '-' {
+			return nil, fmt.Errorf("unsupported option %q", field)
+		}
+
+		for j := 1; j < len(field); j++ {
+			flag := field[j]
+			switch flag {
+			case 'i':
+				opts.CaseInsensitive = true
+			case 'v':
+				opts.Invert = true
+			case 'w':
+				opts.WholeWord = true
+			case 'x':
+				opts.WholeLine = true
+			case 'c':
+				opts.CountOnly = true
+			case 'E':
+				opts.RegexFlavor = pb.RegexFlavor_REGEX_FLAVOR_EXTENDED
+			case 'F':
+				opts.RegexFlavor = pb.RegexFlavor_REGEX_FLAVOR_FIXED
+			case 'G':
+				opts.RegexFlavor = pb.RegexFlavor_REGEX_FLAVOR_BASIC
+			case 'm', 'A', 'B', 'C':
+				// Numeric options take the rest of the field or the next one
+				arg := field[j+1:]
+				if arg == "" {
+					if i+1 == len(fields) {
+						return nil, fmt.Errorf("option -%c requires an argument", flag)
+					}
+					i++
+					arg = fields[i]
+				}
+				n, err := strconv.Atoi(arg)
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("invalid argument %q for -%c", arg, flag)
+				}
+				switch flag {
+				case 'm':
+					opts.MaxCount = int32(n)
+				case 'A':
+					opts.AfterContext = int32(n)
+				case 'B':
+					opts.BeforeContext = int32(n)
+				case 'C':
+					opts.BeforeContext = int32(n)
+					opts.AfterContext = int32(n)
+				}
+				j = len(field)
+			default:
+				return nil, fmt.Errorf("unsupported option -%c", flag)
+			}
+		}
+	}
+
+	return opts, nil
+}
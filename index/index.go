@@ -0,0 +1,339 @@
+// Package index maintains trigram indexes of log files, used to skip the
+// parts of a file that cannot contain a match.
+//
+// A file is split into blocks of whole lines. For each block the index
+// keeps a bitmap of the (ASCII case-folded) trigrams occurring in its lines,
+// hashed into a fixed number of bits. A query derived from the search
+// pattern is checked against each bitmap, and only blocks that might match
+// are scanned. Hash collisions can only cause extra blocks to be scanned,
+// never matches to be missed
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sujayx23/g71_test/logsource"
+)
+
+const (
+	// DefaultBlockSize is the target number of bytes of log per block
+	DefaultBlockSize = 256 * 1024
+
+	// bitmapBits is the size of each block's trigram bitmap, in bits
+	bitmapLog  = 16
+	bitmapBits = 1 << bitmapLog
+)
+
+// formatVersion is bumped whenever the on-disk encoding changes
+const formatVersion = 2
+
+// ErrCompressed is returned by Build for compressed files, which cannot be
+// read from an arbitrary offset and so gain nothing from an index
+var ErrCompressed = errors.New("compressed files are not indexed")
+
+// ErrReplaced is returned by Extend when the file is no longer the one that
+// was indexed: it was rotated away, truncated or rewritten
+var ErrReplaced = errors.New("file was replaced or truncated since it was indexed")
+
+// tailSize is how many bytes before the end of the indexed region are kept
+// to check that an append-only file has not been rewritten
+const tailSize = 64
+
+// Index is the trigram index of one log file
+type Index struct {
+	Version int
+	Path    string
+	File    logsource.FileID // identity of the indexed file
+	Size    int64            // size of the file when it was last indexed
+	ModTime time.Time        // modification time of the file when it was last indexed
+
+	// Covered is the number of bytes indexed, which ends at the last
+	// complete line; Lines is the number of lines in them. Tail holds the
+	// bytes just before Covered
+	Covered int64
+	Lines   int
+	Tail    []byte
+
+	Blocks []Block
+}
+
+// Block is a run of whole lines in the file
+type Block struct {
+	Offset int64  // byte offset of the first line
+	Length int64  // length in bytes, including the final newline
+	Line   int    // 1-based number of the first line
+	Bits   []byte // trigram bitmap
+}
+
+// Build reads the file at path and indexes it in blocks of about blockSize
+// bytes
+func Build(path string, blockSize int) (*Index, error) {
+	file, info, err := open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return (&Index{Version: formatVersion, Path: path}).grow(file, info, blockSize)
+}
+
+// Extend returns a copy of the index that also covers the lines appended to
+// the file since it was built, leaving idx itself untouched for queries
+// still using it. It fails with ErrReplaced if the file at the index's path
+// is no longer the file that was indexed
+func (idx *Index) Extend(blockSize int) (*Index, error) {
+	file, info, err := open(idx.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// The file must be the same one, no shorter, and still hold the same
+	// bytes just before the indexed end
+	if !idx.Usable(info) || !idx.tailMatches(file) {
+		return nil, ErrReplaced
+	}
+	return idx.grow(file, info, blockSize)
+}
+
+// tailMatches reports whether r holds the bytes just before Covered that
+// were there when the file was indexed
+func (idx *Index) tailMatches(r io.ReaderAt) bool {
+	tail := make([]byte, len(idx.Tail))
+	_, err := r.ReadAt(tail, idx.Covered-int64(len(tail)))
+	return err == nil && bytes.Equal(tail, idx.Tail)
+}
+
+// open opens an uncompressed file for indexing
+func open(path string) (*os.File, os.FileInfo, error) {
+	compression, err := logsource.DetectCompression(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if compression != logsource.None {
+		return nil, nil, ErrCompressed
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return file, info, nil
+}
+
+// grow returns a copy of idx extended with the lines of file after Covered
+func (idx *Index) grow(file *os.File, info os.FileInfo, blockSize int) (*Index, error) {
+	next := *idx
+	next.File = logsource.Identify(info)
+	next.Size = info.Size()
+	next.ModTime = info.ModTime()
+	// Copy the last block, which may be filled further, so readers of idx
+	// never see it change
+	next.Blocks = append([]Block(nil), idx.Blocks...)
+	if n := len(next.Blocks); n > 0 {
+		next.Blocks[n-1].Bits = append([]byte(nil), next.Blocks[n-1].Bits...)
+	}
+
+	// Only index what was there when we looked; later appends are picked
+	// up by the next extension
+	if _, err := file.Seek(next.Covered, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if err := next.extend(io.LimitReader(file, info.Size()-next.Covered), blockSize); err != nil {
+		return nil, &os.PathError{Op: "index", Path: idx.Path, Err: err}
+	}
+
+	next.Tail = make([]byte, min(tailSize, next.Covered))
+	if _, err := file.ReadAt(next.Tail, next.Covered-int64(len(next.Tail))); err != nil {
+		return nil, &os.PathError{Op: "index", Path: idx.Path, Err: err}
+	}
+	return &next, nil
+}
+
+// extend indexes the complete lines read from r, which must continue the
+// file from Covered. Lines are added to the last block until it reaches
+// blockSize
+func (idx *Index) extend(r io.Reader, blockSize int) error {
+	reader := bufio.NewReaderSize(r, 64*1024)
+	var current *Block
+	if n := len(idx.Blocks); n > 0 && idx.Blocks[n-1].Length < int64(blockSize) {
+		current = &idx.Blocks[n-1]
+	}
+	var line []byte
+
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			line = append(line, chunk...)
+			continue
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if err == io.EOF {
+			// A trailing partial line is left for a later extend
+			return nil
+		}
+		if len(line) > 0 {
+			chunk = append(line, chunk...)
+			line = line[:0]
+		}
+
+		if current == nil {
+			idx.Blocks = append(idx.Blocks, Block{
+				Offset: idx.Covered,
+				Line:   idx.Lines + 1,
+				Bits:   make([]byte, bitmapBits/8),
+			})
+			current = &idx.Blocks[len(idx.Blocks)-1]
+		}
+		addTrigrams(current.Bits, bytes.TrimSuffix(chunk, []byte{'\n'}))
+		current.Length += int64(len(chunk))
+		idx.Covered += int64(len(chunk))
+		idx.Lines++
+
+		if current.Length >= int64(blockSize) {
+			current = nil
+		}
+	}
+}
+
+// Usable reports whether the index applies to the file with info. The file
+// may have grown since, in which case only the first Covered bytes are
+// indexed and the rest must be scanned in full. It only looks at info;
+// Current also checks the file's contents
+func (idx *Index) Usable(info os.FileInfo) bool {
+	return logsource.Identify(info) == idx.File && info.Size() >= idx.Size
+}
+
+// Current reports whether the index still describes the file with info,
+// read through r. Besides being Usable, a file of the indexed size must not
+// have been modified since, and the bytes just before Covered must be
+// unchanged, which catches a file truncated in place and grown back past
+// its indexed size
+func (idx *Index) Current(info os.FileInfo, r io.ReaderAt) bool {
+	if !idx.Usable(info) {
+		return false
+	}
+	if info.Size() == idx.Size && !info.ModTime().Equal(idx.ModTime) {
+		return false
+	}
+	return idx.tailMatches(r)
+}
+
+// Candidates returns the blocks that may contain a line satisfying q
+func (idx *Index) Candidates(q *Query) []Block {
+	var blocks []Block
+	for _, block := range idx.Blocks {
+		if q.matches(block.Bits) {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+func (q *Query) matches(bits []byte) bool {
+	switch q.Op {
+	case QAnd:
+		for _, t := range q.Trigrams {
+			if !hasTrigram(bits, t) {
+				return false
+			}
+		}
+		for _, sub := range q.Sub {
+			if !sub.matches(bits) {
+				return false
+			}
+		}
+		return true
+	case QOr:
+		for _, t := range q.Trigrams {
+			if hasTrigram(bits, t) {
+				return true
+			}
+		}
+		for _, sub := range q.Sub {
+			if sub.matches(bits) {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+// addTrigrams sets the bits of every trigram in line
+func addTrigrams(bits []byte, line []byte) {
+	if len(line) < 3 {
+		return
+	}
+	t := uint32(lower(line[0]))<<8 | uint32(lower(line[1]))
+	for i := 2; i < len(line); i++ {
+		t = (t<<8 | uint32(lower(line[i]))) & 0xffffff
+		bit := hashTrigram(t)
+		bits[bit/8] |= 1 << (bit % 8)
+	}
+}
+
+func hasTrigram(bits []byte, trigram string) bool {
+	bit := hashTrigram(uint32(trigram[0])<<16 | uint32(trigram[1])<<8 | uint32(trigram[2]))
+	return bits[bit/8]&(1<<(bit%8)) != 0
+}
+
+// hashTrigram maps a trigram to a bitmap position by multiplicative hashing
+func hashTrigram(t uint32) uint32 {
+	return (t * 2654435761) >> (32 - bitmapLog)
+}
+
+// Save writes the index to path, replacing any existing file atomically
+func (idx *Index) Save(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	if err := gob.NewEncoder(writer).Encode(idx); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load reads an index written by Save
+func Load(path string) (*Index, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	idx := &Index{}
+	if err := gob.NewDecoder(bufio.NewReader(file)).Decode(idx); err != nil {
+		return nil, fmt.Errorf("reading index %s: %v", path, err)
+	}
+	if idx.Version != formatVersion {
+		return nil, fmt.Errorf("index %s has format version %d, want %d", path, idx.Version, formatVersion)
+	}
+	return idx, nil
+}
@@ -0,0 +1,138 @@
+package index
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Manager keeps the indexes of a set of log files, persisted in a directory
+// and cached in memory. It tracks each file as it grows, extending the index
+// over appended lines and rebuilding it when the file is rotated or truncated
+type Manager struct {
+	dir       string
+	blockSize int
+
+	mu    sync.Mutex
+	files map[string]*tracked
+}
+
+// NewManager creates a manager storing indexes in the existing directory
+// dir, in blocks of blockSize bytes or DefaultBlockSize if it is zero
+func NewManager(dir string, blockSize int) *Manager {
+	if blockSize <= 0 {
+		blockSize = DefaultBlockSize
+	}
+	return &Manager{dir: dir, blockSize: blockSize, files: map[string]*tracked{}}
+}
+
+// Lookup returns the index of path if there is one that is current for the
+// file described by info and read through r, loading it from disk on first
+// use. The file may extend past the indexed region. A stale index is not
+// returned, so that the file is scanned in full until the next Refresh
+func (m *Manager) Lookup(path string, info os.FileInfo, r io.ReaderAt) *Index {
+	m.mu.Lock()
+	idx := m.track(path).idx
+	m.mu.Unlock()
+	if idx == nil || !idx.Current(info, r) {
+		return nil
+	}
+	return idx
+}
+
+// Refresh brings the index of every file in paths up to date: files not
+// indexed yet are indexed, files that grew have their new lines added, and
+// files that were rotated or truncated are indexed afresh. Compressed files
+// are skipped
+func (m *Manager) Refresh(paths []string) {
+	for _, path := range paths {
+		m.refresh(path)
+	}
+}
+
+func (m *Manager) refresh(path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	m.mu.Lock()
+	t := m.track(path)
+	idx := t.idx
+	m.mu.Unlock()
+	if idx != nil && idx.Usable(info) && info.Size() == idx.Size && info.ModTime().Equal(idx.ModTime) {
+		return
+	}
+
+	var next *Index
+	replaced := idx != nil && !idx.Usable(info)
+	if idx != nil && !replaced {
+		next, err = idx.Extend(m.blockSize)
+		replaced = errors.Is(err, ErrReplaced)
+	}
+	if replaced {
+		log.Printf("Index of %s discarded: the file was rotated or truncated", path)
+	}
+	if idx == nil || replaced {
+		next, err = Build(path, m.blockSize)
+	}
+	if err == nil {
+		if err := next.Save(m.indexPath(path)); err != nil {
+			log.Printf("Saving index of %s failed: %v", path, err)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if replaced {
+		t.idx = nil
+		t.rebuilds++
+	}
+	t.compressed = errors.Is(err, ErrCompressed)
+	if err != nil {
+		if !t.compressed {
+			t.err = err
+			log.Printf("Indexing %s failed: %v", path, err)
+		}
+		return
+	}
+	t.idx, t.updated, t.err = next, time.Now(), nil
+
+	if idx == nil || replaced {
+		log.Printf("Indexed %s: %d bytes in %d blocks", path, next.Covered, len(next.Blocks))
+	} else if next.Covered > idx.Covered {
+		log.Printf("Extended index of %s by %d bytes to %d", path, next.Covered-idx.Covered, next.Covered)
+	}
+}
+
+// track returns what is known about path, looking for an index saved on
+// disk the first time. m.mu must be held
+func (m *Manager) track(path string) *tracked {
+	if t, ok := m.files[path]; ok {
+		return t
+	}
+	// A miss is remembered too, so the disk is not consulted on every query
+	t := &tracked{}
+	m.files[path] = t
+	if idx, err := Load(m.indexPath(path)); err == nil && idx.Path == path {
+		t.idx = idx
+		if info, err := os.Stat(m.indexPath(path)); err == nil {
+			t.updated = info.ModTime()
+		}
+	}
+	return t
+}
+
+// indexPath names the file holding the index of path
+func (m *Manager) indexPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	sum := sha256.Sum256([]byte(path))
+	return filepath.Join(m.dir, hex.EncodeToString(sum[:8])+".idx")
+}
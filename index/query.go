@@ -0,0 +1,272 @@
+package index
+
+import (
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// QueryOp is the kind of a Query node
+type QueryOp int
+
+const (
+	// QAll is satisfied by every block; the pattern cannot be narrowed down
+	QAll QueryOp = iota
+	// QAnd requires all of Trigrams and all of Sub
+	QAnd
+	// QOr requires any of Trigrams or any of Sub
+	QOr
+)
+
+// Query is a boolean condition on the trigrams a block must contain for a
+// match to be possible in it. Trigrams are ASCII-lowercased, as in the index
+type Query struct {
+	Op       QueryOp
+	Trigrams []string
+	Sub      []*Query
+}
+
+// All returns the query satisfied by every block
+func All() *Query {
+	return &Query{Op: QAll}
+}
+
+// IsAll reports whether q cannot prune any block
+func (q *Query) IsAll() bool {
+	return q.Op == QAll
+}
+
+// And returns a query requiring all of qs
+func And(qs ...*Query) *Query {
+	return combine(QAnd, qs)
+}
+
+// Or returns a query requiring any of qs
+func Or(qs ...*Query) *Query {
+	return combine(QOr, qs)
+}
+
+func combine(op QueryOp, qs []*Query) *Query {
+	result := &Query{Op: op}
+	for _, q := range qs {
+		switch {
+		case q.Op == QAll && op == QAnd:
+			// Always true; contributes nothing
+		case q.Op == QAll:
+			// Anything OR true is true
+			return All()
+		case q.Op == op:
+			result.Trigrams = append(result.Trigrams, q.Trigrams...)
+			result.Sub = append(result.Sub, q.Sub...)
+		default:
+			result.Sub = append(result.Sub, q)
+		}
+	}
+	if len(result.Trigrams) == 0 && len(result.Sub) == 0 {
+		return All()
+	}
+	if len(result.Trigrams) == 0 && len(result.Sub) == 1 {
+		return result.Sub[0]
+	}
+	return result
+}
+
+// Literal returns the query for a string that must appear in a matching
+// line: all of its trigrams
+func Literal(s string) *Query {
+	s = foldASCII(s)
+	if len(s) < 3 {
+		return All()
+	}
+	q := &Query{Op: QAnd}
+	seen := map[string]bool{}
+	for i := 0; i+3 <= len(s); i++ {
+		if t := s[i : i+3]; !seen[t] {
+			seen[t] = true
+			q.Trigrams = append(q.Trigrams, t)
+		}
+	}
+	sort.Strings(q.Trigrams)
+	return q
+}
+
+func (q *Query) String() string {
+	if q.Op == QAll {
+		return "+"
+	}
+	var parts []string
+	for _, t := range q.Trigrams {
+		parts = append(parts, "'"+t+"'")
+	}
+	for _, sub := range q.Sub {
+		parts = append(parts, "("+sub.String()+")")
+	}
+	sep := " "
+	if q.Op == QOr {
+		sep = " | "
+	}
+	return strings.Join(parts, sep)
+}
+
+// RegexpQuery derives the trigram query for a Go regular expression, as
+// used by the matching engine. Constructs it cannot see through, such as
+// repetition or large character classes, simply contribute nothing, so the
+// result may be All
+func RegexpQuery(expr string) (*Query, error) {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+	return analyze(re.Simplify()).query(), nil
+}
+
+// maxExact bounds the number of alternative strings tracked for a node
+// before falling back to the trigrams they require
+const maxExact = 16
+
+// info summarizes what a regexp node can match: either the exact set of
+// strings, when small, or a query every match satisfies
+type info struct {
+	exact []string
+	match *Query
+}
+
+func anything() info {
+	return info{match: All()}
+}
+
+func (i info) query() *Query {
+	if i.exact == nil {
+		return i.match
+	}
+	qs := make([]*Query, 0, len(i.exact))
+	for _, s := range i.exact {
+		qs = append(qs, Literal(s))
+	}
+	return Or(qs...)
+}
+
+func analyze(re *syntax.Regexp) info {
+	switch re.Op {
+	case syntax.OpEmptyMatch, syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText,
+		syntax.OpEndText, syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		return info{exact: []string{""}}
+	case syntax.OpLiteral:
+		s := string(re.Rune)
+		if re.Flags&syntax.FoldCase == 0 {
+			return info{exact: []string{foldASCII(s)}}
+		}
+		if !isASCII(s) {
+			// Unicode case folding can change the bytes of the match
+			return anything()
+		}
+		// Case-insensitive k and s also match the Kelvin and long s signs,
+		// which are not ASCII, so only the text between them is required
+		var parts []*Query
+		for _, part := range strings.FieldsFunc(foldASCII(s), func(r rune) bool { return r == 'k' || r == 's' }) {
+			parts = append(parts, Literal(part))
+		}
+		if !strings.ContainsAny(foldASCII(s), "ks") {
+			return info{exact: []string{foldASCII(s)}}
+		}
+		return info{match: And(parts...)}
+	case syntax.OpCharClass:
+		return analyzeClass(re)
+	case syntax.OpCapture:
+		return analyze(re.Sub[0])
+	case syntax.OpPlus:
+		return info{match: analyze(re.Sub[0]).query()}
+	case syntax.OpRepeat:
+		if re.Min == 0 {
+			return anything()
+		}
+		return info{match: analyze(re.Sub[0]).query()}
+	case syntax.OpConcat:
+		result := info{exact: []string{""}}
+		for _, sub := range re.Sub {
+			result = concat(result, analyze(sub))
+		}
+		return result
+	case syntax.OpAlternate:
+		result := analyze(re.Sub[0])
+		for _, sub := range re.Sub[1:] {
+			result = alternate(result, analyze(sub))
+		}
+		return result
+	default:
+		// Any character, optional or repeated parts, and no-match
+		return anything()
+	}
+}
+
+// analyzeClass enumerates small character classes such as [Tt]
+func analyzeClass(re *syntax.Regexp) info {
+	var exact []string
+	seen := map[string]bool{}
+	for i := 0; i+1 < len(re.Rune); i += 2 {
+		lo, hi := re.Rune[i], re.Rune[i+1]
+		if hi-lo >= maxExact || hi >= utf8.RuneSelf {
+			return anything()
+		}
+		for r := lo; r <= hi; r++ {
+			s := foldASCII(string(r))
+			if !seen[s] {
+				seen[s] = true
+				exact = append(exact, s)
+			}
+		}
+		if len(exact) > maxExact {
+			return anything()
+		}
+	}
+	if len(exact) == 0 {
+		return anything()
+	}
+	return info{exact: exact}
+}
+
+func concat(a, b info) info {
+	if a.exact != nil && b.exact != nil && len(a.exact)*len(b.exact) <= maxExact {
+		exact := make([]string, 0, len(a.exact)*len(b.exact))
+		for _, x := range a.exact {
+			for _, y := range b.exact {
+				exact = append(exact, x+y)
+			}
+		}
+		return info{exact: exact}
+	}
+	return info{match: And(a.query(), b.query())}
+}
+
+func alternate(a, b info) info {
+	if a.exact != nil && b.exact != nil && len(a.exact)+len(b.exact) <= maxExact {
+		return info{exact: append(append([]string{}, a.exact...), b.exact...)}
+	}
+	return info{match: Or(a.query(), b.query())}
+}
+
+// foldASCII lowercases ASCII letters only, so byte offsets are unchanged
+func foldASCII(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		b[i] = lower(c)
+	}
+	return string(b)
+}
+
+func lower(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,107 @@
+package index
+
+import (
+	"os"
+	"time"
+)
+
+// tracked is what a Manager knows about one log file
+type tracked struct {
+	idx        *Index    // nil until the file is first indexed
+	updated    time.Time // when idx was last built or extended
+	rebuilds   int       // times idx was discarded after rotation or truncation
+	compressed bool      // the file cannot be indexed
+	err        error     // the last indexing failure, if any
+}
+
+// State summarizes how an index relates to its file
+type State int
+
+const (
+	// Missing means the file has not been indexed yet
+	Missing State = iota
+	// Current means the index covers every complete line of the file
+	Current
+	// Behind means lines were appended since the file was indexed; queries
+	// scan them in full until the next refresh
+	Behind
+	// Stale means the file was rotated or truncated, and the index is
+	// ignored until it is rebuilt
+	Stale
+	// Unsupported means the file is compressed and is never indexed
+	Unsupported
+)
+
+func (s State) String() string {
+	switch s {
+	case Current:
+		return "current"
+	case Behind:
+		return "behind"
+	case Stale:
+		return "stale"
+	case Unsupported:
+		return "unsupported"
+	default:
+		return "missing"
+	}
+}
+
+// Status describes the index of one file
+type Status struct {
+	Path     string
+	State    State
+	Size     int64     // current size of the file
+	Covered  int64     // bytes covered by the index
+	Blocks   int       // number of index blocks
+	Updated  time.Time // when the index was last built or extended
+	Rebuilds int       // times the index was discarded after rotation or truncation
+	Err      error     // the last indexing failure, if any
+}
+
+// Lag returns the number of bytes in the file past the indexed region. It
+// includes a trailing partial line, which is not indexed until completed
+func (s Status) Lag() int64 {
+	if s.State != Current && s.State != Behind {
+		return 0
+	}
+	return max(s.Size-s.Covered, 0)
+}
+
+// Status reports the state of the index of every file in paths, compared
+// with the file as it is now
+func (m *Manager) Status(paths []string) []Status {
+	statuses := make([]Status, 0, len(paths))
+	for _, path := range paths {
+		info, statErr := os.Stat(path)
+
+		m.mu.Lock()
+		t := m.track(path)
+		s := Status{Path: path, Updated: t.updated, Rebuilds: t.rebuilds, Err: t.err}
+		idx, compressed := t.idx, t.compressed
+		m.mu.Unlock()
+
+		if statErr != nil {
+			s.Err = statErr
+		} else {
+			s.Size = info.Size()
+		}
+		if idx != nil {
+			s.Covered, s.Blocks = idx.Covered, len(idx.Blocks)
+		}
+		switch {
+		case compressed:
+			s.State = Unsupported
+		case idx == nil:
+			s.State = Missing
+		case statErr != nil || !idx.Usable(info):
+			s.State = Stale
+		case info.Size() > idx.Size:
+			s.State = Behind
+		default:
+			s.State = Current
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses
+}
@@ -0,0 +1,187 @@
+package logparse
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Record is a log line broken into its parts
+type Record struct {
+	Timestamp time.Time // zero if the line has no timestamp
+	Level     string    // upper-cased severity, empty if none was found
+	Message   string    // text following the level
+	Raw       string    // the original line
+}
+
+// Parser breaks raw log lines into records
+type Parser interface {
+	// Parse returns the record for line. Lines the parser does not
+	// understand still yield a record holding the raw text as the message
+	Parse(line []byte) Record
+	// Level returns just the record's level, without building the record
+	Level(line []byte) string
+}
+
+// Factory creates a parser for lines whose timestamps follow layout
+type Factory func(timestamps *TimestampParser) Parser
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+// DefaultParser is the name of the parser used when none is configured
+const DefaultParser = "standard"
+
+func init() {
+	Register(DefaultParser, func(timestamps *TimestampParser) Parser {
+		return &StandardParser{timestamps: timestamps}
+	})
+}
+
+// Register makes a parser available under name, replacing any parser
+// previously registered with that name
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = factory
+}
+
+// NewParser creates the parser registered under name
+func NewParser(name string, timestamps *TimestampParser) (Parser, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown log parser %q (available: %s)", name, strings.Join(Parsers(), ", "))
+	}
+	return factory(timestamps), nil
+}
+
+// Parsers returns the names of all registered parsers
+func Parsers() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Severity is a normalized log level, ordered from least to most severe
+type Severity int
+
+const (
+	// SeverityUnknown is the severity of lines without a recognized level
+	SeverityUnknown Severity = iota
+	SeverityDebug
+	SeverityInfo
+	SeverityWarn
+	SeverityError
+	SeverityCritical
+)
+
+// String returns the canonical level name for the severity
+func (s Severity) String() string {
+	switch s {
+	case SeverityDebug:
+		return "DEBUG"
+	case SeverityInfo:
+		return "INFO"
+	case SeverityWarn:
+		return "WARN"
+	case SeverityError:
+		return "ERROR"
+	case SeverityCritical:
+		return "CRITICAL"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// knownLevels maps the severity words StandardParser recognizes after the
+// timestamp to their normalized severity. Anything else is treated as the
+// start of the message
+var knownLevels = map[string]Severity{
+	"TRACE": SeverityDebug, "DEBUG": SeverityDebug,
+	"INFO": SeverityInfo, "NOTICE": SeverityInfo,
+	"WARN": SeverityWarn, "WARNING": SeverityWarn,
+	"ERROR": SeverityError, "ERR": SeverityError,
+	"CRITICAL": SeverityCritical, "CRIT": SeverityCritical, "FATAL": SeverityCritical,
+	"ALERT": SeverityCritical, "EMERG": SeverityCritical, "EMERGENCY": SeverityCritical,
+	"PANIC": SeverityCritical,
+}
+
+// ParseSeverity normalizes a level word such as "warning" or "FATAL"
+func ParseSeverity(level string) Severity {
+	if severity, ok := knownLevels[level]; ok {
+		return severity
+	}
+	return knownLevels[strings.ToUpper(level)]
+}
+
+// StandardParser parses lines of the form "<timestamp> <LEVEL>: <message>",
+// also accepting "[LEVEL]" and a level without the colon
+type StandardParser struct {
+	timestamps *TimestampParser
+}
+
+// Parse implements Parser
+func (p *StandardParser) Parse(line []byte) Record {
+	record := Record{Raw: string(line)}
+
+	rest := line
+	if t, n, ok := p.timestamps.ParsePrefix(line); ok {
+		record.Timestamp = t
+		rest = line[n:]
+	}
+
+	level, rest := splitLevel(rest)
+	record.Level = level
+	record.Message = string(rest)
+	return record
+}
+
+// Level implements Parser
+func (p *StandardParser) Level(line []byte) string {
+	rest := line
+	if _, n, ok := p.timestamps.ParsePrefix(line); ok {
+		rest = line[n:]
+	}
+	level, _ := splitLevel(rest)
+	return level
+}
+
+// splitLevel splits a recognized level word, possibly bracketed or followed
+// by a colon, off the front of rest. The level is returned upper-cased, or
+// empty if rest does not start with one
+func splitLevel(rest []byte) (string, []byte) {
+	rest = bytes.TrimLeft(rest, " \t")
+
+	end := bytes.IndexAny(rest, " \t")
+	if end < 0 {
+		end = len(rest)
+	}
+	word := rest[:end]
+	word = bytes.TrimSuffix(word, []byte(":"))
+	word = bytes.TrimSuffix(bytes.TrimPrefix(word, []byte("[")), []byte("]"))
+	word = bytes.TrimSuffix(word, []byte(":"))
+
+	// Most logs use upper case, which needs no allocation to look up
+	level := ""
+	if _, ok := knownLevels[string(word)]; ok {
+		level = string(word)
+	} else if upper := strings.ToUpper(string(word)); knownLevels[upper] != SeverityUnknown {
+		level = upper
+	}
+	if level == "" {
+		return "", rest
+	}
+	return level, bytes.TrimLeft(rest[end:], " \t")
+}
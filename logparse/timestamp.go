@@ -0,0 +1,91 @@
+// Package logparse extracts structure, such as the leading timestamp, from
+// raw log lines
+package logparse
+
+import (
+	"strings"
+	"time"
+)
+
+// DefaultTimestampLayout is the layout of the timestamp that starts every
+// line of the vm*.log files, e.g. "2024-01-15 10:30:15"
+const DefaultTimestampLayout = "2006-01-02 15:04:05"
+
+// TimestampParser reads the timestamp at the start of a log line
+type TimestampParser struct {
+	layout   string
+	fields   int
+	location *time.Location
+}
+
+// NewTimestampParser creates a parser for timestamps in the given Go time
+// layout. Timestamps without a zone are interpreted in loc
+func NewTimestampParser(layout string, loc *time.Location) *TimestampParser {
+	if layout == "" {
+		layout = DefaultTimestampLayout
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+	return &TimestampParser{
+		layout:   layout,
+		fields:   len(strings.Fields(layout)),
+		location: loc,
+	}
+}
+
+// Layout returns the time layout the parser expects
+func (p *TimestampParser) Layout() string {
+	return p.layout
+}
+
+// Parse returns the timestamp at the start of line. It reports false for
+// lines that do not start with a timestamp, such as stack trace continuations
+func (p *TimestampParser) Parse(line []byte) (time.Time, bool) {
+	t, _, ok := p.ParsePrefix(line)
+	return t, ok
+}
+
+// ParsePrefix is like Parse but also returns the number of bytes the
+// timestamp occupies at the start of line
+func (p *TimestampParser) ParsePrefix(line []byte) (time.Time, int, bool) {
+	// Fast path: fixed-width layouts occupy exactly len(layout) bytes
+	if len(line) >= len(p.layout) {
+		if t, err := time.ParseInLocation(p.layout, string(line[:len(p.layout)]), p.location); err == nil {
+			return t, len(p.layout), true
+		}
+	}
+
+	// Variable-width layouts (fractional seconds, zone names) are matched
+	// by taking as many whitespace-separated fields as the layout has
+	prefix, end, ok := leadingFields(line, p.fields)
+	if !ok {
+		return time.Time{}, 0, false
+	}
+	t, err := time.ParseInLocation(p.layout, prefix, p.location)
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+	return t, end, true
+}
+
+// leadingFields returns the first n space-separated fields of line joined by
+// single spaces, and the offset just past the last of them
+func leadingFields(line []byte, n int) (string, int, bool) {
+	fields := make([]string, 0, n)
+	i := 0
+	for len(fields) < n {
+		for i < len(line) && line[i] == ' ' {
+			i++
+		}
+		start := i
+		for i < len(line) && line[i] != ' ' && line[i] != '\t' {
+			i++
+		}
+		if start == i {
+			return "", 0, false
+		}
+		fields = append(fields, string(line[start:i]))
+	}
+	return strings.Join(fields, " "), i, true
+}
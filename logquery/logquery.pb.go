@@ -9,6 +9,8 @@ package logquery
 import (
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
 	reflect "reflect"
 	sync "sync"
 	unsafe "unsafe"
@@ -21,14 +23,246 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+// Severity of a log line, in increasing order
+type Level int32
+
+const (
+	Level_LEVEL_UNSPECIFIED Level = 0 // No level filter
+	Level_LEVEL_DEBUG       Level = 1 // DEBUG, TRACE
+	Level_LEVEL_INFO        Level = 2 // INFO, NOTICE
+	Level_LEVEL_WARN        Level = 3 // WARN, WARNING
+	Level_LEVEL_ERROR       Level = 4 // ERROR, ERR
+	Level_LEVEL_CRITICAL    Level = 5 // CRITICAL, CRIT, FATAL, ALERT, EMERG, PANIC
+)
+
+// Enum value maps for Level.
+var (
+	Level_name = map[int32]string{
+		0: "LEVEL_UNSPECIFIED",
+		1: "LEVEL_DEBUG",
+		2: "LEVEL_INFO",
+		3: "LEVEL_WARN",
+		4: "LEVEL_ERROR",
+		5: "LEVEL_CRITICAL",
+	}
+	Level_value = map[string]int32{
+		"LEVEL_UNSPECIFIED": 0,
+		"LEVEL_DEBUG":       1,
+		"LEVEL_INFO":        2,
+		"LEVEL_WARN":        3,
+		"LEVEL_ERROR":       4,
+		"LEVEL_CRITICAL":    5,
+	}
+)
+
+func (x Level) Enum() *Level {
+	p := new(Level)
+	*p = x
+	return p
+}
+
+func (x Level) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Level) Descriptor() protoreflect.EnumDescriptor {
+	return file_logquery_proto_enumTypes[0].Descriptor()
+}
+
+func (Level) Type() protoreflect.EnumType {
+	return &file_logquery_proto_enumTypes[0]
+}
+
+func (x Level) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Level.Descriptor instead.
+func (Level) EnumDescriptor() ([]byte, []int) {
+	return file_logquery_proto_rawDescGZIP(), []int{0}
+}
+
+// Pattern syntax used to interpret QueryRequest.pattern
+type RegexFlavor int32
+
+const (
+	RegexFlavor_REGEX_FLAVOR_BASIC    RegexFlavor = 0 // POSIX basic regular expression (grep -G)
+	RegexFlavor_REGEX_FLAVOR_EXTENDED RegexFlavor = 1 // POSIX extended regular expression (grep -E)
+	RegexFlavor_REGEX_FLAVOR_FIXED    RegexFlavor = 2 // Literal string (grep -F)
+)
+
+// Enum value maps for RegexFlavor.
+var (
+	RegexFlavor_name = map[int32]string{
+		0: "REGEX_FLAVOR_BASIC",
+		1: "REGEX_FLAVOR_EXTENDED",
+		2: "REGEX_FLAVOR_FIXED",
+	}
+	RegexFlavor_value = map[string]int32{
+		"REGEX_FLAVOR_BASIC":    0,
+		"REGEX_FLAVOR_EXTENDED": 1,
+		"REGEX_FLAVOR_FIXED":    2,
+	}
+)
+
+func (x RegexFlavor) Enum() *RegexFlavor {
+	p := new(RegexFlavor)
+	*p = x
+	return p
+}
+
+func (x RegexFlavor) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (RegexFlavor) Descriptor() protoreflect.EnumDescriptor {
+	return file_logquery_proto_enumTypes[1].Descriptor()
+}
+
+func (RegexFlavor) Type() protoreflect.EnumType {
+	return &file_logquery_proto_enumTypes[1]
+}
+
+func (x RegexFlavor) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use RegexFlavor.Descriptor instead.
+func (RegexFlavor) EnumDescriptor() ([]byte, []int) {
+	return file_logquery_proto_rawDescGZIP(), []int{1}
+}
+
+// How well the trigram index of one file covers it
+type IndexState int32
+
+const (
+	IndexState_INDEX_STATE_UNSPECIFIED IndexState = 0
+	IndexState_INDEX_STATE_MISSING     IndexState = 1 // Not indexed yet
+	IndexState_INDEX_STATE_CURRENT     IndexState = 2 // Covers every complete line
+	IndexState_INDEX_STATE_BEHIND      IndexState = 3 // The file has grown since; the rest is scanned in full
+	IndexState_INDEX_STATE_STALE       IndexState = 4 // The file was rotated or truncated; unused until rebuilt
+	IndexState_INDEX_STATE_UNSUPPORTED IndexState = 5 // Compressed files are not indexed
+)
+
+// Enum value maps for IndexState.
+var (
+	IndexState_name = map[int32]string{
+		0: "INDEX_STATE_UNSPECIFIED",
+		1: "INDEX_STATE_MISSING",
+		2: "INDEX_STATE_CURRENT",
+		3: "INDEX_STATE_BEHIND",
+		4: "INDEX_STATE_STALE",
+		5: "INDEX_STATE_UNSUPPORTED",
+	}
+	IndexState_value = map[string]int32{
+		"INDEX_STATE_UNSPECIFIED": 0,
+		"INDEX_STATE_MISSING":     1,
+		"INDEX_STATE_CURRENT":     2,
+		"INDEX_STATE_BEHIND":      3,
+		"INDEX_STATE_STALE":       4,
+		"INDEX_STATE_UNSUPPORTED": 5,
+	}
+)
+
+func (x IndexState) Enum() *IndexState {
+	p := new(IndexState)
+	*p = x
+	return p
+}
+
+func (x IndexState) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (IndexState) Descriptor() protoreflect.EnumDescriptor {
+	return file_logquery_proto_enumTypes[2].Descriptor()
+}
+
+func (IndexState) Type() protoreflect.EnumType {
+	return &file_logquery_proto_enumTypes[2]
+}
+
+func (x IndexState) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use IndexState.Descriptor instead.
+func (IndexState) EnumDescriptor() ([]byte, []int) {
+	return file_logquery_proto_rawDescGZIP(), []int{2}
+}
+
+// How a log file is stored on disk
+type Compression int32
+
+const (
+	Compression_COMPRESSION_NONE  Compression = 0 // Plain text
+	Compression_COMPRESSION_GZIP  Compression = 1
+	Compression_COMPRESSION_BZIP2 Compression = 2
+)
+
+// Enum value maps for Compression.
+var (
+	Compression_name = map[int32]string{
+		0: "COMPRESSION_NONE",
+		1: "COMPRESSION_GZIP",
+		2: "COMPRESSION_BZIP2",
+	}
+	Compression_value = map[string]int32{
+		"COMPRESSION_NONE":  0,
+		"COMPRESSION_GZIP":  1,
+		"COMPRESSION_BZIP2": 2,
+	}
+)
+
+func (x Compression) Enum() *Compression {
+	p := new(Compression)
+	*p = x
+	return p
+}
+
+func (x Compression) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Compression) Descriptor() protoreflect.EnumDescriptor {
+	return file_logquery_proto_enumTypes[3].Descriptor()
+}
+
+func (Compression) Type() protoreflect.EnumType {
+	return &file_logquery_proto_enumTypes[3]
+}
+
+func (x Compression) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Compression.Descriptor instead.
+func (Compression) EnumDescriptor() ([]byte, []int) {
+	return file_logquery_proto_rawDescGZIP(), []int{3}
+}
+
 // Request message containing grep pattern and options
 type QueryRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Pattern       string                 `protobuf:"bytes,1,opt,name=pattern,proto3" json:"pattern,omitempty"`                      // The grep pattern to search for
-	Options       string                 `protobuf:"bytes,2,opt,name=options,proto3" json:"options,omitempty"`                      // Grep options (e.g., "-i", "-E", "-v")
-	MachineId     string                 `protobuf:"bytes,3,opt,name=machine_id,json=machineId,proto3" json:"machine_id,omitempty"` // Machine identifier for logging
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Pattern string                 `protobuf:"bytes,1,opt,name=pattern,proto3" json:"pattern,omitempty"` // The grep pattern to search for
+	// Deprecated: Marked as deprecated in logquery.proto.
+	Options         string                 `protobuf:"bytes,2,opt,name=options,proto3" json:"options,omitempty"`                                         // Raw grep options; rejected, use query_options
+	MachineId       string                 `protobuf:"bytes,3,opt,name=machine_id,json=machineId,proto3" json:"machine_id,omitempty"`                    // Machine identifier for logging
+	QueryOptions    *QueryOptions          `protobuf:"bytes,4,opt,name=query_options,json=queryOptions,proto3" json:"query_options,omitempty"`           // Typed search options
+	FileFilter      string                 `protobuf:"bytes,5,opt,name=file_filter,json=fileFilter,proto3" json:"file_filter,omitempty"`                 // Optional glob restricting which log files are searched
+	IncludeRotated  bool                   `protobuf:"varint,6,opt,name=include_rotated,json=includeRotated,proto3" json:"include_rotated,omitempty"`    // Also search rotated copies (.1, .2.gz, ...) oldest first
+	Since           *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=since,proto3" json:"since,omitempty"`                                             // Only select lines logged at or after this time
+	Until           *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=until,proto3" json:"until,omitempty"`                                             // Only select lines logged before this time
+	TimestampLayout string                 `protobuf:"bytes,9,opt,name=timestamp_layout,json=timestampLayout,proto3" json:"timestamp_layout,omitempty"`  // Go time layout of each line's leading timestamp (default "2006-01-02 15:04:05")
+	ParseRecords    bool                   `protobuf:"varint,10,opt,name=parse_records,json=parseRecords,proto3" json:"parse_records,omitempty"`         // Return each match parsed into a LogRecord
+	MinLevel        Level                  `protobuf:"varint,11,opt,name=min_level,json=minLevel,proto3,enum=logquery.Level" json:"min_level,omitempty"` // Only select lines at this level or above
+	Levels          []Level                `protobuf:"varint,12,rep,packed,name=levels,proto3,enum=logquery.Level" json:"levels,omitempty"`              // Only select lines at one of these levels; exclusive with min_level
+	Query           string                 `protobuf:"bytes,13,opt,name=query,proto3" json:"query,omitempty"`                                            // Boolean expression such as `ERROR AND (db OR "conn pool") NOT /time.?out/`; exclusive with pattern
+	MaxResults      int32                  `protobuf:"varint,14,opt,name=max_results,json=maxResults,proto3" json:"max_results,omitempty"`               // Return at most this many matches per page, 0 for no limit; ignored with count_only
+	PageToken       string                 `protobuf:"bytes,15,opt,name=page_token,json=pageToken,proto3" json:"page_token,omitempty"`                   // next_page_token from the previous page, to continue where it stopped; valid until the server restarts
+	Extract         string                 `protobuf:"bytes,16,opt,name=extract,proto3" json:"extract,omitempty"`                                        // Go regular expression whose named groups, e.g. `user_(?P<uid>[0-9]+)`, are returned as fields of each match
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
 }
 
 func (x *QueryRequest) Reset() {
@@ -68,6 +302,7 @@ func (x *QueryRequest) GetPattern() string {
 	return ""
 }
 
+// Deprecated: Marked as deprecated in logquery.proto.
 func (x *QueryRequest) GetOptions() string {
 	if x != nil {
 		return x.Options
@@ -82,22 +317,227 @@ func (x *QueryRequest) GetMachineId() string {
 	return ""
 }
 
+func (x *QueryRequest) GetQueryOptions() *QueryOptions {
+	if x != nil {
+		return x.QueryOptions
+	}
+	return nil
+}
+
+func (x *QueryRequest) GetFileFilter() string {
+	if x != nil {
+		return x.FileFilter
+	}
+	return ""
+}
+
+func (x *QueryRequest) GetIncludeRotated() bool {
+	if x != nil {
+		return x.IncludeRotated
+	}
+	return false
+}
+
+func (x *QueryRequest) GetSince() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Since
+	}
+	return nil
+}
+
+func (x *QueryRequest) GetUntil() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Until
+	}
+	return nil
+}
+
+func (x *QueryRequest) GetTimestampLayout() string {
+	if x != nil {
+		return x.TimestampLayout
+	}
+	return ""
+}
+
+func (x *QueryRequest) GetParseRecords() bool {
+	if x != nil {
+		return x.ParseRecords
+	}
+	return false
+}
+
+func (x *QueryRequest) GetMinLevel() Level {
+	if x != nil {
+		return x.MinLevel
+	}
+	return Level_LEVEL_UNSPECIFIED
+}
+
+func (x *QueryRequest) GetLevels() []Level {
+	if x != nil {
+		return x.Levels
+	}
+	return nil
+}
+
+func (x *QueryRequest) GetQuery() string {
+	if x != nil {
+		return x.Query
+	}
+	return ""
+}
+
+func (x *QueryRequest) GetMaxResults() int32 {
+	if x != nil {
+		return x.MaxResults
+	}
+	return 0
+}
+
+func (x *QueryRequest) GetPageToken() string {
+	if x != nil {
+		return x.PageToken
+	}
+	return ""
+}
+
+func (x *QueryRequest) GetExtract() string {
+	if x != nil {
+		return x.Extract
+	}
+	return ""
+}
+
+// Search options a client may request; the server rejects anything else
+type QueryOptions struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	CaseInsensitive bool                   `protobuf:"varint,1,opt,name=case_insensitive,json=caseInsensitive,proto3" json:"case_insensitive,omitempty"`               // Ignore case distinctions (grep -i)
+	Invert          bool                   `protobuf:"varint,2,opt,name=invert,proto3" json:"invert,omitempty"`                                                        // Select non-matching lines (grep -v)
+	RegexFlavor     RegexFlavor            `protobuf:"varint,3,opt,name=regex_flavor,json=regexFlavor,proto3,enum=logquery.RegexFlavor" json:"regex_flavor,omitempty"` // Pattern syntax (grep -G, -E, -F)
+	WholeWord       bool                   `protobuf:"varint,4,opt,name=whole_word,json=wholeWord,proto3" json:"whole_word,omitempty"`                                 // Match only whole words (grep -w)
+	WholeLine       bool                   `protobuf:"varint,5,opt,name=whole_line,json=wholeLine,proto3" json:"whole_line,omitempty"`                                 // Match only whole lines (grep -x)
+	CountOnly       bool                   `protobuf:"varint,6,opt,name=count_only,json=countOnly,proto3" json:"count_only,omitempty"`                                 // Return only the count (grep -c)
+	MaxCount        int32                  `protobuf:"varint,7,opt,name=max_count,json=maxCount,proto3" json:"max_count,omitempty"`                                    // Stop after this many matches, 0 for no limit (grep -m)
+	BeforeContext   int32                  `protobuf:"varint,8,opt,name=before_context,json=beforeContext,proto3" json:"before_context,omitempty"`                     // Context lines before each match (grep -B)
+	AfterContext    int32                  `protobuf:"varint,9,opt,name=after_context,json=afterContext,proto3" json:"after_context,omitempty"`                        // Context lines after each match (grep -A)
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *QueryOptions) Reset() {
+	*x = QueryOptions{}
+	mi := &file_logquery_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueryOptions) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueryOptions) ProtoMessage() {}
+
+func (x *QueryOptions) ProtoReflect() protoreflect.Message {
+	mi := &file_logquery_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueryOptions.ProtoReflect.Descriptor instead.
+func (*QueryOptions) Descriptor() ([]byte, []int) {
+	return file_logquery_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *QueryOptions) GetCaseInsensitive() bool {
+	if x != nil {
+		return x.CaseInsensitive
+	}
+	return false
+}
+
+func (x *QueryOptions) GetInvert() bool {
+	if x != nil {
+		return x.Invert
+	}
+	return false
+}
+
+func (x *QueryOptions) GetRegexFlavor() RegexFlavor {
+	if x != nil {
+		return x.RegexFlavor
+	}
+	return RegexFlavor_REGEX_FLAVOR_BASIC
+}
+
+func (x *QueryOptions) GetWholeWord() bool {
+	if x != nil {
+		return x.WholeWord
+	}
+	return false
+}
+
+func (x *QueryOptions) GetWholeLine() bool {
+	if x != nil {
+		return x.WholeLine
+	}
+	return false
+}
+
+func (x *QueryOptions) GetCountOnly() bool {
+	if x != nil {
+		return x.CountOnly
+	}
+	return false
+}
+
+func (x *QueryOptions) GetMaxCount() int32 {
+	if x != nil {
+		return x.MaxCount
+	}
+	return 0
+}
+
+func (x *QueryOptions) GetBeforeContext() int32 {
+	if x != nil {
+		return x.BeforeContext
+	}
+	return 0
+}
+
+func (x *QueryOptions) GetAfterContext() int32 {
+	if x != nil {
+		return x.AfterContext
+	}
+	return 0
+}
+
 // Response message containing search results
 type QueryResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	MachineId     string                 `protobuf:"bytes,1,opt,name=machine_id,json=machineId,proto3" json:"machine_id,omitempty"`  // Machine that processed the query
-	LineCount     int32                  `protobuf:"varint,2,opt,name=line_count,json=lineCount,proto3" json:"line_count,omitempty"` // Number of matching lines found
-	Filename      string                 `protobuf:"bytes,3,opt,name=filename,proto3" json:"filename,omitempty"`                     // Name of the log file searched
-	Lines         []string               `protobuf:"bytes,4,rep,name=lines,proto3" json:"lines,omitempty"`                           // Matching log lines
-	Error         string                 `protobuf:"bytes,5,opt,name=error,proto3" json:"error,omitempty"`                           // Error message if any
-	Success       bool                   `protobuf:"varint,6,opt,name=success,proto3" json:"success,omitempty"`                      // Whether the query was successful
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	MachineId string                 `protobuf:"bytes,1,opt,name=machine_id,json=machineId,proto3" json:"machine_id,omitempty"`  // Machine that processed the query
+	LineCount int32                  `protobuf:"varint,2,opt,name=line_count,json=lineCount,proto3" json:"line_count,omitempty"` // Number of matching lines found
+	Filename  string                 `protobuf:"bytes,3,opt,name=filename,proto3" json:"filename,omitempty"`                     // Names of the log files searched
+	// Deprecated: Marked as deprecated in logquery.proto.
+	Lines         []string      `protobuf:"bytes,4,rep,name=lines,proto3" json:"lines,omitempty"`                                        // Unused; lines are reported per file
+	Error         string        `protobuf:"bytes,5,opt,name=error,proto3" json:"error,omitempty"`                                        // Error message if any
+	Success       bool          `protobuf:"varint,6,opt,name=success,proto3" json:"success,omitempty"`                                   // Whether the query was successful
+	Files         []*FileResult `protobuf:"bytes,7,rep,name=files,proto3" json:"files,omitempty"`                                        // Per-file results
+	NextPageToken string        `protobuf:"bytes,8,opt,name=next_page_token,json=nextPageToken,proto3" json:"next_page_token,omitempty"` // Pass as page_token to fetch the next page; empty on the last page
+	Truncated     bool          `protobuf:"varint,9,opt,name=truncated,proto3" json:"truncated,omitempty"`                               // More matches remain beyond max_results
+	BytesScanned  int64         `protobuf:"varint,10,opt,name=bytes_scanned,json=bytesScanned,proto3" json:"bytes_scanned,omitempty"`    // Bytes of log actually read, after index pruning
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *QueryResponse) Reset() {
 	*x = QueryResponse{}
-	mi := &file_logquery_proto_msgTypes[1]
+	mi := &file_logquery_proto_msgTypes[2]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -109,7 +549,7 @@ func (x *QueryResponse) String() string {
 func (*QueryResponse) ProtoMessage() {}
 
 func (x *QueryResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_logquery_proto_msgTypes[1]
+	mi := &file_logquery_proto_msgTypes[2]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -122,7 +562,7 @@ func (x *QueryResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use QueryResponse.ProtoReflect.Descriptor instead.
 func (*QueryResponse) Descriptor() ([]byte, []int) {
-	return file_logquery_proto_rawDescGZIP(), []int{1}
+	return file_logquery_proto_rawDescGZIP(), []int{2}
 }
 
 func (x *QueryResponse) GetMachineId() string {
@@ -146,6 +586,7 @@ func (x *QueryResponse) GetFilename() string {
 	return ""
 }
 
+// Deprecated: Marked as deprecated in logquery.proto.
 func (x *QueryResponse) GetLines() []string {
 	if x != nil {
 		return x.Lines
@@ -167,27 +608,1947 @@ func (x *QueryResponse) GetSuccess() bool {
 	return false
 }
 
-var File_logquery_proto protoreflect.FileDescriptor
+func (x *QueryResponse) GetFiles() []*FileResult {
+	if x != nil {
+		return x.Files
+	}
+	return nil
+}
 
-const file_logquery_proto_rawDesc = "" +
-	"\n" +
-	"\x0elogquery.proto\x12\blogquery\"a\n" +
-	"\fQueryRequest\x12\x18\n" +
-	"\apattern\x18\x01 \x01(\tR\apattern\x12\x18\n" +
-	"\aoptions\x18\x02 \x01(\tR\aoptions\x12\x1d\n" +
-	"\n" +
-	"machine_id\x18\x03 \x01(\tR\tmachineId\"\xaf\x01\n" +
-	"\rQueryResponse\x12\x1d\n" +
-	"\n" +
-	"machine_id\x18\x01 \x01(\tR\tmachineId\x12\x1d\n" +
-	"\n" +
-	"line_count\x18\x02 \x01(\x05R\tlineCount\x12\x1a\n" +
-	"\bfilename\x18\x03 \x01(\tR\bfilename\x12\x14\n" +
-	"\x05lines\x18\x04 \x03(\tR\x05lines\x12\x14\n" +
-	"\x05error\x18\x05 \x01(\tR\x05error\x12\x18\n" +
-	"\asuccess\x18\x06 \x01(\bR\asuccess2H\n" +
-	"\bLogQuery\x12<\n" +
-	"\tQueryLogs\x12\x16.logquery.QueryRequest\x1a\x17.logquery.QueryResponseB'Z%github.com/sujayx23/g71_test/logqueryb\x06proto3"
+func (x *QueryResponse) GetNextPageToken() string {
+	if x != nil {
+		return x.NextPageToken
+	}
+	return ""
+}
+
+func (x *QueryResponse) GetTruncated() bool {
+	if x != nil {
+		return x.Truncated
+	}
+	return false
+}
+
+func (x *QueryResponse) GetBytesScanned() int64 {
+	if x != nil {
+		return x.BytesScanned
+	}
+	return 0
+}
+
+// Per-file section of a query result
+type FileResult struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Filename  string                 `protobuf:"bytes,1,opt,name=filename,proto3" json:"filename,omitempty"`                     // Path of the log file searched
+	LineCount int32                  `protobuf:"varint,2,opt,name=line_count,json=lineCount,proto3" json:"line_count,omitempty"` // Number of matching lines in this file
+	// Deprecated: Marked as deprecated in logquery.proto.
+	Lines         []string `protobuf:"bytes,3,rep,name=lines,proto3" json:"lines,omitempty"`                                    // Unused; see matches
+	Error         string   `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`                                    // Error searching this file, if any
+	Matches       []*Match `protobuf:"bytes,5,rep,name=matches,proto3" json:"matches,omitempty"`                                // Matching lines from this file
+	BytesScanned  int64    `protobuf:"varint,6,opt,name=bytes_scanned,json=bytesScanned,proto3" json:"bytes_scanned,omitempty"` // Bytes of this file actually read
+	Indexed       bool     `protobuf:"varint,7,opt,name=indexed,proto3" json:"indexed,omitempty"`                               // Whether the trigram index narrowed the scan
+	Cached        bool     `protobuf:"varint,8,opt,name=cached,proto3" json:"cached,omitempty"`                                 // Whether the result was reused from the server's cache, with only appended lines scanned
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FileResult) Reset() {
+	*x = FileResult{}
+	mi := &file_logquery_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FileResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileResult) ProtoMessage() {}
+
+func (x *FileResult) ProtoReflect() protoreflect.Message {
+	mi := &file_logquery_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FileResult.ProtoReflect.Descriptor instead.
+func (*FileResult) Descriptor() ([]byte, []int) {
+	return file_logquery_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *FileResult) GetFilename() string {
+	if x != nil {
+		return x.Filename
+	}
+	return ""
+}
+
+func (x *FileResult) GetLineCount() int32 {
+	if x != nil {
+		return x.LineCount
+	}
+	return 0
+}
+
+// Deprecated: Marked as deprecated in logquery.proto.
+func (x *FileResult) GetLines() []string {
+	if x != nil {
+		return x.Lines
+	}
+	return nil
+}
+
+func (x *FileResult) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *FileResult) GetMatches() []*Match {
+	if x != nil {
+		return x.Matches
+	}
+	return nil
+}
+
+func (x *FileResult) GetBytesScanned() int64 {
+	if x != nil {
+		return x.BytesScanned
+	}
+	return 0
+}
+
+func (x *FileResult) GetIndexed() bool {
+	if x != nil {
+		return x.Indexed
+	}
+	return false
+}
+
+func (x *FileResult) GetCached() bool {
+	if x != nil {
+		return x.Cached
+	}
+	return false
+}
+
+// A matching line together with its surrounding context
+type Match struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Line          string                 `protobuf:"bytes,1,opt,name=line,proto3" json:"line,omitempty"`                                                                               // The matching line
+	LineNumber    int64                  `protobuf:"varint,2,opt,name=line_number,json=lineNumber,proto3" json:"line_number,omitempty"`                                                // 1-based line number of the match
+	Before        []string               `protobuf:"bytes,3,rep,name=before,proto3" json:"before,omitempty"`                                                                           // Context lines immediately preceding the match
+	After         []string               `protobuf:"bytes,4,rep,name=after,proto3" json:"after,omitempty"`                                                                             // Context lines immediately following the match
+	ByteOffset    int64                  `protobuf:"varint,5,opt,name=byte_offset,json=byteOffset,proto3" json:"byte_offset,omitempty"`                                                // Byte offset of the matching line in the (decompressed) file
+	Spans         []*Span                `protobuf:"bytes,6,rep,name=spans,proto3" json:"spans,omitempty"`                                                                             // Every pattern match within the line; empty for inverted queries
+	Record        *LogRecord             `protobuf:"bytes,7,opt,name=record,proto3" json:"record,omitempty"`                                                                           // The line parsed into its parts, if parse_records was set
+	Fields        map[string]string      `protobuf:"bytes,8,rep,name=fields,proto3" json:"fields,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"` // Values captured by the named groups of extract; empty if it did not match
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Match) Reset() {
+	*x = Match{}
+	mi := &file_logquery_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Match) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Match) ProtoMessage() {}
+
+func (x *Match) ProtoReflect() protoreflect.Message {
+	mi := &file_logquery_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Match.ProtoReflect.Descriptor instead.
+func (*Match) Descriptor() ([]byte, []int) {
+	return file_logquery_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Match) GetLine() string {
+	if x != nil {
+		return x.Line
+	}
+	return ""
+}
+
+func (x *Match) GetLineNumber() int64 {
+	if x != nil {
+		return x.LineNumber
+	}
+	return 0
+}
+
+func (x *Match) GetBefore() []string {
+	if x != nil {
+		return x.Before
+	}
+	return nil
+}
+
+func (x *Match) GetAfter() []string {
+	if x != nil {
+		return x.After
+	}
+	return nil
+}
+
+func (x *Match) GetByteOffset() int64 {
+	if x != nil {
+		return x.ByteOffset
+	}
+	return 0
+}
+
+func (x *Match) GetSpans() []*Span {
+	if x != nil {
+		return x.Spans
+	}
+	return nil
+}
+
+func (x *Match) GetRecord() *LogRecord {
+	if x != nil {
+		return x.Record
+	}
+	return nil
+}
+
+func (x *Match) GetFields() map[string]string {
+	if x != nil {
+		return x.Fields
+	}
+	return nil
+}
+
+// A log line broken into its parts by the server's line parser
+type LogRecord struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Timestamp     *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"` // When the line was logged; unset if it has no timestamp
+	Level         string                 `protobuf:"bytes,2,opt,name=level,proto3" json:"level,omitempty"`         // Upper-cased severity level, e.g. "ERROR"; empty if none
+	Message       string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`     // Text following the level
+	Raw           string                 `protobuf:"bytes,4,opt,name=raw,proto3" json:"raw,omitempty"`             // The original line
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LogRecord) Reset() {
+	*x = LogRecord{}
+	mi := &file_logquery_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LogRecord) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LogRecord) ProtoMessage() {}
+
+func (x *LogRecord) ProtoReflect() protoreflect.Message {
+	mi := &file_logquery_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LogRecord.ProtoReflect.Descriptor instead.
+func (*LogRecord) Descriptor() ([]byte, []int) {
+	return file_logquery_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *LogRecord) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *LogRecord) GetLevel() string {
+	if x != nil {
+		return x.Level
+	}
+	return ""
+}
+
+func (x *LogRecord) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *LogRecord) GetRaw() string {
+	if x != nil {
+		return x.Raw
+	}
+	return ""
+}
+
+// Half-open byte range [start, end) within a line
+type Span struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Start         int32                  `protobuf:"varint,1,opt,name=start,proto3" json:"start,omitempty"` // Offset of the first byte of the match
+	End           int32                  `protobuf:"varint,2,opt,name=end,proto3" json:"end,omitempty"`     // Offset just past the last byte of the match
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Span) Reset() {
+	*x = Span{}
+	mi := &file_logquery_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Span) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Span) ProtoMessage() {}
+
+func (x *Span) ProtoReflect() protoreflect.Message {
+	mi := &file_logquery_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Span.ProtoReflect.Descriptor instead.
+func (*Span) Descriptor() ([]byte, []int) {
+	return file_logquery_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Span) GetStart() int32 {
+	if x != nil {
+		return x.Start
+	}
+	return 0
+}
+
+func (x *Span) GetEnd() int32 {
+	if x != nil {
+		return x.End
+	}
+	return 0
+}
+
+// Streamed response message: a batch of matches, or the final trailer
+type QueryChunk struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	MachineId string                 `protobuf:"bytes,1,opt,name=machine_id,json=machineId,proto3" json:"machine_id,omitempty"` // Machine that processed the query
+	Filename  string                 `protobuf:"bytes,2,opt,name=filename,proto3" json:"filename,omitempty"`                    // Log file the matches in this batch come from
+	// Deprecated: Marked as deprecated in logquery.proto.
+	Lines         []string      `protobuf:"bytes,3,rep,name=lines,proto3" json:"lines,omitempty"`     // Unused; see matches
+	Trailer       *QueryTrailer `protobuf:"bytes,4,opt,name=trailer,proto3" json:"trailer,omitempty"` // Set only on the last message of the stream
+	Matches       []*Match      `protobuf:"bytes,5,rep,name=matches,proto3" json:"matches,omitempty"` // Batch of matching lines
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QueryChunk) Reset() {
+	*x = QueryChunk{}
+	mi := &file_logquery_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueryChunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueryChunk) ProtoMessage() {}
+
+func (x *QueryChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_logquery_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueryChunk.ProtoReflect.Descriptor instead.
+func (*QueryChunk) Descriptor() ([]byte, []int) {
+	return file_logquery_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *QueryChunk) GetMachineId() string {
+	if x != nil {
+		return x.MachineId
+	}
+	return ""
+}
+
+func (x *QueryChunk) GetFilename() string {
+	if x != nil {
+		return x.Filename
+	}
+	return ""
+}
+
+// Deprecated: Marked as deprecated in logquery.proto.
+func (x *QueryChunk) GetLines() []string {
+	if x != nil {
+		return x.Lines
+	}
+	return nil
+}
+
+func (x *QueryChunk) GetTrailer() *QueryTrailer {
+	if x != nil {
+		return x.Trailer
+	}
+	return nil
+}
+
+func (x *QueryChunk) GetMatches() []*Match {
+	if x != nil {
+		return x.Matches
+	}
+	return nil
+}
+
+// Trailer message summarizing a streamed query
+type QueryTrailer struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	LineCount     int32                  `protobuf:"varint,1,opt,name=line_count,json=lineCount,proto3" json:"line_count,omitempty"`              // Total number of matching lines found
+	Error         string                 `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`                                        // Error message if any
+	Success       bool                   `protobuf:"varint,3,opt,name=success,proto3" json:"success,omitempty"`                                   // Whether the query was successful
+	Files         []*FileResult          `protobuf:"bytes,4,rep,name=files,proto3" json:"files,omitempty"`                                        // Per-file counts and errors, without matches
+	NextPageToken string                 `protobuf:"bytes,5,opt,name=next_page_token,json=nextPageToken,proto3" json:"next_page_token,omitempty"` // Pass as page_token to fetch the next page; empty on the last page
+	Truncated     bool                   `protobuf:"varint,6,opt,name=truncated,proto3" json:"truncated,omitempty"`                               // More matches remain beyond max_results
+	BytesScanned  int64                  `protobuf:"varint,7,opt,name=bytes_scanned,json=bytesScanned,proto3" json:"bytes_scanned,omitempty"`     // Bytes of log actually read, after index pruning
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QueryTrailer) Reset() {
+	*x = QueryTrailer{}
+	mi := &file_logquery_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueryTrailer) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueryTrailer) ProtoMessage() {}
+
+func (x *QueryTrailer) ProtoReflect() protoreflect.Message {
+	mi := &file_logquery_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueryTrailer.ProtoReflect.Descriptor instead.
+func (*QueryTrailer) Descriptor() ([]byte, []int) {
+	return file_logquery_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *QueryTrailer) GetLineCount() int32 {
+	if x != nil {
+		return x.LineCount
+	}
+	return 0
+}
+
+func (x *QueryTrailer) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *QueryTrailer) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *QueryTrailer) GetFiles() []*FileResult {
+	if x != nil {
+		return x.Files
+	}
+	return nil
+}
+
+func (x *QueryTrailer) GetNextPageToken() string {
+	if x != nil {
+		return x.NextPageToken
+	}
+	return ""
+}
+
+func (x *QueryTrailer) GetTruncated() bool {
+	if x != nil {
+		return x.Truncated
+	}
+	return false
+}
+
+func (x *QueryTrailer) GetBytesScanned() int64 {
+	if x != nil {
+		return x.BytesScanned
+	}
+	return 0
+}
+
+// Request for the index state of the server's log files
+type IndexStatusRequest struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	FileFilter     string                 `protobuf:"bytes,1,opt,name=file_filter,json=fileFilter,proto3" json:"file_filter,omitempty"`              // Optional glob restricting which log files are reported
+	IncludeRotated bool                   `protobuf:"varint,2,opt,name=include_rotated,json=includeRotated,proto3" json:"include_rotated,omitempty"` // Also report rotated copies
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *IndexStatusRequest) Reset() {
+	*x = IndexStatusRequest{}
+	mi := &file_logquery_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IndexStatusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IndexStatusRequest) ProtoMessage() {}
+
+func (x *IndexStatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_logquery_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IndexStatusRequest.ProtoReflect.Descriptor instead.
+func (*IndexStatusRequest) Descriptor() ([]byte, []int) {
+	return file_logquery_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *IndexStatusRequest) GetFileFilter() string {
+	if x != nil {
+		return x.FileFilter
+	}
+	return ""
+}
+
+func (x *IndexStatusRequest) GetIncludeRotated() bool {
+	if x != nil {
+		return x.IncludeRotated
+	}
+	return false
+}
+
+// Index state of every log file on one server
+type IndexStatusResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	MachineId     string                 `protobuf:"bytes,1,opt,name=machine_id,json=machineId,proto3" json:"machine_id,omitempty"` // Machine that produced the report
+	Enabled       bool                   `protobuf:"varint,2,opt,name=enabled,proto3" json:"enabled,omitempty"`                     // Whether the server maintains indexes at all
+	Files         []*FileIndexStatus     `protobuf:"bytes,3,rep,name=files,proto3" json:"files,omitempty"`                          // One entry per log file
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IndexStatusResponse) Reset() {
+	*x = IndexStatusResponse{}
+	mi := &file_logquery_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IndexStatusResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IndexStatusResponse) ProtoMessage() {}
+
+func (x *IndexStatusResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_logquery_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IndexStatusResponse.ProtoReflect.Descriptor instead.
+func (*IndexStatusResponse) Descriptor() ([]byte, []int) {
+	return file_logquery_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *IndexStatusResponse) GetMachineId() string {
+	if x != nil {
+		return x.MachineId
+	}
+	return ""
+}
+
+func (x *IndexStatusResponse) GetEnabled() bool {
+	if x != nil {
+		return x.Enabled
+	}
+	return false
+}
+
+func (x *IndexStatusResponse) GetFiles() []*FileIndexStatus {
+	if x != nil {
+		return x.Files
+	}
+	return nil
+}
+
+// Index freshness of a single log file
+type FileIndexStatus struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Filename      string                 `protobuf:"bytes,1,opt,name=filename,proto3" json:"filename,omitempty"`                              // Path of the log file
+	State         IndexState             `protobuf:"varint,2,opt,name=state,proto3,enum=logquery.IndexState" json:"state,omitempty"`          // How the index relates to the file now
+	FileSize      int64                  `protobuf:"varint,3,opt,name=file_size,json=fileSize,proto3" json:"file_size,omitempty"`             // Current size of the file
+	IndexedBytes  int64                  `protobuf:"varint,4,opt,name=indexed_bytes,json=indexedBytes,proto3" json:"indexed_bytes,omitempty"` // Bytes covered by the index, up to the last complete line
+	LagBytes      int64                  `protobuf:"varint,5,opt,name=lag_bytes,json=lagBytes,proto3" json:"lag_bytes,omitempty"`             // Bytes appended since, which queries scan in full
+	Blocks        int32                  `protobuf:"varint,6,opt,name=blocks,proto3" json:"blocks,omitempty"`                                 // Number of index blocks
+	Updated       *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=updated,proto3" json:"updated,omitempty"`                                // When the index was last built or extended
+	Rebuilds      int32                  `protobuf:"varint,8,opt,name=rebuilds,proto3" json:"rebuilds,omitempty"`                             // Times the index was discarded after rotation or truncation
+	Error         string                 `protobuf:"bytes,9,opt,name=error,proto3" json:"error,omitempty"`                                    // Last indexing failure, if any
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FileIndexStatus) Reset() {
+	*x = FileIndexStatus{}
+	mi := &file_logquery_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FileIndexStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileIndexStatus) ProtoMessage() {}
+
+func (x *FileIndexStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_logquery_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FileIndexStatus.ProtoReflect.Descriptor instead.
+func (*FileIndexStatus) Descriptor() ([]byte, []int) {
+	return file_logquery_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *FileIndexStatus) GetFilename() string {
+	if x != nil {
+		return x.Filename
+	}
+	return ""
+}
+
+func (x *FileIndexStatus) GetState() IndexState {
+	if x != nil {
+		return x.State
+	}
+	return IndexState_INDEX_STATE_UNSPECIFIED
+}
+
+func (x *FileIndexStatus) GetFileSize() int64 {
+	if x != nil {
+		return x.FileSize
+	}
+	return 0
+}
+
+func (x *FileIndexStatus) GetIndexedBytes() int64 {
+	if x != nil {
+		return x.IndexedBytes
+	}
+	return 0
+}
+
+func (x *FileIndexStatus) GetLagBytes() int64 {
+	if x != nil {
+		return x.LagBytes
+	}
+	return 0
+}
+
+func (x *FileIndexStatus) GetBlocks() int32 {
+	if x != nil {
+		return x.Blocks
+	}
+	return 0
+}
+
+func (x *FileIndexStatus) GetUpdated() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Updated
+	}
+	return nil
+}
+
+func (x *FileIndexStatus) GetRebuilds() int32 {
+	if x != nil {
+		return x.Rebuilds
+	}
+	return 0
+}
+
+func (x *FileIndexStatus) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+// Request to count the lines selected by a query, by group
+type AggregateRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Query         *QueryRequest          `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"`                           // Selects the lines; count_only, context lines and paging are not allowed
+	GroupBy       []string               `protobuf:"bytes,2,rep,name=group_by,json=groupBy,proto3" json:"group_by,omitempty"`        // Fields to group by, in column order: "level", "file" or a field named in query.extract
+	Bucket        *durationpb.Duration   `protobuf:"bytes,3,opt,name=bucket,proto3" json:"bucket,omitempty"`                         // Also group by the time bucket of this width each line was logged in
+	MaxGroups     int32                  `protobuf:"varint,4,opt,name=max_groups,json=maxGroups,proto3" json:"max_groups,omitempty"` // Return at most this many groups, largest first, 0 for the server's limit
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AggregateRequest) Reset() {
+	*x = AggregateRequest{}
+	mi := &file_logquery_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AggregateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AggregateRequest) ProtoMessage() {}
+
+func (x *AggregateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_logquery_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AggregateRequest.ProtoReflect.Descriptor instead.
+func (*AggregateRequest) Descriptor() ([]byte, []int) {
+	return file_logquery_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *AggregateRequest) GetQuery() *QueryRequest {
+	if x != nil {
+		return x.Query
+	}
+	return nil
+}
+
+func (x *AggregateRequest) GetGroupBy() []string {
+	if x != nil {
+		return x.GroupBy
+	}
+	return nil
+}
+
+func (x *AggregateRequest) GetBucket() *durationpb.Duration {
+	if x != nil {
+		return x.Bucket
+	}
+	return nil
+}
+
+func (x *AggregateRequest) GetMaxGroups() int32 {
+	if x != nil {
+		return x.MaxGroups
+	}
+	return 0
+}
+
+// Counts of one server, by group
+type AggregateResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	MachineId     string                 `protobuf:"bytes,1,opt,name=machine_id,json=machineId,proto3" json:"machine_id,omitempty"`     // Machine that computed the counts
+	Success       bool                   `protobuf:"varint,2,opt,name=success,proto3" json:"success,omitempty"`                         // Whether the aggregation was successful
+	Error         string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`                              // Error message if any
+	LineCount     int64                  `protobuf:"varint,4,opt,name=line_count,json=lineCount,proto3" json:"line_count,omitempty"`    // Number of lines counted
+	Groups        []*AggregateGroup      `protobuf:"bytes,5,rep,name=groups,proto3" json:"groups,omitempty"`                            // Counts by group
+	OtherCount    int64                  `protobuf:"varint,6,opt,name=other_count,json=otherCount,proto3" json:"other_count,omitempty"` // Lines in the groups left out by max_groups
+	Files         []*FileResult          `protobuf:"bytes,7,rep,name=files,proto3" json:"files,omitempty"`                              // Per-file counts and errors, without matches
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AggregateResponse) Reset() {
+	*x = AggregateResponse{}
+	mi := &file_logquery_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AggregateResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AggregateResponse) ProtoMessage() {}
+
+func (x *AggregateResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_logquery_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AggregateResponse.ProtoReflect.Descriptor instead.
+func (*AggregateResponse) Descriptor() ([]byte, []int) {
+	return file_logquery_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *AggregateResponse) GetMachineId() string {
+	if x != nil {
+		return x.MachineId
+	}
+	return ""
+}
+
+func (x *AggregateResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *AggregateResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *AggregateResponse) GetLineCount() int64 {
+	if x != nil {
+		return x.LineCount
+	}
+	return 0
+}
+
+func (x *AggregateResponse) GetGroups() []*AggregateGroup {
+	if x != nil {
+		return x.Groups
+	}
+	return nil
+}
+
+func (x *AggregateResponse) GetOtherCount() int64 {
+	if x != nil {
+		return x.OtherCount
+	}
+	return 0
+}
+
+func (x *AggregateResponse) GetFiles() []*FileResult {
+	if x != nil {
+		return x.Files
+	}
+	return nil
+}
+
+// Number of lines in one group
+type AggregateGroup struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Values        []string               `protobuf:"bytes,1,rep,name=values,proto3" json:"values,omitempty"` // Value of each group_by field, in order; empty when a line has none
+	Bucket        *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=bucket,proto3" json:"bucket,omitempty"` // Start of the time bucket; unset without bucket or for lines with no timestamp
+	Count         int64                  `protobuf:"varint,3,opt,name=count,proto3" json:"count,omitempty"`  // Lines in the group
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AggregateGroup) Reset() {
+	*x = AggregateGroup{}
+	mi := &file_logquery_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AggregateGroup) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AggregateGroup) ProtoMessage() {}
+
+func (x *AggregateGroup) ProtoReflect() protoreflect.Message {
+	mi := &file_logquery_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AggregateGroup.ProtoReflect.Descriptor instead.
+func (*AggregateGroup) Descriptor() ([]byte, []int) {
+	return file_logquery_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *AggregateGroup) GetValues() []string {
+	if x != nil {
+		return x.Values
+	}
+	return nil
+}
+
+func (x *AggregateGroup) GetBucket() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Bucket
+	}
+	return nil
+}
+
+func (x *AggregateGroup) GetCount() int64 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+// Request for the most frequent normalized messages
+type TopMessagesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Query         *QueryRequest          `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"` // Selects the lines; count_only, context lines and paging are not allowed
+	K             int32                  `protobuf:"varint,2,opt,name=k,proto3" json:"k,omitempty"`        // Number of messages wanted across the cluster (default 10)
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TopMessagesRequest) Reset() {
+	*x = TopMessagesRequest{}
+	mi := &file_logquery_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TopMessagesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TopMessagesRequest) ProtoMessage() {}
+
+func (x *TopMessagesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_logquery_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TopMessagesRequest.ProtoReflect.Descriptor instead.
+func (*TopMessagesRequest) Descriptor() ([]byte, []int) {
+	return file_logquery_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *TopMessagesRequest) GetQuery() *QueryRequest {
+	if x != nil {
+		return x.Query
+	}
+	return nil
+}
+
+func (x *TopMessagesRequest) GetK() int32 {
+	if x != nil {
+		return x.K
+	}
+	return 0
+}
+
+// A server's most frequent messages, as candidates for the global top list
+type TopMessagesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	MachineId     string                 `protobuf:"bytes,1,opt,name=machine_id,json=machineId,proto3" json:"machine_id,omitempty"`  // Machine that counted the messages
+	Success       bool                   `protobuf:"varint,2,opt,name=success,proto3" json:"success,omitempty"`                      // Whether the count was successful
+	Error         string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`                           // Error message if any
+	LineCount     int64                  `protobuf:"varint,4,opt,name=line_count,json=lineCount,proto3" json:"line_count,omitempty"` // Number of lines counted
+	Messages      []*MessageCount        `protobuf:"bytes,5,rep,name=messages,proto3" json:"messages,omitempty"`                     // Candidates, most frequent first; more than k, for merging
+	Threshold     int64                  `protobuf:"varint,6,opt,name=threshold,proto3" json:"threshold,omitempty"`                  // Upper bound on the count of any message not listed
+	Files         []*FileResult          `protobuf:"bytes,7,rep,name=files,proto3" json:"files,omitempty"`                           // Per-file counts and errors, without matches
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TopMessagesResponse) Reset() {
+	*x = TopMessagesResponse{}
+	mi := &file_logquery_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TopMessagesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TopMessagesResponse) ProtoMessage() {}
+
+func (x *TopMessagesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_logquery_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TopMessagesResponse.ProtoReflect.Descriptor instead.
+func (*TopMessagesResponse) Descriptor() ([]byte, []int) {
+	return file_logquery_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *TopMessagesResponse) GetMachineId() string {
+	if x != nil {
+		return x.MachineId
+	}
+	return ""
+}
+
+func (x *TopMessagesResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *TopMessagesResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *TopMessagesResponse) GetLineCount() int64 {
+	if x != nil {
+		return x.LineCount
+	}
+	return 0
+}
+
+func (x *TopMessagesResponse) GetMessages() []*MessageCount {
+	if x != nil {
+		return x.Messages
+	}
+	return nil
+}
+
+func (x *TopMessagesResponse) GetThreshold() int64 {
+	if x != nil {
+		return x.Threshold
+	}
+	return 0
+}
+
+func (x *TopMessagesResponse) GetFiles() []*FileResult {
+	if x != nil {
+		return x.Files
+	}
+	return nil
+}
+
+// Estimated frequency of one normalized message
+type MessageCount struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Message       string                 `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"` // Normalized message, e.g. "Request <n> timed out after <n>ms"
+	Count         int64                  `protobuf:"varint,2,opt,name=count,proto3" json:"count,omitempty"`    // Estimated count, never below the true count
+	Error         int64                  `protobuf:"varint,3,opt,name=error,proto3" json:"error,omitempty"`    // Most the estimate can exceed the true count by
+	Example       string                 `protobuf:"bytes,4,opt,name=example,proto3" json:"example,omitempty"` // One original message
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MessageCount) Reset() {
+	*x = MessageCount{}
+	mi := &file_logquery_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MessageCount) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MessageCount) ProtoMessage() {}
+
+func (x *MessageCount) ProtoReflect() protoreflect.Message {
+	mi := &file_logquery_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MessageCount.ProtoReflect.Descriptor instead.
+func (*MessageCount) Descriptor() ([]byte, []int) {
+	return file_logquery_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *MessageCount) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *MessageCount) GetCount() int64 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+func (x *MessageCount) GetError() int64 {
+	if x != nil {
+		return x.Error
+	}
+	return 0
+}
+
+func (x *MessageCount) GetExample() string {
+	if x != nil {
+		return x.Example
+	}
+	return ""
+}
+
+// Request for a server's search load
+type ServerLoadRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ServerLoadRequest) Reset() {
+	*x = ServerLoadRequest{}
+	mi := &file_logquery_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ServerLoadRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ServerLoadRequest) ProtoMessage() {}
+
+func (x *ServerLoadRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_logquery_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ServerLoadRequest.ProtoReflect.Descriptor instead.
+func (*ServerLoadRequest) Descriptor() ([]byte, []int) {
+	return file_logquery_proto_rawDescGZIP(), []int{18}
+}
+
+// Search load and limits of one server. Searches beyond the concurrency
+// limit wait in a bounded queue; when it is full they fail with
+// RESOURCE_EXHAUSTED
+type ServerLoadResponse struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	MachineId         string                 `protobuf:"bytes,1,opt,name=machine_id,json=machineId,proto3" json:"machine_id,omitempty"`                            // Machine that reported its load
+	ActiveSearches    int32                  `protobuf:"varint,2,opt,name=active_searches,json=activeSearches,proto3" json:"active_searches,omitempty"`            // Searches running now
+	MaxActiveSearches int32                  `protobuf:"varint,3,opt,name=max_active_searches,json=maxActiveSearches,proto3" json:"max_active_searches,omitempty"` // Searches the server runs at once
+	QueuedSearches    int32                  `protobuf:"varint,4,opt,name=queued_searches,json=queuedSearches,proto3" json:"queued_searches,omitempty"`            // Searches waiting for a slot
+	MaxQueuedSearches int32                  `protobuf:"varint,5,opt,name=max_queued_searches,json=maxQueuedSearches,proto3" json:"max_queued_searches,omitempty"` // Searches that may wait before more are rejected
+	Admitted          int64                  `protobuf:"varint,6,opt,name=admitted,proto3" json:"admitted,omitempty"`                                              // Searches admitted since the server started
+	Rejected          int64                  `protobuf:"varint,7,opt,name=rejected,proto3" json:"rejected,omitempty"`                                              // Searches rejected because the queue was full
+	BudgetExceeded    int64                  `protobuf:"varint,8,opt,name=budget_exceeded,json=budgetExceeded,proto3" json:"budget_exceeded,omitempty"`            // Searches stopped for exceeding their budget
+	RetryAfter        *durationpb.Duration   `protobuf:"bytes,9,opt,name=retry_after,json=retryAfter,proto3" json:"retry_after,omitempty"`                         // Suggested wait before retrying a rejected search
+	MaxQueryBytes     int64                  `protobuf:"varint,10,opt,name=max_query_bytes,json=maxQueryBytes,proto3" json:"max_query_bytes,omitempty"`            // Bytes a single search may read, 0 for no limit
+	MaxQueryCpu       *durationpb.Duration   `protobuf:"bytes,11,opt,name=max_query_cpu,json=maxQueryCpu,proto3" json:"max_query_cpu,omitempty"`                   // CPU time a single search may use; unset for no limit
+	Cache             *CacheStats            `protobuf:"bytes,12,opt,name=cache,proto3" json:"cache,omitempty"`                                                    // Use of the server's result cache
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *ServerLoadResponse) Reset() {
+	*x = ServerLoadResponse{}
+	mi := &file_logquery_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ServerLoadResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ServerLoadResponse) ProtoMessage() {}
+
+func (x *ServerLoadResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_logquery_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ServerLoadResponse.ProtoReflect.Descriptor instead.
+func (*ServerLoadResponse) Descriptor() ([]byte, []int) {
+	return file_logquery_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *ServerLoadResponse) GetMachineId() string {
+	if x != nil {
+		return x.MachineId
+	}
+	return ""
+}
+
+func (x *ServerLoadResponse) GetActiveSearches() int32 {
+	if x != nil {
+		return x.ActiveSearches
+	}
+	return 0
+}
+
+func (x *ServerLoadResponse) GetMaxActiveSearches() int32 {
+	if x != nil {
+		return x.MaxActiveSearches
+	}
+	return 0
+}
+
+func (x *ServerLoadResponse) GetQueuedSearches() int32 {
+	if x != nil {
+		return x.QueuedSearches
+	}
+	return 0
+}
+
+func (x *ServerLoadResponse) GetMaxQueuedSearches() int32 {
+	if x != nil {
+		return x.MaxQueuedSearches
+	}
+	return 0
+}
+
+func (x *ServerLoadResponse) GetAdmitted() int64 {
+	if x != nil {
+		return x.Admitted
+	}
+	return 0
+}
+
+func (x *ServerLoadResponse) GetRejected() int64 {
+	if x != nil {
+		return x.Rejected
+	}
+	return 0
+}
+
+func (x *ServerLoadResponse) GetBudgetExceeded() int64 {
+	if x != nil {
+		return x.BudgetExceeded
+	}
+	return 0
+}
+
+func (x *ServerLoadResponse) GetRetryAfter() *durationpb.Duration {
+	if x != nil {
+		return x.RetryAfter
+	}
+	return nil
+}
+
+func (x *ServerLoadResponse) GetMaxQueryBytes() int64 {
+	if x != nil {
+		return x.MaxQueryBytes
+	}
+	return 0
+}
+
+func (x *ServerLoadResponse) GetMaxQueryCpu() *durationpb.Duration {
+	if x != nil {
+		return x.MaxQueryCpu
+	}
+	return nil
+}
+
+func (x *ServerLoadResponse) GetCache() *CacheStats {
+	if x != nil {
+		return x.Cache
+	}
+	return nil
+}
+
+// Use of a server's result cache since it started. Results are cached per
+// query and file, and reused while the file is unchanged; when lines have
+// only been appended, just the new lines are searched
+type CacheStats struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Enabled       bool                   `protobuf:"varint,1,opt,name=enabled,proto3" json:"enabled,omitempty"`                            // Whether the server caches results at all
+	Hits          int64                  `protobuf:"varint,2,opt,name=hits,proto3" json:"hits,omitempty"`                                  // File searches answered entirely from the cache
+	PartialHits   int64                  `protobuf:"varint,3,opt,name=partial_hits,json=partialHits,proto3" json:"partial_hits,omitempty"` // File searches that only scanned lines appended since they were cached
+	Misses        int64                  `protobuf:"varint,4,opt,name=misses,proto3" json:"misses,omitempty"`                              // File searches run in full
+	Entries       int32                  `protobuf:"varint,5,opt,name=entries,proto3" json:"entries,omitempty"`                            // Results cached now
+	Bytes         int64                  `protobuf:"varint,6,opt,name=bytes,proto3" json:"bytes,omitempty"`                                // Approximate size of the cached results
+	Capacity      int64                  `protobuf:"varint,7,opt,name=capacity,proto3" json:"capacity,omitempty"`                          // Most the cached results may take
+	Evictions     int64                  `protobuf:"varint,8,opt,name=evictions,proto3" json:"evictions,omitempty"`                        // Results evicted to make room
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CacheStats) Reset() {
+	*x = CacheStats{}
+	mi := &file_logquery_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CacheStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CacheStats) ProtoMessage() {}
+
+func (x *CacheStats) ProtoReflect() protoreflect.Message {
+	mi := &file_logquery_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CacheStats.ProtoReflect.Descriptor instead.
+func (*CacheStats) Descriptor() ([]byte, []int) {
+	return file_logquery_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *CacheStats) GetEnabled() bool {
+	if x != nil {
+		return x.Enabled
+	}
+	return false
+}
+
+func (x *CacheStats) GetHits() int64 {
+	if x != nil {
+		return x.Hits
+	}
+	return 0
+}
+
+func (x *CacheStats) GetPartialHits() int64 {
+	if x != nil {
+		return x.PartialHits
+	}
+	return 0
+}
+
+func (x *CacheStats) GetMisses() int64 {
+	if x != nil {
+		return x.Misses
+	}
+	return 0
+}
+
+func (x *CacheStats) GetEntries() int32 {
+	if x != nil {
+		return x.Entries
+	}
+	return 0
+}
+
+func (x *CacheStats) GetBytes() int64 {
+	if x != nil {
+		return x.Bytes
+	}
+	return 0
+}
+
+func (x *CacheStats) GetCapacity() int64 {
+	if x != nil {
+		return x.Capacity
+	}
+	return 0
+}
+
+func (x *CacheStats) GetEvictions() int64 {
+	if x != nil {
+		return x.Evictions
+	}
+	return 0
+}
+
+// Request to describe the log files a server can search
+type ListFilesRequest struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	FileFilter      string                 `protobuf:"bytes,1,opt,name=file_filter,json=fileFilter,proto3" json:"file_filter,omitempty"`                // Optional glob restricting which log files are reported
+	IncludeRotated  bool                   `protobuf:"varint,2,opt,name=include_rotated,json=includeRotated,proto3" json:"include_rotated,omitempty"`   // Also report rotated copies
+	TimestampLayout string                 `protobuf:"bytes,3,opt,name=timestamp_layout,json=timestampLayout,proto3" json:"timestamp_layout,omitempty"` // Go time layout of each line's leading timestamp (empty for the default)
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *ListFilesRequest) Reset() {
+	*x = ListFilesRequest{}
+	mi := &file_logquery_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListFilesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListFilesRequest) ProtoMessage() {}
+
+func (x *ListFilesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_logquery_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListFilesRequest.ProtoReflect.Descriptor instead.
+func (*ListFilesRequest) Descriptor() ([]byte, []int) {
+	return file_logquery_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *ListFilesRequest) GetFileFilter() string {
+	if x != nil {
+		return x.FileFilter
+	}
+	return ""
+}
+
+func (x *ListFilesRequest) GetIncludeRotated() bool {
+	if x != nil {
+		return x.IncludeRotated
+	}
+	return false
+}
+
+func (x *ListFilesRequest) GetTimestampLayout() string {
+	if x != nil {
+		return x.TimestampLayout
+	}
+	return ""
+}
+
+// The log files one server can search
+type ListFilesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	MachineId     string                 `protobuf:"bytes,1,opt,name=machine_id,json=machineId,proto3" json:"machine_id,omitempty"` // Machine that produced the list
+	Files         []*LogFile             `protobuf:"bytes,2,rep,name=files,proto3" json:"files,omitempty"`                          // One entry per log file, rotated copies before their live log
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListFilesResponse) Reset() {
+	*x = ListFilesResponse{}
+	mi := &file_logquery_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListFilesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListFilesResponse) ProtoMessage() {}
+
+func (x *ListFilesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_logquery_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListFilesResponse.ProtoReflect.Descriptor instead.
+func (*ListFilesResponse) Descriptor() ([]byte, []int) {
+	return file_logquery_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *ListFilesResponse) GetMachineId() string {
+	if x != nil {
+		return x.MachineId
+	}
+	return ""
+}
+
+func (x *ListFilesResponse) GetFiles() []*LogFile {
+	if x != nil {
+		return x.Files
+	}
+	return nil
+}
+
+// A searchable log file. Line counts of large plain files are estimated
+// from a sample; compressed files are read in full and counted exactly
+type LogFile struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Filename       string                 `protobuf:"bytes,1,opt,name=filename,proto3" json:"filename,omitempty"`                                   // Path of the log file
+	Size           int64                  `protobuf:"varint,2,opt,name=size,proto3" json:"size,omitempty"`                                          // Size on disk
+	Modified       *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=modified,proto3" json:"modified,omitempty"`                                   // Last modification time
+	Lines          int64                  `protobuf:"varint,4,opt,name=lines,proto3" json:"lines,omitempty"`                                        // Number of lines, possibly estimated
+	LinesExact     bool                   `protobuf:"varint,5,opt,name=lines_exact,json=linesExact,proto3" json:"lines_exact,omitempty"`            // Whether lines was counted rather than estimated
+	FirstTimestamp *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=first_timestamp,json=firstTimestamp,proto3" json:"first_timestamp,omitempty"` // Timestamp of the first line that has one; unset if none was found
+	LastTimestamp  *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=last_timestamp,json=lastTimestamp,proto3" json:"last_timestamp,omitempty"`    // Timestamp of the last line that has one; unset if none was found
+	Compression    Compression            `protobuf:"varint,8,opt,name=compression,proto3,enum=logquery.Compression" json:"compression,omitempty"`  // How the file is stored
+	Rotated        bool                   `protobuf:"varint,9,opt,name=rotated,proto3" json:"rotated,omitempty"`                                    // Whether this is a rotated copy rather than a live log
+	Error          string                 `protobuf:"bytes,10,opt,name=error,proto3" json:"error,omitempty"`                                        // Why the file could not be described, if it could not
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *LogFile) Reset() {
+	*x = LogFile{}
+	mi := &file_logquery_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LogFile) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LogFile) ProtoMessage() {}
+
+func (x *LogFile) ProtoReflect() protoreflect.Message {
+	mi := &file_logquery_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LogFile.ProtoReflect.Descriptor instead.
+func (*LogFile) Descriptor() ([]byte, []int) {
+	return file_logquery_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *LogFile) GetFilename() string {
+	if x != nil {
+		return x.Filename
+	}
+	return ""
+}
+
+func (x *LogFile) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *LogFile) GetModified() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Modified
+	}
+	return nil
+}
+
+func (x *LogFile) GetLines() int64 {
+	if x != nil {
+		return x.Lines
+	}
+	return 0
+}
+
+func (x *LogFile) GetLinesExact() bool {
+	if x != nil {
+		return x.LinesExact
+	}
+	return false
+}
+
+func (x *LogFile) GetFirstTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.FirstTimestamp
+	}
+	return nil
+}
+
+func (x *LogFile) GetLastTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastTimestamp
+	}
+	return nil
+}
+
+func (x *LogFile) GetCompression() Compression {
+	if x != nil {
+		return x.Compression
+	}
+	return Compression_COMPRESSION_NONE
+}
+
+func (x *LogFile) GetRotated() bool {
+	if x != nil {
+		return x.Rotated
+	}
+	return false
+}
+
+func (x *LogFile) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+var File_logquery_proto protoreflect.FileDescriptor
+
+const file_logquery_proto_rawDesc = "" +
+	"\n" +
+	"\x0elogquery.proto\x12\blogquery\x1a\x1egoogle/protobuf/duration.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\xe7\x04\n" +
+	"\fQueryRequest\x12\x18\n" +
+	"\apattern\x18\x01 \x01(\tR\apattern\x12\x1c\n" +
+	"\aoptions\x18\x02 \x01(\tB\x02\x18\x01R\aoptions\x12\x1d\n" +
+	"\n" +
+	"machine_id\x18\x03 \x01(\tR\tmachineId\x12;\n" +
+	"\rquery_options\x18\x04 \x01(\v2\x16.logquery.QueryOptionsR\fqueryOptions\x12\x1f\n" +
+	"\vfile_filter\x18\x05 \x01(\tR\n" +
+	"fileFilter\x12'\n" +
+	"\x0finclude_rotated\x18\x06 \x01(\bR\x0eincludeRotated\x120\n" +
+	"\x05since\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\x05since\x120\n" +
+	"\x05until\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\x05until\x12)\n" +
+	"\x10timestamp_layout\x18\t \x01(\tR\x0ftimestampLayout\x12#\n" +
+	"\rparse_records\x18\n" +
+	" \x01(\bR\fparseRecords\x12,\n" +
+	"\tmin_level\x18\v \x01(\x0e2\x0f.logquery.LevelR\bminLevel\x12'\n" +
+	"\x06levels\x18\f \x03(\x0e2\x0f.logquery.LevelR\x06levels\x12\x14\n" +
+	"\x05query\x18\r \x01(\tR\x05query\x12\x1f\n" +
+	"\vmax_results\x18\x0e \x01(\x05R\n" +
+	"maxResults\x12\x1d\n" +
+	"\n" +
+	"page_token\x18\x0f \x01(\tR\tpageToken\x12\x18\n" +
+	"\aextract\x18\x10 \x01(\tR\aextract\"\xd1\x02\n" +
+	"\fQueryOptions\x12)\n" +
+	"\x10case_insensitive\x18\x01 \x01(\bR\x0fcaseInsensitive\x12\x16\n" +
+	"\x06invert\x18\x02 \x01(\bR\x06invert\x128\n" +
+	"\fregex_flavor\x18\x03 \x01(\x0e2\x15.logquery.RegexFlavorR\vregexFlavor\x12\x1d\n" +
+	"\n" +
+	"whole_word\x18\x04 \x01(\bR\twholeWord\x12\x1d\n" +
+	"\n" +
+	"whole_line\x18\x05 \x01(\bR\twholeLine\x12\x1d\n" +
+	"\n" +
+	"count_only\x18\x06 \x01(\bR\tcountOnly\x12\x1b\n" +
+	"\tmax_count\x18\a \x01(\x05R\bmaxCount\x12%\n" +
+	"\x0ebefore_context\x18\b \x01(\x05R\rbeforeContext\x12#\n" +
+	"\rafter_context\x18\t \x01(\x05R\fafterContext\"\xca\x02\n" +
+	"\rQueryResponse\x12\x1d\n" +
+	"\n" +
+	"machine_id\x18\x01 \x01(\tR\tmachineId\x12\x1d\n" +
+	"\n" +
+	"line_count\x18\x02 \x01(\x05R\tlineCount\x12\x1a\n" +
+	"\bfilename\x18\x03 \x01(\tR\bfilename\x12\x18\n" +
+	"\x05lines\x18\x04 \x03(\tB\x02\x18\x01R\x05lines\x12\x14\n" +
+	"\x05error\x18\x05 \x01(\tR\x05error\x12\x18\n" +
+	"\asuccess\x18\x06 \x01(\bR\asuccess\x12*\n" +
+	"\x05files\x18\a \x03(\v2\x14.logquery.FileResultR\x05files\x12&\n" +
+	"\x0fnext_page_token\x18\b \x01(\tR\rnextPageToken\x12\x1c\n" +
+	"\ttruncated\x18\t \x01(\bR\ttruncated\x12#\n" +
+	"\rbytes_scanned\x18\n" +
+	" \x01(\x03R\fbytesScanned\"\xf9\x01\n" +
+	"\n" +
+	"FileResult\x12\x1a\n" +
+	"\bfilename\x18\x01 \x01(\tR\bfilename\x12\x1d\n" +
+	"\n" +
+	"line_count\x18\x02 \x01(\x05R\tlineCount\x12\x18\n" +
+	"\x05lines\x18\x03 \x03(\tB\x02\x18\x01R\x05lines\x12\x14\n" +
+	"\x05error\x18\x04 \x01(\tR\x05error\x12)\n" +
+	"\amatches\x18\x05 \x03(\v2\x0f.logquery.MatchR\amatches\x12#\n" +
+	"\rbytes_scanned\x18\x06 \x01(\x03R\fbytesScanned\x12\x18\n" +
+	"\aindexed\x18\a \x01(\bR\aindexed\x12\x16\n" +
+	"\x06cached\x18\b \x01(\bR\x06cached\"\xce\x02\n" +
+	"\x05Match\x12\x12\n" +
+	"\x04line\x18\x01 \x01(\tR\x04line\x12\x1f\n" +
+	"\vline_number\x18\x02 \x01(\x03R\n" +
+	"lineNumber\x12\x16\n" +
+	"\x06before\x18\x03 \x03(\tR\x06before\x12\x14\n" +
+	"\x05after\x18\x04 \x03(\tR\x05after\x12\x1f\n" +
+	"\vbyte_offset\x18\x05 \x01(\x03R\n" +
+	"byteOffset\x12$\n" +
+	"\x05spans\x18\x06 \x03(\v2\x0e.logquery.SpanR\x05spans\x12+\n" +
+	"\x06record\x18\a \x01(\v2\x13.logquery.LogRecordR\x06record\x123\n" +
+	"\x06fields\x18\b \x03(\v2\x1b.logquery.Match.FieldsEntryR\x06fields\x1a9\n" +
+	"\vFieldsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x87\x01\n" +
+	"\tLogRecord\x128\n" +
+	"\ttimestamp\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12\x14\n" +
+	"\x05level\x18\x02 \x01(\tR\x05level\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\x12\x10\n" +
+	"\x03raw\x18\x04 \x01(\tR\x03raw\".\n" +
+	"\x04Span\x12\x14\n" +
+	"\x05start\x18\x01 \x01(\x05R\x05start\x12\x10\n" +
+	"\x03end\x18\x02 \x01(\x05R\x03end\"\xbe\x01\n" +
+	"\n" +
+	"QueryChunk\x12\x1d\n" +
+	"\n" +
+	"machine_id\x18\x01 \x01(\tR\tmachineId\x12\x1a\n" +
+	"\bfilename\x18\x02 \x01(\tR\bfilename\x12\x18\n" +
+	"\x05lines\x18\x03 \x03(\tB\x02\x18\x01R\x05lines\x120\n" +
+	"\atrailer\x18\x04 \x01(\v2\x16.logquery.QueryTrailerR\atrailer\x12)\n" +
+	"\amatches\x18\x05 \x03(\v2\x0f.logquery.MatchR\amatches\"\xf4\x01\n" +
+	"\fQueryTrailer\x12\x1d\n" +
+	"\n" +
+	"line_count\x18\x01 \x01(\x05R\tlineCount\x12\x14\n" +
+	"\x05error\x18\x02 \x01(\tR\x05error\x12\x18\n" +
+	"\asuccess\x18\x03 \x01(\bR\asuccess\x12*\n" +
+	"\x05files\x18\x04 \x03(\v2\x14.logquery.FileResultR\x05files\x12&\n" +
+	"\x0fnext_page_token\x18\x05 \x01(\tR\rnextPageToken\x12\x1c\n" +
+	"\ttruncated\x18\x06 \x01(\bR\ttruncated\x12#\n" +
+	"\rbytes_scanned\x18\a \x01(\x03R\fbytesScanned\"^\n" +
+	"\x12IndexStatusRequest\x12\x1f\n" +
+	"\vfile_filter\x18\x01 \x01(\tR\n" +
+	"fileFilter\x12'\n" +
+	"\x0finclude_rotated\x18\x02 \x01(\bR\x0eincludeRotated\"\x7f\n" +
+	"\x13IndexStatusResponse\x12\x1d\n" +
+	"\n" +
+	"machine_id\x18\x01 \x01(\tR\tmachineId\x12\x18\n" +
+	"\aenabled\x18\x02 \x01(\bR\aenabled\x12/\n" +
+	"\x05files\x18\x03 \x03(\v2\x19.logquery.FileIndexStatusR\x05files\"\xb8\x02\n" +
+	"\x0fFileIndexStatus\x12\x1a\n" +
+	"\bfilename\x18\x01 \x01(\tR\bfilename\x12*\n" +
+	"\x05state\x18\x02 \x01(\x0e2\x14.logquery.IndexStateR\x05state\x12\x1b\n" +
+	"\tfile_size\x18\x03 \x01(\x03R\bfileSize\x12#\n" +
+	"\rindexed_bytes\x18\x04 \x01(\x03R\findexedBytes\x12\x1b\n" +
+	"\tlag_bytes\x18\x05 \x01(\x03R\blagBytes\x12\x16\n" +
+	"\x06blocks\x18\x06 \x01(\x05R\x06blocks\x124\n" +
+	"\aupdated\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\aupdated\x12\x1a\n" +
+	"\brebuilds\x18\b \x01(\x05R\brebuilds\x12\x14\n" +
+	"\x05error\x18\t \x01(\tR\x05error\"\xad\x01\n" +
+	"\x10AggregateRequest\x12,\n" +
+	"\x05query\x18\x01 \x01(\v2\x16.logquery.QueryRequestR\x05query\x12\x19\n" +
+	"\bgroup_by\x18\x02 \x03(\tR\agroupBy\x121\n" +
+	"\x06bucket\x18\x03 \x01(\v2\x19.google.protobuf.DurationR\x06bucket\x12\x1d\n" +
+	"\n" +
+	"max_groups\x18\x04 \x01(\x05R\tmaxGroups\"\x80\x02\n" +
+	"\x11AggregateResponse\x12\x1d\n" +
+	"\n" +
+	"machine_id\x18\x01 \x01(\tR\tmachineId\x12\x18\n" +
+	"\asuccess\x18\x02 \x01(\bR\asuccess\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\x12\x1d\n" +
+	"\n" +
+	"line_count\x18\x04 \x01(\x03R\tlineCount\x120\n" +
+	"\x06groups\x18\x05 \x03(\v2\x18.logquery.AggregateGroupR\x06groups\x12\x1f\n" +
+	"\vother_count\x18\x06 \x01(\x03R\n" +
+	"otherCount\x12*\n" +
+	"\x05files\x18\a \x03(\v2\x14.logquery.FileResultR\x05files\"r\n" +
+	"\x0eAggregateGroup\x12\x16\n" +
+	"\x06values\x18\x01 \x03(\tR\x06values\x122\n" +
+	"\x06bucket\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x06bucket\x12\x14\n" +
+	"\x05count\x18\x03 \x01(\x03R\x05count\"P\n" +
+	"\x12TopMessagesRequest\x12,\n" +
+	"\x05query\x18\x01 \x01(\v2\x16.logquery.QueryRequestR\x05query\x12\f\n" +
+	"\x01k\x18\x02 \x01(\x05R\x01k\"\x81\x02\n" +
+	"\x13TopMessagesResponse\x12\x1d\n" +
+	"\n" +
+	"machine_id\x18\x01 \x01(\tR\tmachineId\x12\x18\n" +
+	"\asuccess\x18\x02 \x01(\bR\asuccess\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\x12\x1d\n" +
+	"\n" +
+	"line_count\x18\x04 \x01(\x03R\tlineCount\x122\n" +
+	"\bmessages\x18\x05 \x03(\v2\x16.logquery.MessageCountR\bmessages\x12\x1c\n" +
+	"\tthreshold\x18\x06 \x01(\x03R\tthreshold\x12*\n" +
+	"\x05files\x18\a \x03(\v2\x14.logquery.FileResultR\x05files\"n\n" +
+	"\fMessageCount\x12\x18\n" +
+	"\amessage\x18\x01 \x01(\tR\amessage\x12\x14\n" +
+	"\x05count\x18\x02 \x01(\x03R\x05count\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\x03R\x05error\x12\x18\n" +
+	"\aexample\x18\x04 \x01(\tR\aexample\"\x13\n" +
+	"\x11ServerLoadRequest\"\x95\x04\n" +
+	"\x12ServerLoadResponse\x12\x1d\n" +
+	"\n" +
+	"machine_id\x18\x01 \x01(\tR\tmachineId\x12'\n" +
+	"\x0factive_searches\x18\x02 \x01(\x05R\x0eactiveSearches\x12.\n" +
+	"\x13max_active_searches\x18\x03 \x01(\x05R\x11maxActiveSearches\x12'\n" +
+	"\x0fqueued_searches\x18\x04 \x01(\x05R\x0equeuedSearches\x12.\n" +
+	"\x13max_queued_searches\x18\x05 \x01(\x05R\x11maxQueuedSearches\x12\x1a\n" +
+	"\badmitted\x18\x06 \x01(\x03R\badmitted\x12\x1a\n" +
+	"\brejected\x18\a \x01(\x03R\brejected\x12'\n" +
+	"\x0fbudget_exceeded\x18\b \x01(\x03R\x0ebudgetExceeded\x12:\n" +
+	"\vretry_after\x18\t \x01(\v2\x19.google.protobuf.DurationR\n" +
+	"retryAfter\x12&\n" +
+	"\x0fmax_query_bytes\x18\n" +
+	" \x01(\x03R\rmaxQueryBytes\x12=\n" +
+	"\rmax_query_cpu\x18\v \x01(\v2\x19.google.protobuf.DurationR\vmaxQueryCpu\x12*\n" +
+	"\x05cache\x18\f \x01(\v2\x14.logquery.CacheStatsR\x05cache\"\xdf\x01\n" +
+	"\n" +
+	"CacheStats\x12\x18\n" +
+	"\aenabled\x18\x01 \x01(\bR\aenabled\x12\x12\n" +
+	"\x04hits\x18\x02 \x01(\x03R\x04hits\x12!\n" +
+	"\fpartial_hits\x18\x03 \x01(\x03R\vpartialHits\x12\x16\n" +
+	"\x06misses\x18\x04 \x01(\x03R\x06misses\x12\x18\n" +
+	"\aentries\x18\x05 \x01(\x05R\aentries\x12\x14\n" +
+	"\x05bytes\x18\x06 \x01(\x03R\x05bytes\x12\x1a\n" +
+	"\bcapacity\x18\a \x01(\x03R\bcapacity\x12\x1c\n" +
+	"\tevictions\x18\b \x01(\x03R\tevictions\"\x87\x01\n" +
+	"\x10ListFilesRequest\x12\x1f\n" +
+	"\vfile_filter\x18\x01 \x01(\tR\n" +
+	"fileFilter\x12'\n" +
+	"\x0finclude_rotated\x18\x02 \x01(\bR\x0eincludeRotated\x12)\n" +
+	"\x10timestamp_layout\x18\x03 \x01(\tR\x0ftimestampLayout\"[\n" +
+	"\x11ListFilesResponse\x12\x1d\n" +
+	"\n" +
+	"machine_id\x18\x01 \x01(\tR\tmachineId\x12'\n" +
+	"\x05files\x18\x02 \x03(\v2\x11.logquery.LogFileR\x05files\"\x99\x03\n" +
+	"\aLogFile\x12\x1a\n" +
+	"\bfilename\x18\x01 \x01(\tR\bfilename\x12\x12\n" +
+	"\x04size\x18\x02 \x01(\x03R\x04size\x126\n" +
+	"\bmodified\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\bmodified\x12\x14\n" +
+	"\x05lines\x18\x04 \x01(\x03R\x05lines\x12\x1f\n" +
+	"\vlines_exact\x18\x05 \x01(\bR\n" +
+	"linesExact\x12C\n" +
+	"\x0ffirst_timestamp\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\x0efirstTimestamp\x12A\n" +
+	"\x0elast_timestamp\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\rlastTimestamp\x127\n" +
+	"\vcompression\x18\b \x01(\x0e2\x15.logquery.CompressionR\vcompression\x12\x18\n" +
+	"\arotated\x18\t \x01(\bR\arotated\x12\x14\n" +
+	"\x05error\x18\n" +
+	" \x01(\tR\x05error*t\n" +
+	"\x05Level\x12\x15\n" +
+	"\x11LEVEL_UNSPECIFIED\x10\x00\x12\x0f\n" +
+	"\vLEVEL_DEBUG\x10\x01\x12\x0e\n" +
+	"\n" +
+	"LEVEL_INFO\x10\x02\x12\x0e\n" +
+	"\n" +
+	"LEVEL_WARN\x10\x03\x12\x0f\n" +
+	"\vLEVEL_ERROR\x10\x04\x12\x12\n" +
+	"\x0eLEVEL_CRITICAL\x10\x05*X\n" +
+	"\vRegexFlavor\x12\x16\n" +
+	"\x12REGEX_FLAVOR_BASIC\x10\x00\x12\x19\n" +
+	"\x15REGEX_FLAVOR_EXTENDED\x10\x01\x12\x16\n" +
+	"\x12REGEX_FLAVOR_FIXED\x10\x02*\xa7\x01\n" +
+	"\n" +
+	"IndexState\x12\x1b\n" +
+	"\x17INDEX_STATE_UNSPECIFIED\x10\x00\x12\x17\n" +
+	"\x13INDEX_STATE_MISSING\x10\x01\x12\x17\n" +
+	"\x13INDEX_STATE_CURRENT\x10\x02\x12\x16\n" +
+	"\x12INDEX_STATE_BEHIND\x10\x03\x12\x15\n" +
+	"\x11INDEX_STATE_STALE\x10\x04\x12\x1b\n" +
+	"\x17INDEX_STATE_UNSUPPORTED\x10\x05*P\n" +
+	"\vCompression\x12\x14\n" +
+	"\x10COMPRESSION_NONE\x10\x00\x12\x14\n" +
+	"\x10COMPRESSION_GZIP\x10\x01\x12\x15\n" +
+	"\x11COMPRESSION_BZIP2\x10\x022\xb6\x04\n" +
+	"\bLogQuery\x12<\n" +
+	"\tQueryLogs\x12\x16.logquery.QueryRequest\x1a\x17.logquery.QueryResponse\x12A\n" +
+	"\x0fStreamQueryLogs\x12\x16.logquery.QueryRequest\x1a\x14.logquery.QueryChunk0\x01\x12<\n" +
+	"\n" +
+	"FollowLogs\x12\x16.logquery.QueryRequest\x1a\x14.logquery.QueryChunk0\x01\x12D\n" +
+	"\tAggregate\x12\x1a.logquery.AggregateRequest\x1a\x1b.logquery.AggregateResponse\x12J\n" +
+	"\vTopMessages\x12\x1c.logquery.TopMessagesRequest\x1a\x1d.logquery.TopMessagesResponse\x12J\n" +
+	"\vIndexStatus\x12\x1c.logquery.IndexStatusRequest\x1a\x1d.logquery.IndexStatusResponse\x12G\n" +
+	"\n" +
+	"ServerLoad\x12\x1b.logquery.ServerLoadRequest\x1a\x1c.logquery.ServerLoadResponse\x12D\n" +
+	"\tListFiles\x12\x1a.logquery.ListFilesRequest\x1a\x1b.logquery.ListFilesResponseB'Z%github.com/sujayx23/g71_test/logqueryb\x06proto3"
 
 var (
 	file_logquery_proto_rawDescOnce sync.Once
@@ -201,19 +2562,97 @@ func file_logquery_proto_rawDescGZIP() []byte {
 	return file_logquery_proto_rawDescData
 }
 
-var file_logquery_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_logquery_proto_enumTypes = make([]protoimpl.EnumInfo, 4)
+var file_logquery_proto_msgTypes = make([]protoimpl.MessageInfo, 25)
 var file_logquery_proto_goTypes = []any{
-	(*QueryRequest)(nil),  // 0: logquery.QueryRequest
-	(*QueryResponse)(nil), // 1: logquery.QueryResponse
+	(Level)(0),                    // 0: logquery.Level
+	(RegexFlavor)(0),              // 1: logquery.RegexFlavor
+	(IndexState)(0),               // 2: logquery.IndexState
+	(Compression)(0),              // 3: logquery.Compression
+	(*QueryRequest)(nil),          // 4: logquery.QueryRequest
+	(*QueryOptions)(nil),          // 5: logquery.QueryOptions
+	(*QueryResponse)(nil),         // 6: logquery.QueryResponse
+	(*FileResult)(nil),            // 7: logquery.FileResult
+	(*Match)(nil),                 // 8: logquery.Match
+	(*LogRecord)(nil),             // 9: logquery.LogRecord
+	(*Span)(nil),                  // 10: logquery.Span
+	(*QueryChunk)(nil),            // 11: logquery.QueryChunk
+	(*QueryTrailer)(nil),          // 12: logquery.QueryTrailer
+	(*IndexStatusRequest)(nil),    // 13: logquery.IndexStatusRequest
+	(*IndexStatusResponse)(nil),   // 14: logquery.IndexStatusResponse
+	(*FileIndexStatus)(nil),       // 15: logquery.FileIndexStatus
+	(*AggregateRequest)(nil),      // 16: logquery.AggregateRequest
+	(*AggregateResponse)(nil),     // 17: logquery.AggregateResponse
+	(*AggregateGroup)(nil),        // 18: logquery.AggregateGroup
+	(*TopMessagesRequest)(nil),    // 19: logquery.TopMessagesRequest
+	(*TopMessagesResponse)(nil),   // 20: logquery.TopMessagesResponse
+	(*MessageCount)(nil),          // 21: logquery.MessageCount
+	(*ServerLoadRequest)(nil),     // 22: logquery.ServerLoadRequest
+	(*ServerLoadResponse)(nil),    // 23: logquery.ServerLoadResponse
+	(*CacheStats)(nil),            // 24: logquery.CacheStats
+	(*ListFilesRequest)(nil),      // 25: logquery.ListFilesRequest
+	(*ListFilesResponse)(nil),     // 26: logquery.ListFilesResponse
+	(*LogFile)(nil),               // 27: logquery.LogFile
+	nil,                           // 28: logquery.Match.FieldsEntry
+	(*timestamppb.Timestamp)(nil), // 29: google.protobuf.Timestamp
+	(*durationpb.Duration)(nil),   // 30: google.protobuf.Duration
 }
 var file_logquery_proto_depIdxs = []int32{
-	0, // 0: logquery.LogQuery.QueryLogs:input_type -> logquery.QueryRequest
-	1, // 1: logquery.LogQuery.QueryLogs:output_type -> logquery.QueryResponse
-	1, // [1:2] is the sub-list for method output_type
-	0, // [0:1] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	5,  // 0: logquery.QueryRequest.query_options:type_name -> logquery.QueryOptions
+	29, // 1: logquery.QueryRequest.since:type_name -> google.protobuf.Timestamp
+	29, // 2: logquery.QueryRequest.until:type_name -> google.protobuf.Timestamp
+	0,  // 3: logquery.QueryRequest.min_level:type_name -> logquery.Level
+	0,  // 4: logquery.QueryRequest.levels:type_name -> logquery.Level
+	1,  // 5: logquery.QueryOptions.regex_flavor:type_name -> logquery.RegexFlavor
+	7,  // 6: logquery.QueryResponse.files:type_name -> logquery.FileResult
+	8,  // 7: logquery.FileResult.matches:type_name -> logquery.Match
+	10, // 8: logquery.Match.spans:type_name -> logquery.Span
+	9,  // 9: logquery.Match.record:type_name -> logquery.LogRecord
+	28, // 10: logquery.Match.fields:type_name -> logquery.Match.FieldsEntry
+	29, // 11: logquery.LogRecord.timestamp:type_name -> google.protobuf.Timestamp
+	12, // 12: logquery.QueryChunk.trailer:type_name -> logquery.QueryTrailer
+	8,  // 13: logquery.QueryChunk.matches:type_name -> logquery.Match
+	7,  // 14: logquery.QueryTrailer.files:type_name -> logquery.FileResult
+	15, // 15: logquery.IndexStatusResponse.files:type_name -> logquery.FileIndexStatus
+	2,  // 16: logquery.FileIndexStatus.state:type_name -> logquery.IndexState
+	29, // 17: logquery.FileIndexStatus.updated:type_name -> google.protobuf.Timestamp
+	4,  // 18: logquery.AggregateRequest.query:type_name -> logquery.QueryRequest
+	30, // 19: logquery.AggregateRequest.bucket:type_name -> google.protobuf.Duration
+	18, // 20: logquery.AggregateResponse.groups:type_name -> logquery.AggregateGroup
+	7,  // 21: logquery.AggregateResponse.files:type_name -> logquery.FileResult
+	29, // 22: logquery.AggregateGroup.bucket:type_name -> google.protobuf.Timestamp
+	4,  // 23: logquery.TopMessagesRequest.query:type_name -> logquery.QueryRequest
+	21, // 24: logquery.TopMessagesResponse.messages:type_name -> logquery.MessageCount
+	7,  // 25: logquery.TopMessagesResponse.files:type_name -> logquery.FileResult
+	30, // 26: logquery.ServerLoadResponse.retry_after:type_name -> google.protobuf.Duration
+	30, // 27: logquery.ServerLoadResponse.max_query_cpu:type_name -> google.protobuf.Duration
+	24, // 28: logquery.ServerLoadResponse.cache:type_name -> logquery.CacheStats
+	27, // 29: logquery.ListFilesResponse.files:type_name -> logquery.LogFile
+	29, // 30: logquery.LogFile.modified:type_name -> google.protobuf.Timestamp
+	29, // 31: logquery.LogFile.first_timestamp:type_name -> google.protobuf.Timestamp
+	29, // 32: logquery.LogFile.last_timestamp:type_name -> google.protobuf.Timestamp
+	3,  // 33: logquery.LogFile.compression:type_name -> logquery.Compression
+	4,  // 34: logquery.LogQuery.QueryLogs:input_type -> logquery.QueryRequest
+	4,  // 35: logquery.LogQuery.StreamQueryLogs:input_type -> logquery.QueryRequest
+	4,  // 36: logquery.LogQuery.FollowLogs:input_type -> logquery.QueryRequest
+	16, // 37: logquery.LogQuery.Aggregate:input_type -> logquery.AggregateRequest
+	19, // 38: logquery.LogQuery.TopMessages:input_type -> logquery.TopMessagesRequest
+	13, // 39: logquery.LogQuery.IndexStatus:input_type -> logquery.IndexStatusRequest
+	22, // 40: logquery.LogQuery.ServerLoad:input_type -> logquery.ServerLoadRequest
+	25, // 41: logquery.LogQuery.ListFiles:input_type -> logquery.ListFilesRequest
+	6,  // 42: logquery.LogQuery.QueryLogs:output_type -> logquery.QueryResponse
+	11, // 43: logquery.LogQuery.StreamQueryLogs:output_type -> logquery.QueryChunk
+	11, // 44: logquery.LogQuery.FollowLogs:output_type -> logquery.QueryChunk
+	17, // 45: logquery.LogQuery.Aggregate:output_type -> logquery.AggregateResponse
+	20, // 46: logquery.LogQuery.TopMessages:output_type -> logquery.TopMessagesResponse
+	14, // 47: logquery.LogQuery.IndexStatus:output_type -> logquery.IndexStatusResponse
+	23, // 48: logquery.LogQuery.ServerLoad:output_type -> logquery.ServerLoadResponse
+	26, // 49: logquery.LogQuery.ListFiles:output_type -> logquery.ListFilesResponse
+	42, // [42:50] is the sub-list for method output_type
+	34, // [34:42] is the sub-list for method input_type
+	34, // [34:34] is the sub-list for extension type_name
+	34, // [34:34] is the sub-list for extension extendee
+	0,  // [0:34] is the sub-list for field type_name
 }
 
 func init() { file_logquery_proto_init() }
@@ -226,13 +2665,14 @@ func file_logquery_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_logquery_proto_rawDesc), len(file_logquery_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   2,
+			NumEnums:      4,
+			NumMessages:   25,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_logquery_proto_goTypes,
 		DependencyIndexes: file_logquery_proto_depIdxs,
+		EnumInfos:         file_logquery_proto_enumTypes,
 		MessageInfos:      file_logquery_proto_msgTypes,
 	}.Build()
 	File_logquery_proto = out.File
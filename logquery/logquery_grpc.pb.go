@@ -19,7 +19,14 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	LogQuery_QueryLogs_FullMethodName = "/logquery.LogQuery/QueryLogs"
+	LogQuery_QueryLogs_FullMethodName       = "/logquery.LogQuery/QueryLogs"
+	LogQuery_StreamQueryLogs_FullMethodName = "/logquery.LogQuery/StreamQueryLogs"
+	LogQuery_FollowLogs_FullMethodName      = "/logquery.LogQuery/FollowLogs"
+	LogQuery_Aggregate_FullMethodName       = "/logquery.LogQuery/Aggregate"
+	LogQuery_TopMessages_FullMethodName     = "/logquery.LogQuery/TopMessages"
+	LogQuery_IndexStatus_FullMethodName     = "/logquery.LogQuery/IndexStatus"
+	LogQuery_ServerLoad_FullMethodName      = "/logquery.LogQuery/ServerLoad"
+	LogQuery_ListFiles_FullMethodName       = "/logquery.LogQuery/ListFiles"
 )
 
 // LogQueryClient is the client API for LogQuery service.
@@ -30,6 +37,28 @@ const (
 type LogQueryClient interface {
 	// QueryLogs searches for patterns in log files
 	QueryLogs(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (*QueryResponse, error)
+	// StreamQueryLogs searches log files and streams matching lines in
+	// batches, finishing with a trailer that carries the count and status
+	StreamQueryLogs(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[QueryChunk], error)
+	// FollowLogs streams matching lines as they are appended to the live
+	// log files, following each file across rotation, until the caller
+	// cancels. Lines already in the files when it starts are not searched
+	FollowLogs(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[QueryChunk], error)
+	// Aggregate counts the lines a query selects by group, such as by level
+	// or per minute, returning the counts instead of the lines
+	Aggregate(ctx context.Context, in *AggregateRequest, opts ...grpc.CallOption) (*AggregateResponse, error)
+	// TopMessages finds the most frequent messages among the lines a query
+	// selects, after normalizing away numbers, IDs and timestamps
+	TopMessages(ctx context.Context, in *TopMessagesRequest, opts ...grpc.CallOption) (*TopMessagesResponse, error)
+	// IndexStatus reports how far the trigram index of each log file
+	// trails the file itself
+	IndexStatus(ctx context.Context, in *IndexStatusRequest, opts ...grpc.CallOption) (*IndexStatusResponse, error)
+	// ServerLoad reports how busy the server is with searches, so clients
+	// can back off before they are turned away
+	ServerLoad(ctx context.Context, in *ServerLoadRequest, opts ...grpc.CallOption) (*ServerLoadResponse, error)
+	// ListFiles describes the log files the server can search, so clients
+	// can discover them before querying
+	ListFiles(ctx context.Context, in *ListFilesRequest, opts ...grpc.CallOption) (*ListFilesResponse, error)
 }
 
 type logQueryClient struct {
@@ -50,6 +79,94 @@ func (c *logQueryClient) QueryLogs(ctx context.Context, in *QueryRequest, opts .
 	return out, nil
 }
 
+func (c *logQueryClient) StreamQueryLogs(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[QueryChunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &LogQuery_ServiceDesc.Streams[0], LogQuery_StreamQueryLogs_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[QueryRequest, QueryChunk]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type LogQuery_StreamQueryLogsClient = grpc.ServerStreamingClient[QueryChunk]
+
+func (c *logQueryClient) FollowLogs(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[QueryChunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &LogQuery_ServiceDesc.Streams[1], LogQuery_FollowLogs_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[QueryRequest, QueryChunk]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type LogQuery_FollowLogsClient = grpc.ServerStreamingClient[QueryChunk]
+
+func (c *logQueryClient) Aggregate(ctx context.Context, in *AggregateRequest, opts ...grpc.CallOption) (*AggregateResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AggregateResponse)
+	err := c.cc.Invoke(ctx, LogQuery_Aggregate_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logQueryClient) TopMessages(ctx context.Context, in *TopMessagesRequest, opts ...grpc.CallOption) (*TopMessagesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TopMessagesResponse)
+	err := c.cc.Invoke(ctx, LogQuery_TopMessages_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logQueryClient) IndexStatus(ctx context.Context, in *IndexStatusRequest, opts ...grpc.CallOption) (*IndexStatusResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(IndexStatusResponse)
+	err := c.cc.Invoke(ctx, LogQuery_IndexStatus_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logQueryClient) ServerLoad(ctx context.Context, in *ServerLoadRequest, opts ...grpc.CallOption) (*ServerLoadResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ServerLoadResponse)
+	err := c.cc.Invoke(ctx, LogQuery_ServerLoad_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logQueryClient) ListFiles(ctx context.Context, in *ListFilesRequest, opts ...grpc.CallOption) (*ListFilesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListFilesResponse)
+	err := c.cc.Invoke(ctx, LogQuery_ListFiles_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // LogQueryServer is the server API for LogQuery service.
 // All implementations must embed UnimplementedLogQueryServer
 // for forward compatibility.
@@ -58,6 +175,28 @@ func (c *logQueryClient) QueryLogs(ctx context.Context, in *QueryRequest, opts .
 type LogQueryServer interface {
 	// QueryLogs searches for patterns in log files
 	QueryLogs(context.Context, *QueryRequest) (*QueryResponse, error)
+	// StreamQueryLogs searches log files and streams matching lines in
+	// batches, finishing with a trailer that carries the count and status
+	StreamQueryLogs(*QueryRequest, grpc.ServerStreamingServer[QueryChunk]) error
+	// FollowLogs streams matching lines as they are appended to the live
+	// log files, following each file across rotation, until the caller
+	// cancels. Lines already in the files when it starts are not searched
+	FollowLogs(*QueryRequest, grpc.ServerStreamingServer[QueryChunk]) error
+	// Aggregate counts the lines a query selects by group, such as by level
+	// or per minute, returning the counts instead of the lines
+	Aggregate(context.Context, *AggregateRequest) (*AggregateResponse, error)
+	// TopMessages finds the most frequent messages among the lines a query
+	// selects, after normalizing away numbers, IDs and timestamps
+	TopMessages(context.Context, *TopMessagesRequest) (*TopMessagesResponse, error)
+	// IndexStatus reports how far the trigram index of each log file
+	// trails the file itself
+	IndexStatus(context.Context, *IndexStatusRequest) (*IndexStatusResponse, error)
+	// ServerLoad reports how busy the server is with searches, so clients
+	// can back off before they are turned away
+	ServerLoad(context.Context, *ServerLoadRequest) (*ServerLoadResponse, error)
+	// ListFiles describes the log files the server can search, so clients
+	// can discover them before querying
+	ListFiles(context.Context, *ListFilesRequest) (*ListFilesResponse, error)
 	mustEmbedUnimplementedLogQueryServer()
 }
 
@@ -71,6 +210,27 @@ type UnimplementedLogQueryServer struct{}
 func (UnimplementedLogQueryServer) QueryLogs(context.Context, *QueryRequest) (*QueryResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method QueryLogs not implemented")
 }
+func (UnimplementedLogQueryServer) StreamQueryLogs(*QueryRequest, grpc.ServerStreamingServer[QueryChunk]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamQueryLogs not implemented")
+}
+func (UnimplementedLogQueryServer) FollowLogs(*QueryRequest, grpc.ServerStreamingServer[QueryChunk]) error {
+	return status.Errorf(codes.Unimplemented, "method FollowLogs not implemented")
+}
+func (UnimplementedLogQueryServer) Aggregate(context.Context, *AggregateRequest) (*AggregateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Aggregate not implemented")
+}
+func (UnimplementedLogQueryServer) TopMessages(context.Context, *TopMessagesRequest) (*TopMessagesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TopMessages not implemented")
+}
+func (UnimplementedLogQueryServer) IndexStatus(context.Context, *IndexStatusRequest) (*IndexStatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method IndexStatus not implemented")
+}
+func (UnimplementedLogQueryServer) ServerLoad(context.Context, *ServerLoadRequest) (*ServerLoadResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ServerLoad not implemented")
+}
+func (UnimplementedLogQueryServer) ListFiles(context.Context, *ListFilesRequest) (*ListFilesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListFiles not implemented")
+}
 func (UnimplementedLogQueryServer) mustEmbedUnimplementedLogQueryServer() {}
 func (UnimplementedLogQueryServer) testEmbeddedByValue()                  {}
 
@@ -110,6 +270,118 @@ func _LogQuery_QueryLogs_Handler(srv interface{}, ctx context.Context, dec func(
 	return interceptor(ctx, in, info, handler)
 }
 
+func _LogQuery_StreamQueryLogs_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(QueryRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(LogQueryServer).StreamQueryLogs(m, &grpc.GenericServerStream[QueryRequest, QueryChunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type LogQuery_StreamQueryLogsServer = grpc.ServerStreamingServer[QueryChunk]
+
+func _LogQuery_FollowLogs_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(QueryRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(LogQueryServer).FollowLogs(m, &grpc.GenericServerStream[QueryRequest, QueryChunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type LogQuery_FollowLogsServer = grpc.ServerStreamingServer[QueryChunk]
+
+func _LogQuery_Aggregate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AggregateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogQueryServer).Aggregate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LogQuery_Aggregate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogQueryServer).Aggregate(ctx, req.(*AggregateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LogQuery_TopMessages_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TopMessagesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogQueryServer).TopMessages(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LogQuery_TopMessages_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogQueryServer).TopMessages(ctx, req.(*TopMessagesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LogQuery_IndexStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IndexStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogQueryServer).IndexStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LogQuery_IndexStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogQueryServer).IndexStatus(ctx, req.(*IndexStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LogQuery_ServerLoad_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ServerLoadRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogQueryServer).ServerLoad(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LogQuery_ServerLoad_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogQueryServer).ServerLoad(ctx, req.(*ServerLoadRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LogQuery_ListFiles_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListFilesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogQueryServer).ListFiles(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LogQuery_ListFiles_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogQueryServer).ListFiles(ctx, req.(*ListFilesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // LogQuery_ServiceDesc is the grpc.ServiceDesc for LogQuery service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -121,7 +393,38 @@ var LogQuery_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "QueryLogs",
 			Handler:    _LogQuery_QueryLogs_Handler,
 		},
+		{
+			MethodName: "Aggregate",
+			Handler:    _LogQuery_Aggregate_Handler,
+		},
+		{
+			MethodName: "TopMessages",
+			Handler:    _LogQuery_TopMessages_Handler,
+		},
+		{
+			MethodName: "IndexStatus",
+			Handler:    _LogQuery_IndexStatus_Handler,
+		},
+		{
+			MethodName: "ServerLoad",
+			Handler:    _LogQuery_ServerLoad_Handler,
+		},
+		{
+			MethodName: "ListFiles",
+			Handler:    _LogQuery_ListFiles_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamQueryLogs",
+			Handler:       _LogQuery_StreamQueryLogs_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "FollowLogs",
+			Handler:       _LogQuery_FollowLogs_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "logquery.proto",
 }
@@ -0,0 +1,183 @@
+package logsource
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+)
+
+// maxChunk bounds the bytes returned by a single Tail.Poll
+const maxChunk = 1 << 20
+
+// Chunk is a run of lines read from a followed file
+type Chunk struct {
+	Path   string // the file the lines were read from
+	Data   []byte // whole lines, each ending in a newline except possibly the last
+	Offset int64  // byte offset of Data in the file
+	Line   int    // 1-based number of the first line in Data
+}
+
+// Tail follows a live log file as it is appended to. When the file is
+// rotated, the rest of the old file is read before following moves on to
+// the new file at the same path; when it is truncated in place, following
+// starts over from its beginning
+type Tail struct {
+	path   string
+	file   *os.File // nil while nothing exists at path
+	id     FileID
+	offset int64 // offset of the first byte not yet returned
+	line   int   // number of the line starting at offset
+}
+
+// Follow starts following the log at path. With fromStart, the lines
+// already in the file are returned first, as for a log created after
+// following began; otherwise only lines appended from now on are
+func Follow(path string, fromStart bool) (*Tail, error) {
+	compression, err := DetectCompression(path)
+	if err != nil {
+		return nil, err
+	}
+	if compression != None {
+		return nil, &os.PathError{Op: "follow", Path: path, Err: errors.New("compressed files cannot be followed")}
+	}
+
+	t := &Tail{path: path}
+	if err := t.open(); err != nil {
+		return nil, err
+	}
+	if !fromStart {
+		// Skip the complete lines already there, counting them so the
+		// lines that follow are numbered correctly
+		offset, lines, err := completeLines(t.file)
+		if err != nil {
+			t.Close()
+			return nil, &os.PathError{Op: "read", Path: path, Err: err}
+		}
+		t.offset, t.line = offset, lines+1
+	}
+	return t, nil
+}
+
+// Poll returns the next complete lines appended to the file, up to about a
+// megabyte at a time, or an empty chunk when there are none yet. A partial
+// last line is held back until its newline is written, unless the file has
+// been rotated away, in which case it will never be finished
+func (t *Tail) Poll() (Chunk, error) {
+	if t.file == nil {
+		if err := t.open(); err != nil {
+			if os.IsNotExist(err) {
+				return Chunk{Path: t.path}, nil
+			}
+			return Chunk{Path: t.path}, err
+		}
+	}
+
+	info, err := os.Stat(t.path)
+	if err != nil && !os.IsNotExist(err) {
+		return Chunk{Path: t.path}, err
+	}
+	// A missing path is treated like a rotation that has not produced the
+	// new file yet: the old one is finished but not yet let go
+	replaced := err != nil || Identify(info) != t.id
+	if !replaced && info.Size() < t.offset {
+		t.offset, t.line = 0, 1
+	}
+
+	current, err := t.file.Stat()
+	if err != nil {
+		return Chunk{Path: t.path}, err
+	}
+	if current.Size() > t.offset {
+		chunk, err := t.read(current.Size(), replaced)
+		if err != nil || len(chunk.Data) > 0 || !replaced {
+			return chunk, err
+		}
+	}
+	if replaced && info != nil {
+		// The old file is done; move on to its replacement
+		t.file.Close()
+		t.file = nil
+		return t.Poll()
+	}
+	return Chunk{Path: t.path}, nil
+}
+
+// Close stops following the file
+func (t *Tail) Close() error {
+	if t.file == nil {
+		return nil
+	}
+	err := t.file.Close()
+	t.file = nil
+	return err
+}
+
+// open opens the file now at path and starts reading it from the beginning
+func (t *Tail) open() error {
+	file, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	t.file, t.id, t.offset, t.line = file, Identify(info), 0, 1
+	return nil
+}
+
+// read returns the lines between offset and size. With final set, a last
+// line without a newline is returned too
+func (t *Tail) read(size int64, final bool) (Chunk, error) {
+	data := make([]byte, min(size-t.offset, maxChunk))
+	n, err := t.file.ReadAt(data, t.offset)
+	if err != nil && err != io.EOF {
+		return Chunk{Path: t.path}, err
+	}
+	data = data[:n]
+
+	complete := data
+	if end := bytes.LastIndexByte(data, '\n'); end >= 0 {
+		complete = data[:end+1]
+	} else if !final && len(data) < maxChunk {
+		// Only the start of a line so far
+		complete = nil
+	}
+	if final && len(complete) < len(data) && len(data) < maxChunk {
+		complete = data
+	}
+
+	chunk := Chunk{Path: t.path, Data: complete, Offset: t.offset, Line: t.line}
+	t.offset += int64(len(complete))
+	t.line += bytes.Count(complete, []byte{'\n'})
+	if len(complete) > 0 && complete[len(complete)-1] != '\n' {
+		t.line++
+	}
+	return chunk, nil
+}
+
+// completeLines returns the offset just past the last newline in r and the
+// number of lines before it
+func completeLines(r io.Reader) (int64, int, error) {
+	reader := bufio.NewReaderSize(r, 64*1024)
+	var offset, end int64
+	lines := 0
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		offset += int64(len(chunk))
+		if err == nil {
+			end = offset
+			lines++
+			continue
+		}
+		if err == io.EOF {
+			return end, lines, nil
+		}
+		if err != bufio.ErrBufferFull {
+			return 0, 0, err
+		}
+	}
+}
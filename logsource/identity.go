@@ -0,0 +1,16 @@
+package logsource
+
+import "os"
+
+// FileID identifies a file independently of its name, so a log can still be
+// recognized after rotation renames it. The zero FileID means the identity
+// is unknown
+type FileID struct {
+	Device uint64
+	Inode  uint64
+}
+
+// Identify returns the identity of the file described by info
+func Identify(info os.FileInfo) FileID {
+	return identify(info)
+}
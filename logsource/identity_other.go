@@ -0,0 +1,10 @@
+//go:build !unix
+
+package logsource
+
+import "os"
+
+// identify cannot tell files apart on platforms without inode numbers
+func identify(info os.FileInfo) FileID {
+	return FileID{}
+}
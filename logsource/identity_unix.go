@@ -0,0 +1,16 @@
+//go:build unix
+
+package logsource
+
+import (
+	"os"
+	"syscall"
+)
+
+func identify(info os.FileInfo) FileID {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return FileID{}
+	}
+	return FileID{Device: uint64(stat.Dev), Inode: uint64(stat.Ino)}
+}
@@ -0,0 +1,152 @@
+// Package logsource resolves the log locations a server is configured with
+// (plain paths, glob patterns and directories) into the files it searches
+package logsource
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Set is the configured collection of log locations for a server
+type Set struct {
+	patterns []string
+}
+
+// NewSet creates a set from file paths, glob patterns or directories.
+// Directories contribute every regular file directly inside them
+func NewSet(patterns []string) *Set {
+	return &Set{patterns: append([]string(nil), patterns...)}
+}
+
+// Patterns returns the configured locations
+func (s *Set) Patterns() []string {
+	return append([]string(nil), s.patterns...)
+}
+
+// Log is a live log file together with its rotated history
+type Log struct {
+	Path    string   // Live log file
+	Rotated []string // Rotated copies, oldest first
+}
+
+// Files returns the files making up the log in chronological order. Rotated
+// history is included only when requested
+func (l Log) Files(includeRotated bool) []string {
+	if !includeRotated {
+		return []string{l.Path}
+	}
+	return append(append([]string(nil), l.Rotated...), l.Path)
+}
+
+// Logs expands the configured locations into the live logs they contain,
+// each with its rotated siblings attached. A rotated copy picked up directly,
+// for example by a directory entry, is folded into its live log rather than
+// reported separately
+func (s *Set) Logs() ([]Log, error) {
+	files, err := s.files()
+	if err != nil {
+		return nil, err
+	}
+
+	logs := make([]Log, 0, len(files))
+	rotated := make(map[string]bool)
+	for _, file := range files {
+		siblings := rotatedSiblings(file)
+		for _, sibling := range siblings {
+			rotated[filepath.Clean(sibling)] = true
+		}
+		logs = append(logs, Log{Path: file, Rotated: siblings})
+	}
+
+	live := logs[:0]
+	for _, l := range logs {
+		if !rotated[l.Path] {
+			live = append(live, l)
+		}
+	}
+	return live, nil
+}
+
+// files expands the configured locations into the sorted, de-duplicated
+// list of regular files that currently exist
+func (s *Set) files() ([]string, error) {
+	seen := make(map[string]bool)
+	files := []string{}
+
+	add := func(path string) {
+		path = filepath.Clean(path)
+		if !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+
+	for _, pattern := range s.patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid log pattern %q: %v", pattern, err)
+		}
+
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				continue
+			}
+			if info.Mode().IsRegular() {
+				add(match)
+				continue
+			}
+			if !info.IsDir() {
+				continue
+			}
+
+			entries, err := os.ReadDir(match)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read log directory %s: %v", match, err)
+			}
+			for _, entry := range entries {
+				if entry.Type().IsRegular() {
+					add(filepath.Join(match, entry.Name()))
+				}
+			}
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// ValidateFilter reports whether filter is a well-formed glob pattern
+func ValidateFilter(filter string) error {
+	if _, err := filepath.Match(filter, ""); err != nil {
+		return fmt.Errorf("invalid file filter %q: %v", filter, err)
+	}
+	return nil
+}
+
+// Filter returns the logs whose live path or base name matches the glob
+// filter. An empty filter selects every log
+func Filter(logs []Log, filter string) []Log {
+	if filter == "" {
+		return logs
+	}
+
+	selected := []Log{}
+	for _, l := range logs {
+		if matchesFilter(l.Path, filter) {
+			selected = append(selected, l)
+		}
+	}
+	return selected
+}
+
+// matchesFilter reports whether the glob filter matches file's path or base name
+func matchesFilter(file, filter string) bool {
+	if ok, _ := filepath.Match(filter, file); ok {
+		return true
+	}
+	ok, _ := filepath.Match(filter, filepath.Base(file))
+	return ok
+}
@@ -0,0 +1,244 @@
+package logsource
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Compression identifies how a log file is stored on disk
+type Compression int
+
+const (
+	// None is a plain text file
+	None Compression = iota
+	// Gzip is a gzip-compressed file
+	Gzip
+	// Bzip2 is a bzip2-compressed file
+	Bzip2
+)
+
+// String returns the conventional name of the compression format
+func (c Compression) String() string {
+	switch c {
+	case Gzip:
+		return "gzip"
+	case Bzip2:
+		return "bzip2"
+	default:
+		return "none"
+	}
+}
+
+// compressedExts are the file extensions logrotate uses for compressed logs
+var compressedExts = []string{".gz", ".bz2"}
+
+// rotatedSibling describes a file produced by rotating a live log
+type rotatedSibling struct {
+	path  string
+	index int    // numeric suffix for name.N style rotation, 0 otherwise
+	date  string // date suffix for name-YYYYMMDD style rotation
+}
+
+// rotatedSiblings returns the rotated copies of the live log at path, oldest
+// first. Both numbered (app.log.1, app.log.2.gz) and dated
+// (app.log-20240115.gz) rotation schemes are recognized
+func rotatedSiblings(path string) []string {
+	candidates, _ := filepath.Glob(path + ".*")
+	dated, _ := filepath.Glob(path + "-*")
+	candidates = append(candidates, dated...)
+
+	siblings := []rotatedSibling{}
+	for _, candidate := range candidates {
+		if sibling, ok := parseRotated(path, candidate); ok {
+			if info, err := os.Stat(candidate); err == nil && info.Mode().IsRegular() {
+				siblings = append(siblings, sibling)
+			}
+		}
+	}
+
+	// Dated copies sort by date; numbered copies are older the higher the
+	// number. Dated copies are placed first, as the two schemes do not mix
+	sort.Slice(siblings, func(i, j int) bool {
+		a, b := siblings[i], siblings[j]
+		if (a.date != "") != (b.date != "") {
+			return a.date != ""
+		}
+		if a.date != "" {
+			return a.date < b.date
+		}
+		return a.index > b.index
+	})
+
+	paths := make([]string, len(siblings))
+	for i, sibling := range siblings {
+		paths[i] = sibling.path
+	}
+	return paths
+}
+
+// parseRotated reports whether candidate is a rotated copy of the live log
+// at path and, if so, how it sorts
+func parseRotated(path, candidate string) (rotatedSibling, bool) {
+	suffix := strings.TrimPrefix(candidate, path)
+	for _, ext := range compressedExts {
+		suffix = strings.TrimSuffix(suffix, ext)
+	}
+	if len(suffix) < 2 {
+		return rotatedSibling{}, false
+	}
+
+	digits := suffix[1:]
+	if _, err := strconv.ParseUint(digits, 10, 64); err != nil {
+		return rotatedSibling{}, false
+	}
+
+	switch suffix[0] {
+	case '.':
+		index, _ := strconv.Atoi(digits)
+		return rotatedSibling{path: candidate, index: index}, true
+	case '-':
+		return rotatedSibling{path: candidate, date: digits}, true
+	default:
+		return rotatedSibling{}, false
+	}
+}
+
+// Open opens a log file for reading, transparently decompressing gzip and
+// bzip2 files. The format is detected from the file contents, so it does not
+// depend on the extension
+func Open(path string) (*File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(file)
+	compression, err := sniff(reader)
+	if err != nil {
+		file.Close()
+		return nil, &os.PathError{Op: "read", Path: path, Err: err}
+	}
+
+	f := &File{path: path, file: file, buffered: reader, compression: compression}
+	switch compression {
+	case Gzip:
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			file.Close()
+			return nil, &os.PathError{Op: "gunzip", Path: path, Err: err}
+		}
+		f.reader = gz
+	case Bzip2:
+		f.reader = bzip2.NewReader(reader)
+	default:
+		f.reader = reader
+	}
+	return f, nil
+}
+
+// DetectCompression reports how the file at path is compressed
+func DetectCompression(path string) (Compression, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return None, err
+	}
+	defer file.Close()
+	return sniff(bufio.NewReader(file))
+}
+
+// sniff identifies the compression format from the leading magic bytes
+func sniff(reader *bufio.Reader) (Compression, error) {
+	magic, err := reader.Peek(3)
+	if err != nil && err != io.EOF {
+		return None, err
+	}
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return Gzip, nil
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		return Bzip2, nil
+	default:
+		return None, nil
+	}
+}
+
+// File is an open log file, read through a decompressor when needed. Read
+// errors are reported as *os.PathError so callers can attribute them to the
+// file
+type File struct {
+	path        string
+	file        *os.File
+	buffered    *bufio.Reader
+	reader      io.Reader
+	compression Compression
+}
+
+// Stat returns the FileInfo of the file on disk
+func (f *File) Stat() (os.FileInfo, error) {
+	return f.file.Stat()
+}
+
+// Compression reports how the file is stored on disk
+func (f *File) Compression() Compression {
+	return f.compression
+}
+
+// ReaderAt gives random access to an uncompressed file along with its size.
+// It reports false for compressed files, which can only be read in order
+func (f *File) ReaderAt() (io.ReaderAt, int64, bool) {
+	if f.compression != None {
+		return nil, 0, false
+	}
+	info, err := f.file.Stat()
+	if err != nil {
+		return nil, 0, false
+	}
+	return f.file, info.Size(), true
+}
+
+// SeekTo moves the read position to offset in the uncompressed contents.
+// Compressed files cannot seek, so they are decompressed up to offset
+// instead, which only works before anything else has been read
+func (f *File) SeekTo(offset int64) error {
+	if f.compression != None {
+		if _, err := io.CopyN(io.Discard, f, offset); err != nil {
+			if err == io.EOF {
+				err = &os.PathError{Op: "seek", Path: f.path, Err: errors.New("offset is past the end of the file")}
+			}
+			return err
+		}
+		return nil
+	}
+	if _, err := f.file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	f.buffered.Reset(f.file)
+	return nil
+}
+
+func (f *File) Read(p []byte) (int, error) {
+	n, err := f.reader.Read(p)
+	if err != nil && err != io.EOF {
+		if _, ok := err.(*os.PathError); !ok {
+			err = &os.PathError{Op: "read", Path: f.path, Err: err}
+		}
+	}
+	return n, err
+}
+
+// Close releases the decompressor, if any, and the underlying file
+func (f *File) Close() error {
+	if closer, ok := f.reader.(io.Closer); ok {
+		closer.Close()
+	}
+	return f.file.Close()
+}
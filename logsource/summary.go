@@ -0,0 +1,178 @@
+package logsource
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"time"
+)
+
+// summarySample is how much of a plain file is read from each end to
+// describe it
+const summarySample = 64 << 10
+
+// Summary describes the contents of a log file
+type Summary struct {
+	Path        string
+	Size        int64 // size on disk
+	ModTime     time.Time
+	ID          FileID
+	Compression Compression
+	Lines       int64 // number of lines, estimated unless LinesExact
+	LinesExact  bool
+	First, Last time.Time // timestamps of the first and last lines that have one; zero if none was found
+}
+
+// Summarize describes the file at path, using timestamp to parse the
+// leading timestamp of its lines. Plain files are sampled at both ends, so
+// the line count of a file larger than the samples is extrapolated from
+// the first one. Compressed files cannot be sampled at the end and are read
+// in full. The bytes read are reported to charge, when given, and an error
+// it returns stops the summary
+func Summarize(path string, timestamp func(line []byte) (time.Time, bool), charge func(n int) error) (Summary, error) {
+	if charge == nil {
+		charge = func(int) error { return nil }
+	}
+	file, err := Open(path)
+	if err != nil {
+		return Summary{}, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return Summary{}, err
+	}
+	summary := Summary{
+		Path:        path,
+		Size:        info.Size(),
+		ModTime:     info.ModTime(),
+		ID:          Identify(info),
+		Compression: file.Compression(),
+	}
+
+	readerAt, size, ok := file.ReaderAt()
+	if !ok {
+		return summary, summarizeStream(&summary, file, timestamp, charge)
+	}
+	summary.Size = size
+
+	head := make([]byte, min(size, summarySample))
+	if _, err := readerAt.ReadAt(head, 0); err != nil && err != io.EOF {
+		return summary, &os.PathError{Op: "read", Path: path, Err: err}
+	}
+	if err := charge(len(head)); err != nil {
+		return summary, err
+	}
+	summary.First = firstTimestamp(head, timestamp)
+	summary.Lines = countLines(head)
+	if int64(len(head)) == size {
+		summary.LinesExact = true
+		summary.Last = lastTimestamp(head, timestamp)
+		return summary, nil
+	}
+	newlines := int64(bytes.Count(head, []byte{'\n'}))
+	summary.Lines = max(size*newlines/int64(len(head)), 1)
+
+	tail := make([]byte, summarySample)
+	if _, err := readerAt.ReadAt(tail, size-summarySample); err != nil && err != io.EOF {
+		return summary, &os.PathError{Op: "read", Path: path, Err: err}
+	}
+	if err := charge(len(tail)); err != nil {
+		return summary, err
+	}
+	// The sample most likely starts within a line
+	if i := bytes.IndexByte(tail, '\n'); i >= 0 {
+		tail = tail[i+1:]
+	}
+	summary.Last = lastTimestamp(tail, timestamp)
+	return summary, nil
+}
+
+// summarizeStream reads a file that cannot be sampled from start to end,
+// counting its lines and keeping its tail for the last timestamp
+func summarizeStream(summary *Summary, r io.Reader, timestamp func(line []byte) (time.Time, bool), charge func(n int) error) error {
+	buf := make([]byte, summarySample)
+	var tail []byte // the last bytes read, up to twice the sample
+	var read int64
+	for {
+		n, err := io.ReadFull(r, buf)
+		if chargeErr := charge(n); chargeErr != nil {
+			return chargeErr
+		}
+		chunk := buf[:n]
+		if read == 0 {
+			summary.First = firstTimestamp(chunk, timestamp)
+		}
+		read += int64(n)
+		summary.Lines += int64(bytes.Count(chunk, []byte{'\n'}))
+		tail = append(tail, chunk...)
+		if excess := len(tail) - 2*summarySample; excess > 0 {
+			tail = append(tail[:0], tail[excess:]...)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(tail) > 0 && tail[len(tail)-1] != '\n' {
+		summary.Lines++
+	}
+	summary.LinesExact = true
+	if read > int64(len(tail)) {
+		// The tail most likely starts within a line
+		if i := bytes.IndexByte(tail, '\n'); i >= 0 {
+			tail = tail[i+1:]
+		}
+	}
+	summary.Last = lastTimestamp(tail, timestamp)
+	return nil
+}
+
+// countLines counts the lines in data, including a last one without a
+// newline
+func countLines(data []byte) int64 {
+	lines := int64(bytes.Count(data, []byte{'\n'}))
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		lines++
+	}
+	return lines
+}
+
+// firstTimestamp returns the timestamp of the first line in data that has
+// one, or zero
+func firstTimestamp(data []byte, timestamp func(line []byte) (time.Time, bool)) time.Time {
+	for len(data) > 0 {
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i], data[i+1:]
+		} else {
+			data = nil
+		}
+		if t, ok := timestamp(line); ok {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// lastTimestamp returns the timestamp of the last line in data that has
+// one, or zero
+func lastTimestamp(data []byte, timestamp func(line []byte) (time.Time, bool)) time.Time {
+	data = bytes.TrimSuffix(data, []byte{'\n'})
+	for len(data) > 0 {
+		line := data
+		if i := bytes.LastIndexByte(data, '\n'); i >= 0 {
+			line, data = data[i+1:], data[:i]
+		} else {
+			data = nil
+		}
+		if t, ok := timestamp(line); ok {
+			return t
+		}
+	}
+	return time.Time{}
+}
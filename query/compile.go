@@ -0,0 +1,132 @@
+package query
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/sujayx23/g71_test/search"
+)
+
+// Compile turns a parsed query into a matcher. Words and phrases are
+// matched as fixed strings and regexps as extended regular expressions;
+// opts.IgnoreCase, opts.WordRegexp and opts.LineRegexp apply to every term,
+// while opts.Mode and opts.Invert are ignored. The spans reported for a line
+// are those of the terms that contributed to it matching
+func Compile(node Node, opts search.Options) (search.Matcher, error) {
+	switch n := node.(type) {
+	case *Term:
+		m, err := search.NewMatcher(n.Text, TermOptions(n, opts))
+		if err != nil {
+			return nil, &SyntaxError{Pos: n.Pos, Msg: err.Error()}
+		}
+		return m, nil
+	case *And:
+		left, right, err := compilePair(n.Left, n.Right, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &andMatcher{left: left, right: right}, nil
+	case *Or:
+		left, right, err := compilePair(n.Left, n.Right, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &orMatcher{left: left, right: right}, nil
+	case *Not:
+		x, err := Compile(n.X, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &notMatcher{x: x}, nil
+	default:
+		return nil, fmt.Errorf("unknown query node %T", node)
+	}
+}
+
+// TermOptions returns the options Compile matches term with, given the
+// options for the whole query
+func TermOptions(term *Term, opts search.Options) search.Options {
+	opts.Invert = false
+	opts.Mode = search.FixedString
+	if term.Kind == Regexp {
+		opts.Mode = search.ExtendedRegexp
+	}
+	return opts
+}
+
+func compilePair(l, r Node, opts search.Options) (search.Matcher, search.Matcher, error) {
+	left, err := Compile(l, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	right, err := Compile(r, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return left, right, nil
+}
+
+type andMatcher struct {
+	left, right search.Matcher
+}
+
+func (m *andMatcher) Match(line []byte) bool {
+	return m.left.Match(line) && m.right.Match(line)
+}
+
+func (m *andMatcher) FindAll(line []byte) [][]int {
+	if !m.Match(line) {
+		return nil
+	}
+	return mergeSpans(m.left.FindAll(line), m.right.FindAll(line))
+}
+
+type orMatcher struct {
+	left, right search.Matcher
+}
+
+func (m *orMatcher) Match(line []byte) bool {
+	return m.left.Match(line) || m.right.Match(line)
+}
+
+func (m *orMatcher) FindAll(line []byte) [][]int {
+	return mergeSpans(m.left.FindAll(line), m.right.FindAll(line))
+}
+
+// notMatcher matches lines its operand does not. Nothing in such a line is
+// highlighted, since the match is the absence of text
+type notMatcher struct {
+	x search.Matcher
+}
+
+func (m *notMatcher) Match(line []byte) bool {
+	return !m.x.Match(line)
+}
+
+func (m *notMatcher) FindAll(line []byte) [][]int {
+	return nil
+}
+
+// mergeSpans combines two sets of spans into one ordered set, joining spans
+// that overlap so highlighting never nests
+func mergeSpans(a, b [][]int) [][]int {
+	if len(a) == 0 {
+		return b
+	}
+	if len(b) == 0 {
+		return a
+	}
+	all := append(append(make([][]int, 0, len(a)+len(b)), a...), b...)
+	sort.Slice(all, func(i, j int) bool { return all[i][0] < all[j][0] })
+
+	merged := [][]int{{all[0][0], all[0][1]}}
+	for _, span := range all[1:] {
+		last := merged[len(merged)-1]
+		if span[0] <= last[1] {
+			last[1] = max(last[1], span[1])
+		} else {
+			merged = append(merged, []int{span[0], span[1]})
+		}
+	}
+	return merged
+}
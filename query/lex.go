@@ -0,0 +1,140 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokTerm
+	tokAnd
+	tokOr
+	tokNot
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	pos  int
+	term *Term // set for tokTerm
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of query"
+	case tokTerm:
+		return fmt.Sprintf("term %s", t.term)
+	case tokAnd:
+		return "AND"
+	case tokOr:
+		return "OR"
+	case tokNot:
+		return "NOT"
+	case tokLParen:
+		return "'('"
+	default:
+		return "')'"
+	}
+}
+
+// keywords are the operators; they must be written in upper case, so
+// lower-case "and" or "not" are ordinary words
+var keywords = map[string]tokenKind{
+	"AND": tokAnd,
+	"OR":  tokOr,
+	"NOT": tokNot,
+}
+
+// lex splits src into tokens, ending with a tokEOF
+func lex(src string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for {
+		for i < len(src) && isSpace(src[i]) {
+			i++
+		}
+		if i == len(src) {
+			return append(tokens, token{kind: tokEOF, pos: i}), nil
+		}
+
+		start := i
+		switch c := src[i]; c {
+		case '(':
+			tokens = append(tokens, token{kind: tokLParen, pos: i})
+			i++
+		case ')':
+			tokens = append(tokens, token{kind: tokRParen, pos: i})
+			i++
+		case '"', '/':
+			text, end, err := lexDelimited(src, i, c)
+			if err != nil {
+				return nil, err
+			}
+			kind := Phrase
+			if c == '/' {
+				kind = Regexp
+			}
+			if text == "" {
+				return nil, &SyntaxError{Pos: start, Msg: fmt.Sprintf("empty %s", describe(kind))}
+			}
+			tokens = append(tokens, token{kind: tokTerm, pos: start, term: &Term{Kind: kind, Text: text, Pos: start}})
+			i = end
+		default:
+			for i < len(src) && !isSpace(src[i]) && !strings.ContainsRune(`()"`, rune(src[i])) {
+				i++
+			}
+			word := src[start:i]
+			if kind, ok := keywords[word]; ok {
+				tokens = append(tokens, token{kind: kind, pos: start})
+			} else {
+				tokens = append(tokens, token{kind: tokTerm, pos: start, term: &Term{Kind: Word, Text: word, Pos: start}})
+			}
+		}
+	}
+}
+
+// lexDelimited reads a phrase or regexp starting at the opening delimiter
+// src[start]. A backslash escapes the delimiter; in phrases it also escapes
+// a backslash, while regexps keep every other escape for the regexp engine.
+// It returns the unescaped text and the offset just past the closing
+// delimiter
+func lexDelimited(src string, start int, delim byte) (string, int, error) {
+	var text strings.Builder
+	for i := start + 1; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == delim:
+			return text.String(), i + 1, nil
+		case c == '\\' && i+1 < len(src) && (src[i+1] == delim || (delim == '"' && src[i+1] == '\\')):
+			i++
+			text.WriteByte(src[i])
+		default:
+			text.WriteByte(c)
+		}
+	}
+	kind := Phrase
+	if delim == '/' {
+		kind = Regexp
+	}
+	return "", 0, &SyntaxError{Pos: start, Msg: fmt.Sprintf("unterminated %s", describe(kind))}
+}
+
+func describe(kind TermKind) string {
+	switch kind {
+	case Phrase:
+		return "phrase"
+	case Regexp:
+		return "regexp"
+	default:
+		return "word"
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
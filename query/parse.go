@@ -0,0 +1,243 @@
+// Package query parses boolean search expressions such as
+//
+//	ERROR AND (database OR "connection pool") NOT /time(d )?out/
+//
+// and compiles them into matchers evaluated against each log line.
+//
+// Bare words and "quoted phrases" match literally, /slashed/ terms are
+// extended regular expressions, and terms combine with AND, OR, NOT and
+// parentheses. NOT binds tightest and OR loosest; terms written next to each
+// other are implicitly ANDed, so "ERROR database NOT timeout" is the same as
+// "ERROR AND database AND NOT timeout"
+package query
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Node is a node of a parsed query expression
+type Node interface {
+	// String returns the node in canonical, fully parenthesized form
+	String() string
+}
+
+// TermKind tells the different kinds of leaf terms apart
+type TermKind int
+
+const (
+	// Word is a bare word, matched literally
+	Word TermKind = iota
+	// Phrase is a double-quoted string, matched literally
+	Phrase
+	// Regexp is a /slash-delimited/ extended regular expression
+	Regexp
+)
+
+// Term is a leaf of the expression
+type Term struct {
+	Kind TermKind
+	Text string // the word, the unquoted phrase or the regexp source
+	Pos  int    // byte offset of the term in the query
+}
+
+func (t *Term) String() string {
+	switch t.Kind {
+	case Phrase:
+		return fmt.Sprintf("%q", t.Text)
+	case Regexp:
+		return "/" + strings.ReplaceAll(t.Text, "/", `\/`) + "/"
+	default:
+		return t.Text
+	}
+}
+
+// And matches lines matched by both sides
+type And struct {
+	Left, Right Node
+}
+
+func (n *And) String() string {
+	return "(" + n.Left.String() + " AND " + n.Right.String() + ")"
+}
+
+// Or matches lines matched by either side
+type Or struct {
+	Left, Right Node
+}
+
+func (n *Or) String() string {
+	return "(" + n.Left.String() + " OR " + n.Right.String() + ")"
+}
+
+// Not matches lines its operand does not match
+type Not struct {
+	X Node
+}
+
+func (n *Not) String() string {
+	return "NOT " + n.X.String()
+}
+
+// Negated reports whether node can select lines by what they lack rather
+// than by a term they contain, as -v does: whether some line matching none
+// of its terms could match it. NOT is harmless ANDed with a positive term,
+// as in "ERROR NOT timeout", but not on its own or ORed with others
+func Negated(node Node) bool {
+	return !bounded(node)
+}
+
+// bounded reports whether every line matching node contains one of its
+// terms
+func bounded(node Node) bool {
+	switch n := node.(type) {
+	case *And:
+		return bounded(n.Left) || bounded(n.Right)
+	case *Or:
+		return bounded(n.Left) && bounded(n.Right)
+	case *Not:
+		return coBounded(n.X)
+	default:
+		return true
+	}
+}
+
+// coBounded reports whether every line not matching node contains one of
+// its terms, that is whether NOT node is bounded
+func coBounded(node Node) bool {
+	switch n := node.(type) {
+	case *And:
+		return coBounded(n.Left) && coBounded(n.Right)
+	case *Or:
+		return coBounded(n.Left) || coBounded(n.Right)
+	case *Not:
+		return bounded(n.X)
+	default:
+		return false
+	}
+}
+
+// SyntaxError reports a malformed query and where in it the problem is
+type SyntaxError struct {
+	Pos int // byte offset of the offending token in the query
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("column %d: %s", e.Pos+1, e.Msg)
+}
+
+// Parse parses a query expression into its syntax tree. Errors are
+// returned as *SyntaxError
+func Parse(src string) (Node, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	if p.peek().kind == tokEOF {
+		return nil, &SyntaxError{Pos: 0, Msg: "empty query"}
+	}
+
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("unexpected %s", tok)}
+	}
+	return node, nil
+}
+
+// parser is a recursive descent parser over the grammar
+//
+//	or   = and { "OR" and }
+//	and  = not { ["AND"] not }
+//	not  = "NOT" not | atom
+//	atom = term | "(" or ")"
+type parser struct {
+	tokens []token
+	next   int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) advance() token {
+	tok := p.tokens[p.next]
+	if tok.kind != tokEOF {
+		p.next++
+	}
+	return tok
+}
+
+func (p *parser) parseOr() (Node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOr {
+		p.advance()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &Or{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch p.peek().kind {
+		case tokAnd:
+			p.advance()
+		case tokTerm, tokNot, tokLParen:
+			// Adjacent operands are implicitly ANDed
+		default:
+			return left, nil
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &And{Left: left, Right: right}
+	}
+}
+
+func (p *parser) parseNot() (Node, error) {
+	if p.peek().kind == tokNot {
+		p.advance()
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{X: x}, nil
+	}
+	return p.parseAtom()
+}
+
+func (p *parser) parseAtom() (Node, error) {
+	tok := p.advance()
+	switch tok.kind {
+	case tokTerm:
+		return tok.term, nil
+	case tokLParen:
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.advance(); closing.kind != tokRParen {
+			return nil, &SyntaxError{Pos: closing.pos,
+				Msg: fmt.Sprintf("expected ')' to close '(' at column %d, found %s", tok.pos+1, closing)}
+		}
+		return node, nil
+	default:
+		return nil, &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("expected a term, found %s", tok)}
+	}
+}
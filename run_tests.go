@@ -1,23 +1,50 @@
 package main
 
 import (
+	"compress/gzip"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"math/big"
+	"net"
 	"os"
 	"os/exec"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
+	"github.com/sujayx23/g71_test/aggregate"
+	"github.com/sujayx23/g71_test/grepopts"
 	pb "github.com/sujayx23/g71_test/logquery"
+	"github.com/sujayx23/g71_test/tlsconfig"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 // ServerConfig represents a server configuration
 type ServerConfig struct {
 	MachineID string
 	Address   string
+	PageToken string // continues a paginated query where this server's last page stopped
 }
 
 // QueryResult represents the result from a single server
@@ -41,8 +68,9 @@ func NewLogQueryClient(servers []ServerConfig, timeout time.Duration) *LogQueryC
 	}
 }
 
-// QueryAllServers queries all configured servers concurrently
-func (c *LogQueryClient) QueryAllServers(pattern, options string) []QueryResult {
+// QueryAllServers queries all configured servers concurrently. req is used
+// as a template; each server receives a copy addressed to its machine ID
+func (c *LogQueryClient) QueryAllServers(req *pb.QueryRequest) []QueryResult {
 	var wg sync.WaitGroup
 	results := make([]QueryResult, len(c.servers))
 	resultChan := make(chan QueryResult, len(c.servers))
@@ -52,7 +80,7 @@ func (c *LogQueryClient) QueryAllServers(pattern, options string) []QueryResult
 		wg.Add(1)
 		go func(index int, srv ServerConfig) {
 			defer wg.Done()
-			result := c.queryServer(srv, pattern, options)
+			result := c.queryServer(srv, req)
 			result.MachineID = srv.MachineID
 			resultChan <- result
 		}(i, server)
@@ -79,7 +107,7 @@ func (c *LogQueryClient) QueryAllServers(pattern, options string) []QueryResult
 }
 
 // queryServer queries a single server
-func (c *LogQueryClient) queryServer(server ServerConfig, pattern, options string) QueryResult {
+func (c *LogQueryClient) queryServer(server ServerConfig, template *pb.QueryRequest) QueryResult {
 	// Create context with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
 	defer cancel()
@@ -97,10 +125,10 @@ func (c *LogQueryClient) queryServer(server ServerConfig, pattern, options strin
 	client := pb.NewLogQueryClient(conn)
 
 	// Create request
-	req := &pb.QueryRequest{
-		Pattern:   pattern,
-		Options:   options,
-		MachineId: server.MachineID,
+	req := proto.Clone(template).(*pb.QueryRequest)
+	req.MachineId = server.MachineID
+	if server.PageToken != "" {
+		req.PageToken = server.PageToken
 	}
 
 	// Execute query
@@ -145,6 +173,31 @@ func main() {
 	testGrepOptions()
 	testFaultTolerance()
 	testCountOnlyMode()
+	testStreamingQuery()
+	testLongLines()
+	testOptionValidation()
+	testContextLines()
+	testTimeRange()
+	testParsedRecords()
+	testLevelFilter()
+	testBooleanQuery()
+	testAggregate()
+	testFieldExtraction()
+	testMultipleSources()
+	testRotatedLogs()
+	testQueryTimeLimit()
+	testPagination()
+	testPagedContext()
+	testIndexedSearch()
+	testIndexTracking()
+	testFollow()
+	testTopMessages()
+	testAdmissionControl()
+	testResultCache()
+	testListFiles()
+	testHealth()
+	testTLS()
+	testAuthorization()
 
 	fmt.Println("\n=== All Tests Completed ===")
 }
@@ -416,6 +469,41 @@ func testGrepOptions() {
 		"8082": 10,
 	}
 	verifyResults(results, expectedCounts, "timestamp regex")
+
+	// The cases below are where a translation of grep syntax to Go regexp
+	// is easiest to get wrong; the counts are those of GNU grep on the
+	// same logs
+	grepCases := []struct {
+		name, pattern, options string
+		counts                 [3]int
+	}{
+		{"whole word", "process", "-w -i", [3]int{1, 2, 0}},
+		{"whole word, not within a longer word", "user", "-w", [3]int{0, 0, 0}},
+		{"whole word, case-sensitive", "Cache", "-w", [3]int{2, 0, 0}},
+		{"whole word, shorter than the longest match", "key[a-z ]*", "-w -E", [3]int{1, 0, 0}},
+		{"whole word, longest match that is a word", "Request[a-z ]*", "-w -E", [3]int{0, 0, 2}},
+		{"whole line", ".*ERROR: [A-Za-z ]*", "-x", [3]int{4, 4, 3}},
+		{"whole line, unanchored pattern", "ERROR", "-x", [3]int{0, 0, 0}},
+		{"fixed string dot", ".", "-F", [3]int{1, 0, 0}},
+		{"fixed string bracket", "[0-9]", "-F", [3]int{0, 0, 0}},
+		{"basic alternation", `WARN\|CRITICAL`, "", [3]int{4, 3, 2}},
+		{"extended escaped bar is literal", `WARN\|CRITICAL`, "-E", [3]int{0, 0, 0}},
+		{"basic one or more", `^[0-9-]\+ [0-9:]\+ WARN`, "", [3]int{3, 2, 2}},
+		{"basic plus is literal", `^[0-9-]+ [0-9:]+ WARN`, "", [3]int{0, 0, 0}},
+		{"basic interval", `l\{2\}`, "", [3]int{2, 1, 1}},
+		{"basic braces are literal", `l{2}`, "", [3]int{0, 0, 0}},
+		{"extended interval", `l{2}`, "-E", [3]int{2, 1, 1}},
+		{"basic interval on s", `s\{2\}`, "", [3]int{3, 6, 3}},
+	}
+	for _, tc := range grepCases {
+		fmt.Printf("Testing %s (%s %q)...\n", tc.name, tc.options, tc.pattern)
+		results = queryServers(tc.pattern, tc.options)
+		verifyResults(results, map[string]int{
+			"8080": tc.counts[0],
+			"8081": tc.counts[1],
+			"8082": tc.counts[2],
+		}, tc.name)
+	}
 }
 
 // testFaultTolerance tests fault tolerance
@@ -469,74 +557,1975 @@ func testCountOnlyMode() {
 	verifyResults(results, expectedCounts, "ERROR (count-only)")
 }
 
-// queryServers queries the specified servers with the given pattern and options
-func queryServers(pattern, options string, servers ...string) []QueryResult {
-	if len(servers) == 0 {
-		servers = []string{"localhost:8080", "localhost:8081", "localhost:8082"}
+// testStreamingQuery tests that streamed batches add up to the trailer count
+func testStreamingQuery() {
+	fmt.Println("\n--- Testing Streaming Query ---")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conn, err := grpc.Dial("localhost:8080", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		fmt.Printf("❌ Failed to connect: %v\n", err)
+		return
 	}
+	defer conn.Close()
 
-	serverConfigs := make([]ServerConfig, len(servers))
-	for i, addr := range servers {
-		parts := strings.Split(addr, ":")
-		machineID := "1"
-		if len(parts) > 1 {
-			machineID = parts[1]
-		}
+	stream, err := pb.NewLogQueryClient(conn).StreamQueryLogs(ctx, &pb.QueryRequest{Pattern: "ERROR"})
+	if err != nil {
+		fmt.Printf("❌ Streaming query failed: %v\n", err)
+		return
+	}
 
-		serverConfigs[i] = ServerConfig{
-			MachineID: machineID,
-			Address:   addr,
+	streamed := 0
+	for {
+		chunk, err := stream.Recv()
+		if err != nil {
+			fmt.Printf("❌ Stream ended without a trailer: %v\n", err)
+			return
 		}
+		streamed += len(chunk.Matches)
+		if chunk.Trailer != nil {
+			if !chunk.Trailer.Success || int(chunk.Trailer.LineCount) != streamed || streamed != 5 {
+				fmt.Printf("❌ Expected 5 streamed lines, got %d (trailer: %d, success: %v)\n",
+					streamed, chunk.Trailer.LineCount, chunk.Trailer.Success)
+				return
+			}
+			fmt.Printf("✅ Streamed %d lines matching the trailer count\n", streamed)
+			return
+		}
+	}
+}
+
+// testOptionValidation tests typed options and rejection of raw grep options
+// testLongLines checks that a line far longer than the read buffer is cut
+// down to the longest line kept, without losing track of the lines after it
+func testLongLines() {
+	fmt.Println("\n--- Testing Long Lines ---")
+
+	if err := os.MkdirAll("longlogs", 0755); err != nil {
+		fmt.Printf("❌ Failed to create test log directory: %v\n", err)
+		return
+	}
+	defer os.RemoveAll("longlogs")
+
+	long := "2024-01-15 10:00:00 ERROR: dump " + strings.Repeat("x", 3<<20) + " needle"
+	writeLogFile("longlogs/app.log", []string{long, "2024-01-15 10:00:01 ERROR: after the dump needle"})
+
+	cmd := exec.Command("./server-grpc", "-machine=21", "-port=8101", "-logs=longlogs/app.log")
+	if err := cmd.Start(); err != nil {
+		fmt.Printf("❌ Failed to start server: %v\n", err)
+		return
+	}
+	defer cmd.Process.Kill()
+	time.Sleep(1 * time.Second)
+
+	conn, err := grpc.Dial("localhost:8101", grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(16<<20)))
+	if err != nil {
+		fmt.Printf("❌ Failed to connect: %v\n", err)
+		return
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client := pb.NewLogQueryClient(conn)
+
+	// The end of the long line is past what is kept, so only the next line
+	// has the needle, at its true line number and offset
+	resp, err := client.QueryLogs(ctx, &pb.QueryRequest{Pattern: "needle"})
+	if err != nil || !resp.Success || resp.LineCount != 1 || len(resp.Files) != 1 || len(resp.Files[0].Matches) != 1 {
+		fmt.Printf("❌ Expected only the line after the long one to match, got %v (%v)\n", resp.GetLineCount(), err)
+		return
+	}
+	if match := resp.Files[0].Matches[0]; match.LineNumber != 2 || match.ByteOffset != int64(len(long)+1) {
+		fmt.Printf("❌ Expected the match on line 2 at offset %d, got line %d at %d\n", len(long)+1, match.LineNumber, match.ByteOffset)
+		return
+	}
+
+	resp, err = client.QueryLogs(ctx, &pb.QueryRequest{Pattern: "dump x"})
+	if err != nil || resp.LineCount != 1 || len(resp.Files[0].Matches) != 1 || len(resp.Files[0].Matches[0].Line) > 1<<20 {
+		fmt.Printf("❌ Expected the long line cut to 1 MiB, got %v (%v)\n", resp.GetLineCount(), err)
+	} else {
+		fmt.Printf("✅ %d-byte line cut to %d bytes; later lines keep their numbers and offsets\n", len(long), len(resp.Files[0].Matches[0].Line))
+	}
+}
+
+func testOptionValidation() {
+	fmt.Println("\n--- Testing Option Validation ---")
+
+	// Test max count
+	fmt.Println("Testing max count...")
+	results := queryServers("ERROR", "-m 2")
+	expectedCounts := map[string]int{
+		"8080": 2,
+		"8081": 2,
+		"8082": 2,
+	}
+	verifyResults(results, expectedCounts, "ERROR (max count)")
+
+	// Test that raw options such as -f are refused by the server
+	fmt.Println("Testing raw option rejection...")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conn, err := grpc.Dial("localhost:8080", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		fmt.Printf("❌ Failed to connect: %v\n", err)
+		return
+	}
+	defer conn.Close()
+
+	_, err = pb.NewLogQueryClient(conn).QueryLogs(ctx, &pb.QueryRequest{
+		Pattern: "root",
+		Options: "-f /etc/passwd",
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		fmt.Printf("❌ Expected InvalidArgument for raw options, got %v\n", err)
+	} else {
+		fmt.Println("✅ Raw grep options rejected with InvalidArgument")
+	}
+}
+
+// testContextLines tests that context is returned alongside each match
+func testContextLines() {
+	fmt.Println("\n--- Testing Context Lines ---")
+
+	results := queryServers("Authentication", "-C 1", "localhost:8080")
+	if len(results) != 1 || results[0].Response == nil || len(results[0].Response.Files) != 1 {
+		fmt.Printf("❌ Expected a single file result from machine 8080\n")
+		return
+	}
+
+	matches := results[0].Response.Files[0].Matches
+	if len(matches) != 1 {
+		fmt.Printf("❌ Expected 1 match, got %d\n", len(matches))
+		return
+	}
+
+	match := matches[0]
+	if match.LineNumber != 10 || len(match.Before) != 1 || len(match.After) != 1 ||
+		!strings.Contains(match.Before[0], "Backup completed") ||
+		!strings.Contains(match.After[0], "Cache hit") {
+		fmt.Printf("❌ Unexpected match context: %v\n", match)
+		return
+	}
+	fmt.Println("✅ Match returned with line number and before/after context")
+
+	// The match span and byte offset must point at the matched text
+	content, err := os.ReadFile("vm1.log")
+	if err != nil {
+		fmt.Printf("❌ Failed to read vm1.log: %v\n", err)
+		return
+	}
+	start := strings.Index(match.Line, "Authentication")
+	if len(match.Spans) != 1 || int(match.Spans[0].Start) != start || int(match.Spans[0].End) != start+len("Authentication") ||
+		!strings.HasPrefix(string(content[match.ByteOffset:]), match.Line) {
+		fmt.Printf("❌ Unexpected span or offset: spans=%v offset=%d\n", match.Spans, match.ByteOffset)
+		return
 	}
+	fmt.Println("✅ Match span and byte offset point at the matched text")
+}
 
+// testTimeRange tests filtering by the timestamp at the start of each line
+func testTimeRange() {
+	fmt.Println("\n--- Testing Time Range ---")
+
+	since := time.Date(2024, 1, 15, 10, 30, 20, 0, time.Local)
+	until := time.Date(2024, 1, 15, 10, 31, 20, 0, time.Local)
+
+	serverConfigs := []ServerConfig{
+		{MachineID: "8080", Address: "localhost:8080"},
+		{MachineID: "8081", Address: "localhost:8081"},
+		{MachineID: "8082", Address: "localhost:8082"},
+	}
 	client := NewLogQueryClient(serverConfigs, 10*time.Second)
-	return client.QueryAllServers(pattern, options)
+	results := client.QueryAllServers(&pb.QueryRequest{
+		Pattern: "ERROR",
+		Since:   timestamppb.New(since),
+		Until:   timestamppb.New(until),
+	})
+	expectedCounts := map[string]int{
+		"8080": 3, // 10:30:21, 10:30:24 and 10:30:28
+		"8081": 2, // 10:31:16 and 10:31:18
+		"8082": 0, // vm3.log starts at 10:32:15
+	}
+	verifyResults(results, expectedCounts, "ERROR (time range)")
 }
 
-// verifyResults verifies that the query results match expected counts
-func verifyResults(results []QueryResult, expectedCounts map[string]int, testName string) {
-	totalExpected := 0
-	for _, count := range expectedCounts {
-		totalExpected += count
+// testParsedRecords tests that matches can carry parsed log records
+func testParsedRecords() {
+	fmt.Println("\n--- Testing Parsed Records ---")
+
+	serverConfigs := []ServerConfig{{MachineID: "8080", Address: "localhost:8080"}}
+	client := NewLogQueryClient(serverConfigs, 10*time.Second)
+	results := client.QueryAllServers(&pb.QueryRequest{Pattern: "Database", ParseRecords: true})
+	if len(results) != 1 || results[0].Response == nil || len(results[0].Response.Files) != 1 ||
+		len(results[0].Response.Files[0].Matches) != 1 {
+		fmt.Printf("❌ Expected a single match from machine 8080\n")
+		return
 	}
 
-	totalActual := 0
-	successCount := 0
+	record := results[0].Response.Files[0].Matches[0].Record
+	expected := time.Date(2024, 1, 15, 10, 30, 16, 0, time.Local)
+	if record == nil || record.Level != "ERROR" || record.Message != "Database connection failed" ||
+		record.Timestamp == nil || !record.Timestamp.AsTime().Equal(expected) {
+		fmt.Printf("❌ Unexpected parsed record: %v\n", record)
+		return
+	}
+	fmt.Println("✅ Match parsed into timestamp, level and message")
+}
 
-	for _, result := range results {
-		if result.Error != nil {
-			fmt.Printf("Server %s error: %v\n", result.MachineID, result.Error)
-			continue
+// testMultipleSources tests a server configured with a directory of logs
+func testLevelFilter() {
+	fmt.Println("\n--- Testing Level Filter ---")
+
+	serverConfigs := []ServerConfig{
+		{MachineID: "8080", Address: "localhost:8080"},
+		{MachineID: "8081", Address: "localhost:8081"},
+		{MachineID: "8082", Address: "localhost:8082"},
+	}
+	client := NewLogQueryClient(serverConfigs, 10*time.Second)
+
+	results := client.QueryAllServers(&pb.QueryRequest{Pattern: "Database", MinLevel: pb.Level_LEVEL_ERROR})
+	verifyResults(results, map[string]int{"8080": 1, "8081": 1, "8082": 0}, "Database at ERROR and above")
+
+	results = client.QueryAllServers(&pb.QueryRequest{Pattern: "Database", Levels: []pb.Level{pb.Level_LEVEL_CRITICAL}})
+	verifyResults(results, map[string]int{"8080": 0, "8081": 1, "8082": 0}, "Database at CRITICAL only")
+
+	results = client.QueryAllServers(&pb.QueryRequest{Pattern: ".", MinLevel: pb.Level_LEVEL_WARN})
+	verifyResults(results, map[string]int{"8080": 9, "8081": 7, "8082": 5}, "All lines at WARN and above")
+
+	// A minimum and an explicit set are mutually exclusive
+	results = NewLogQueryClient(serverConfigs[:1], 10*time.Second).QueryAllServers(&pb.QueryRequest{
+		Pattern:  "ERROR",
+		MinLevel: pb.Level_LEVEL_WARN,
+		Levels:   []pb.Level{pb.Level_LEVEL_ERROR},
+	})
+	if results[0].Error == nil {
+		fmt.Printf("❌ Expected min_level with levels to be rejected\n")
+	} else {
+		fmt.Println("✅ Conflicting level filters rejected")
+	}
+}
+
+func testBooleanQuery() {
+	fmt.Println("\n--- Testing Boolean Query ---")
+
+	serverConfigs := []ServerConfig{
+		{MachineID: "8080", Address: "localhost:8080"},
+		{MachineID: "8081", Address: "localhost:8081"},
+		{MachineID: "8082", Address: "localhost:8082"},
+	}
+	client := NewLogQueryClient(serverConfigs, 10*time.Second)
+	results := client.QueryAllServers(&pb.QueryRequest{Query: `ERROR (failed OR /[Tt]imeout/) NOT "Database"`})
+	expectedCounts := map[string]int{
+		"8080": 2, // Network timeout occurred, Authentication failed
+		"8081": 2, // Queue processing failed, Timeout waiting for response
+		"8082": 0,
+	}
+	verifyResults(results, expectedCounts, "ERROR (failed OR /[Tt]imeout/) NOT \"Database\"")
+
+	// Syntax errors are reported with their position
+	results = NewLogQueryClient(serverConfigs[:1], 10*time.Second).QueryAllServers(&pb.QueryRequest{Query: "ERROR AND (timeout"})
+	if len(results) != 1 || results[0].Response == nil || results[0].Response.Success ||
+		!strings.Contains(results[0].Response.Error, "column 19") {
+		fmt.Printf("❌ Expected a positioned syntax error, got %+v\n", results[0])
+	} else {
+		fmt.Printf("✅ Syntax error reported: %s\n", results[0].Response.Error)
+	}
+}
+
+func testMultipleSources() {
+	fmt.Println("\n--- Testing Multiple Log Sources ---")
+
+	if err := os.MkdirAll("testlogs", 0755); err != nil {
+		fmt.Printf("❌ Failed to create test log directory: %v\n", err)
+		return
+	}
+	defer os.RemoveAll("testlogs")
+
+	writeLogFile("testlogs/app.log", []string{
+		"2024-01-15 10:33:15 INFO: Application started",
+		"2024-01-15 10:33:16 ERROR: Payment gateway unreachable",
+		"2024-01-15 10:33:17 ERROR: Retry budget exhausted",
+	})
+	writeLogFile("testlogs/access.log", []string{
+		"2024-01-15 10:33:15 INFO: GET /health 200",
+		"2024-01-15 10:33:16 ERROR: GET /checkout 502",
+	})
+
+	cmd := exec.Command("./server-grpc", "-machine=4", "-port=8083", "-logs=testlogs")
+	if err := cmd.Start(); err != nil {
+		fmt.Printf("❌ Failed to start server 4: %v\n", err)
+		return
+	}
+	defer cmd.Process.Kill()
+	time.Sleep(1 * time.Second)
+
+	// Test that every file in the directory is searched
+	fmt.Println("Testing directory source...")
+	results := queryServers("ERROR", "", "localhost:8083")
+	verifyResults(results, map[string]int{"8083": 3}, "ERROR (directory)")
+	if len(results) == 1 && results[0].Response != nil && len(results[0].Response.Files) != 2 {
+		fmt.Printf("❌ Expected 2 per-file results, got %d\n", len(results[0].Response.Files))
+	}
+
+	// Test the file filter
+	fmt.Println("Testing file filter...")
+	serverConfigs := []ServerConfig{{MachineID: "8083", Address: "localhost:8083"}}
+	client := NewLogQueryClient(serverConfigs, 10*time.Second)
+	results = client.QueryAllServers(&pb.QueryRequest{Pattern: "ERROR", FileFilter: "access*"})
+	verifyResults(results, map[string]int{"8083": 1}, "ERROR (file filter)")
+}
+
+// testRotatedLogs tests searching rotated and compressed log history
+func testRotatedLogs() {
+	fmt.Println("\n--- Testing Rotated Logs ---")
+
+	if err := os.MkdirAll("rotlogs", 0755); err != nil {
+		fmt.Printf("❌ Failed to create test log directory: %v\n", err)
+		return
+	}
+	defer os.RemoveAll("rotlogs")
+
+	writeLogFile("rotlogs/app.log", []string{"2024-01-15 10:34:17 ERROR: Live failure"})
+	writeLogFile("rotlogs/app.log.1", []string{"2024-01-14 09:00:00 ERROR: Yesterday's failure"})
+
+	// Write the oldest copy gzip-compressed, as logrotate would
+	gzFile, err := os.Create("rotlogs/app.log.2.gz")
+	if err != nil {
+		fmt.Printf("❌ Failed to create compressed log: %v\n", err)
+		return
+	}
+	gz := gzip.NewWriter(gzFile)
+	gz.Write([]byte("2024-01-13 08:00:00 ERROR: Oldest failure\n"))
+	gz.Close()
+	gzFile.Close()
+
+	cmd := exec.Command("./server-grpc", "-machine=5", "-port=8084", "-logs=rotlogs")
+	if err := cmd.Start(); err != nil {
+		fmt.Printf("❌ Failed to start server 5: %v\n", err)
+		return
+	}
+	defer cmd.Process.Kill()
+	time.Sleep(1 * time.Second)
+
+	serverConfigs := []ServerConfig{{MachineID: "8084", Address: "localhost:8084"}}
+	client := NewLogQueryClient(serverConfigs, 10*time.Second)
+
+	// Test that only the live file is searched by default
+	fmt.Println("Testing live log only...")
+	results := client.QueryAllServers(&pb.QueryRequest{Pattern: "ERROR"})
+	verifyResults(results, map[string]int{"8084": 1}, "ERROR (live only)")
+
+	// Test that rotated history is searched oldest first
+	fmt.Println("Testing rotated history...")
+	results = client.QueryAllServers(&pb.QueryRequest{Pattern: "ERROR", IncludeRotated: true})
+	verifyResults(results, map[string]int{"8084": 3}, "ERROR (rotated)")
+	if len(results) == 1 && results[0].Response != nil {
+		order := []string{}
+		for _, file := range results[0].Response.Files {
+			order = append(order, file.Filename)
 		}
+		expected := "rotlogs/app.log.2.gz,rotlogs/app.log.1,rotlogs/app.log"
+		if strings.Join(order, ",") != expected {
+			fmt.Printf("❌ Expected files in order %s, got %s\n", expected, strings.Join(order, ","))
+		} else {
+			fmt.Println("✅ Rotated files searched in chronological order")
+		}
+	}
+}
 
-		if !result.Response.Success {
-			fmt.Printf("Server %s failed: %s\n", result.MachineID, result.Response.Error)
-			continue
+func testQueryTimeLimit() {
+	fmt.Println("\n--- Testing Query Time Limit ---")
+
+	// A limit this small expires before the first file is opened
+	cmd := exec.Command("./server-grpc", "-machine=1", "-port=8085", "-max-query-time=1ns")
+	if err := cmd.Start(); err != nil {
+		fmt.Printf("❌ Failed to start limited server: %v\n", err)
+		return
+	}
+	defer cmd.Process.Kill()
+	time.Sleep(1 * time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := grpc.Dial("localhost:8085", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		fmt.Printf("❌ Failed to connect: %v\n", err)
+		return
+	}
+	defer conn.Close()
+
+	_, err = pb.NewLogQueryClient(conn).QueryLogs(ctx, &pb.QueryRequest{Pattern: "ERROR"})
+	if status.Code(err) != codes.DeadlineExceeded || !strings.Contains(err.Error(), "server") {
+		fmt.Printf("❌ Expected DeadlineExceeded from the server limit, got %v\n", err)
+	} else {
+		fmt.Println("✅ Server query time limit reported as DeadlineExceeded")
+	}
+}
+
+func testPagination() {
+	fmt.Println("\n--- Testing Pagination ---")
+
+	if err := os.MkdirAll("pagelogs", 0755); err != nil {
+		fmt.Printf("❌ Failed to create test log directory: %v\n", err)
+		return
+	}
+	defer os.RemoveAll("pagelogs")
+
+	writeLogFile("pagelogs/app.log", []string{
+		"2024-01-15 10:40:01 ERROR: first",
+		"2024-01-15 10:40:02 INFO: skipped",
+		"2024-01-15 10:40:03 ERROR: second",
+		"2024-01-15 10:40:04 ERROR: third",
+		"2024-01-15 10:40:05 ERROR: fourth",
+		"2024-01-15 10:40:06 ERROR: fifth",
+	})
+
+	cmd := exec.Command("./server-grpc", "-machine=7", "-port=8086", "-logs=pagelogs/app.log")
+	if err := cmd.Start(); err != nil {
+		fmt.Printf("❌ Failed to start server 7: %v\n", err)
+		return
+	}
+	defer cmd.Process.Kill()
+	time.Sleep(1 * time.Second)
+
+	server := ServerConfig{MachineID: "8086", Address: "localhost:8086"}
+	req := &pb.QueryRequest{Pattern: "ERROR", MaxResults: 2, IncludeRotated: true}
+	var seen []string
+	fetch := func() *pb.QueryResponse {
+		results := NewLogQueryClient([]ServerConfig{server}, 10*time.Second).QueryAllServers(req)
+		if results[0].Error != nil || !results[0].Response.Success {
+			fmt.Printf("❌ Page query failed: %v %v\n", results[0].Error, results[0].Response)
+			return nil
+		}
+		response := results[0].Response
+		for _, file := range response.Files {
+			for _, match := range file.Matches {
+				seen = append(seen, match.Line[strings.Index(match.Line, ": ")+2:])
+			}
 		}
+		server.PageToken = response.NextPageToken
+		return response
+	}
 
-		successCount++
-		actualCount := int(result.Response.LineCount)
-		totalActual += actualCount
+	// First page, then more lines are appended before the second
+	if response := fetch(); response == nil || !response.Truncated {
+		fmt.Printf("❌ Expected the first page to be truncated\n")
+		return
+	}
+	testForgedPageToken(server.PageToken, req)
+	appendFile, _ := os.OpenFile("pagelogs/app.log", os.O_APPEND|os.O_WRONLY, 0644)
+	appendFile.WriteString("2024-01-15 10:40:07 ERROR: sixth\n2024-01-15 10:40:08 ERROR: seventh\n")
+	appendFile.Close()
+	if response := fetch(); response == nil || !response.Truncated {
+		fmt.Printf("❌ Expected the second page to be truncated\n")
+		return
+	}
 
-		expectedCount, exists := expectedCounts[result.MachineID]
-		if !exists {
-			fmt.Printf("❌ Test %s: Unexpected machine ID: %s\n", testName, result.MachineID)
-			continue
+	// Rotate the log; the cursor follows the file to its new name
+	os.Rename("pagelogs/app.log", "pagelogs/app.log.1")
+	writeLogFile("pagelogs/app.log", []string{"2024-01-15 10:41:00 ERROR: eighth"})
+	if response := fetch(); response == nil || !response.Truncated {
+		fmt.Printf("❌ Expected the third page to be truncated\n")
+		return
+	}
+	if response := fetch(); response == nil || response.Truncated || response.NextPageToken != "" {
+		fmt.Printf("❌ Expected the fourth page to be the last\n")
+		return
+	}
+
+	expected := "first,second,third,fourth,fifth,sixth,seventh,eighth"
+	if strings.Join(seen, ",") != expected {
+		fmt.Printf("❌ Expected pages to cover %s, got %s\n", expected, strings.Join(seen, ","))
+	} else {
+		fmt.Println("✅ Pages resumed across appends and rotation without gaps or repeats")
+	}
+}
+
+// testForgedPageToken checks that the pagination server rejects a token
+// whose cursor was rewritten to point back at the start of the file, as well
+// as a cursor with no signature at all
+func testForgedPageToken(token string, template *pb.QueryRequest) {
+	cursor, signature, ok := strings.Cut(token, ".")
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	fields := map[string]any{}
+	if !ok || err != nil || json.Unmarshal(data, &fields) != nil {
+		fmt.Printf("❌ Page token %q is not a signed cursor\n", token)
+		return
+	}
+	fields["o"], fields["l"] = 0, 0
+	data, _ = json.Marshal(fields)
+	rewritten := base64.RawURLEncoding.EncodeToString(data)
+
+	conn, err := grpc.Dial("localhost:8086", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		fmt.Printf("❌ Failed to connect: %v\n", err)
+		return
+	}
+	defer conn.Close()
+	client := pb.NewLogQueryClient(conn)
+
+	for _, forged := range []string{rewritten + "." + signature, rewritten} {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		req := proto.Clone(template).(*pb.QueryRequest)
+		req.MachineId = "8086"
+		req.PageToken = forged
+		_, err := client.QueryLogs(ctx, req)
+		cancel()
+		if status.Code(err) != codes.InvalidArgument {
+			fmt.Printf("❌ Expected InvalidArgument for a forged page token, got %v\n", err)
+			return
 		}
+	}
+	fmt.Println("✅ Forged and unsigned page tokens rejected with InvalidArgument")
+}
 
-		if actualCount != expectedCount {
-			fmt.Printf("❌ Test %s: Machine %s expected %d lines, got %d\n",
-				testName, result.MachineID, expectedCount, actualCount)
+// testPagedContext checks that pages of one match each carry the same
+// context lines as the unpaged result, including where context lines
+// around neighbouring matches overlap
+func testPagedContext() {
+	fmt.Println("\n--- Testing Context Across Pages ---")
+
+	conn, err := grpc.Dial("localhost:8080", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		fmt.Printf("❌ Failed to connect: %v\n", err)
+		return
+	}
+	defer conn.Close()
+	client := pb.NewLogQueryClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req := &pb.QueryRequest{Pattern: "ERROR", QueryOptions: &pb.QueryOptions{BeforeContext: 2, AfterContext: 1}}
+	unpaged, err := client.QueryLogs(ctx, req)
+	if err != nil || !unpaged.Success || len(unpaged.Files) != 1 {
+		fmt.Printf("❌ Unpaged query failed: %v %v\n", unpaged, err)
+		return
+	}
+	want := unpaged.Files[0].Matches
+
+	var got []*pb.Match
+	req.MaxResults = 1
+	for page := 0; page < len(want)+1; page++ {
+		resp, err := client.QueryLogs(ctx, req)
+		if err != nil || !resp.Success {
+			fmt.Printf("❌ Page query failed: %v %v\n", resp, err)
 			return
 		}
+		for _, file := range resp.Files {
+			got = append(got, file.Matches...)
+		}
+		if resp.NextPageToken == "" {
+			break
+		}
+		req.PageToken = resp.NextPageToken
 	}
 
-	if totalActual != totalExpected {
-		fmt.Printf("❌ Test %s: Total expected %d lines, got %d\n",
-			testName, totalExpected, totalActual)
+	same := len(got) == len(want)
+	for i := 0; same && i < len(got); i++ {
+		same = proto.Equal(got[i], want[i])
+	}
+	if !same {
+		fmt.Printf("❌ Expected pages to repeat the unpaged matches and context\n  want %v\n  got  %v\n", want, got)
+	} else {
+		fmt.Printf("✅ %d pages of one match carry the same context as the unpaged result\n", len(got))
+	}
+}
+
+func testIndexedSearch() {
+	fmt.Println("\n--- Testing Indexed Search ---")
+
+	if err := os.MkdirAll("idxlogs", 0755); err != nil {
+		fmt.Printf("❌ Failed to create test log directory: %v\n", err)
 		return
 	}
+	defer os.RemoveAll("idxlogs")
 
-	fmt.Printf("✅ Test %s passed: %d successful servers, %d total lines\n",
-		testName, successCount, totalActual)
+	// About 1.5 MB of log, several index blocks, with one rare line
+	lines := make([]string, 0, 30000)
+	for i := 0; i < 30000; i++ {
+		lines = append(lines, fmt.Sprintf("2024-01-15 10:%02d:%02d INFO: Request %d served in %dms", i/60%60, i%60, i, i%97))
+	}
+	lines[12345] = "2024-01-15 10:25:45 ERROR: Checksum mismatch on shard 7"
+	writeLogFile("idxlogs/app.log", lines)
+
+	cmd := exec.Command("./server-grpc", "-machine=8", "-port=8087", "-logs=idxlogs/app.log", "-index-dir=idxlogs/.index")
+	if err := cmd.Start(); err != nil {
+		fmt.Printf("❌ Failed to start server 8: %v\n", err)
+		return
+	}
+	defer cmd.Process.Kill()
+
+	// The index is built in the background; wait for queries to use it
+	client := NewLogQueryClient([]ServerConfig{{MachineID: "8087", Address: "localhost:8087"}}, 10*time.Second)
+	var response *pb.QueryResponse
+	for attempt := 0; attempt < 20; attempt++ {
+		time.Sleep(250 * time.Millisecond)
+		results := client.QueryAllServers(&pb.QueryRequest{Pattern: "Checksum mismatch"})
+		if results[0].Response != nil && len(results[0].Response.Files) == 1 && results[0].Response.Files[0].Indexed {
+			response = results[0].Response
+			break
+		}
+	}
+	if response == nil {
+		fmt.Printf("❌ Index was not used within 5 seconds\n")
+		return
+	}
+
+	info, _ := os.Stat("idxlogs/app.log")
+	match := response.Files[0].Matches
+	if response.LineCount != 1 || len(match) != 1 || match[0].LineNumber != 12346 {
+		fmt.Printf("❌ Expected the indexed search to find line 12346, got %v\n", response)
+	} else if response.BytesScanned >= info.Size()/2 {
+		fmt.Printf("❌ Expected the index to prune most of the file, scanned %d of %d bytes\n", response.BytesScanned, info.Size())
+	} else {
+		fmt.Printf("✅ Indexed search scanned %d of %d bytes\n", response.BytesScanned, info.Size())
+	}
+
+	// Inverted matches cannot use the index
+	results := client.QueryAllServers(&pb.QueryRequest{Pattern: "INFO", QueryOptions: &pb.QueryOptions{Invert: true}})
+	verifyResults(results, map[string]int{"8087": 1}, "INFO (inverted, full scan)")
+
+	// Truncated in place and grown back past its indexed size before the
+	// next refresh, the file no longer matches its index, which must not
+	// be used to prune it
+	lines = lines[:0]
+	for i := 50000; i < 81000; i++ {
+		lines = append(lines, fmt.Sprintf("2024-01-15 11:%02d:%02d INFO: Request %d served in %dms", i/60%60, i%60, i, i%97))
+	}
+	lines[25000] = "2024-01-15 11:56:40 ERROR: Checksum mismatch on shard 9"
+	writeLogFile("idxlogs/app.log", lines)
+	results = client.QueryAllServers(&pb.QueryRequest{Pattern: "Checksum mismatch"})
+	if response := results[0].Response; results[0].Error != nil || response == nil || response.LineCount != 1 ||
+		len(response.Files) != 1 || response.Files[0].Indexed || response.Files[0].Matches[0].LineNumber != 25001 {
+		fmt.Printf("❌ Expected a full scan to find line 25001 after truncation, got %v (%v)\n", response, results[0].Error)
+	} else {
+		fmt.Println("✅ Stale index ignored after the file was truncated and regrown; found line 25001")
+	}
+}
+
+func testIndexTracking() {
+	fmt.Println("\n--- Testing Index Tracking ---")
+
+	if err := os.MkdirAll("trackidx", 0755); err != nil {
+		fmt.Printf("❌ Failed to create test log directory: %v\n", err)
+		return
+	}
+	defer os.RemoveAll("trackidx")
+
+	logLines := func(from, to int) []string {
+		var lines []string
+		for i := from; i < to; i++ {
+			lines = append(lines, fmt.Sprintf("2024-01-15 11:%02d:%02d INFO: Heartbeat %d ok", i/60%60, i%60, i))
+		}
+		return lines
+	}
+	writeLogFile("trackidx/app.log", logLines(0, 20000))
+
+	cmd := exec.Command("./server-grpc", "-machine=9", "-port=8088", "-logs=trackidx/app.log",
+		"-index-dir=trackidx/.index", "-index-interval=100ms")
+	if err := cmd.Start(); err != nil {
+		fmt.Printf("❌ Failed to start server 9: %v\n", err)
+		return
+	}
+	defer cmd.Process.Kill()
+	time.Sleep(500 * time.Millisecond)
+
+	// waitForIndex polls the server until the index covers the whole file
+	// and has been rebuilt the given number of times
+	waitForIndex := func(what string, rebuilds int32) bool {
+		info, _ := os.Stat("trackidx/app.log")
+		var last *pb.FileIndexStatus
+		for attempt := 0; attempt < 40; attempt++ {
+			if status, err := indexStatus("localhost:8088"); err == nil && len(status.Files) == 1 {
+				last = status.Files[0]
+				if last.State == pb.IndexState_INDEX_STATE_CURRENT && last.IndexedBytes == info.Size() && last.Rebuilds == rebuilds {
+					fmt.Printf("✅ Index caught up after %s: %d bytes, %d rebuilds\n", what, last.IndexedBytes, last.Rebuilds)
+					return true
+				}
+			}
+			time.Sleep(250 * time.Millisecond)
+		}
+		fmt.Printf("❌ Index did not catch up after %s: want %d bytes and %d rebuilds, got %v\n", what, info.Size(), rebuilds, last)
+		return false
+	}
+	if !waitForIndex("startup", 0) {
+		return
+	}
+
+	// Appended lines extend the index without rebuilding it
+	appendFile, _ := os.OpenFile("trackidx/app.log", os.O_APPEND|os.O_WRONLY, 0644)
+	for _, line := range append(logLines(20000, 21000), "2024-01-15 11:40:00 ERROR: Replica lag exceeded") {
+		appendFile.WriteString(line + "\n")
+	}
+	appendFile.Close()
+	if !waitForIndex("append", 0) {
+		return
+	}
+	results := queryServers("Replica lag exceeded", "", "localhost:8088")
+	if len(results) != 1 || results[0].Response == nil || len(results[0].Response.Files) != 1 ||
+		!results[0].Response.Files[0].Indexed || results[0].Response.LineCount != 1 ||
+		results[0].Response.Files[0].Matches[0].LineNumber != 21001 {
+		fmt.Printf("❌ Expected the extended index to find line 21001, got %v\n", results)
+	} else {
+		fmt.Printf("✅ Extended index found the appended line\n")
+	}
+
+	// Rotation and truncation in place both discard the index
+	os.Rename("trackidx/app.log", "trackidx/app.log.1")
+	writeLogFile("trackidx/app.log", logLines(0, 500))
+	if !waitForIndex("rotation", 1) {
+		return
+	}
+	writeLogFile("trackidx/app.log", logLines(0, 100))
+	waitForIndex("truncation", 2)
+}
+
+func testFollow() {
+	fmt.Println("\n--- Testing Follow Mode ---")
+
+	if err := os.MkdirAll("followlogs", 0755); err != nil {
+		fmt.Printf("❌ Failed to create test log directory: %v\n", err)
+		return
+	}
+	defer os.RemoveAll("followlogs")
+	writeLogFile("followlogs/app.log", []string{"2024-01-15 12:00:00 ERROR: Logged before following"})
+
+	startServer := func() *exec.Cmd {
+		cmd := exec.Command("./server-grpc", "-machine=10", "-port=8089", "-logs=followlogs/app.log")
+		if err := cmd.Start(); err != nil {
+			fmt.Printf("❌ Failed to start server 10: %v\n", err)
+			return nil
+		}
+		return cmd
+	}
+	server := startServer()
+	if server == nil {
+		return
+	}
+	defer func() { server.Process.Kill() }()
+	time.Sleep(500 * time.Millisecond)
+
+	// Options that need the end of the results are refused
+	conn, err := grpc.Dial("localhost:8089", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err == nil {
+		stream, err := pb.NewLogQueryClient(conn).FollowLogs(context.Background(), &pb.QueryRequest{
+			Pattern:      "ERROR",
+			QueryOptions: &pb.QueryOptions{CountOnly: true},
+		})
+		if err == nil {
+			_, err = stream.Recv()
+		}
+		if status.Code(err) == codes.InvalidArgument {
+			fmt.Printf("✅ Follow with count_only rejected: %v\n", status.Convert(err).Message())
+		} else {
+			fmt.Printf("❌ Expected InvalidArgument for follow with count_only, got %v\n", err)
+		}
+		conn.Close()
+	}
+
+	out, err := os.Create("followlogs/out.txt")
+	if err != nil {
+		fmt.Printf("❌ Failed to create client output: %v\n", err)
+		return
+	}
+	defer out.Close()
+	client := exec.Command("./client-grpc", "-servers=localhost:8089", "-follow", "ERROR")
+	client.Stdout = out
+	if err := client.Start(); err != nil {
+		fmt.Printf("❌ Failed to start client: %v\n", err)
+		return
+	}
+	defer client.Process.Kill()
+	time.Sleep(time.Second)
+
+	appendLine := func(line string) {
+		file, _ := os.OpenFile("followlogs/app.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		file.WriteString(line + "\n")
+		file.Close()
+	}
+
+	// An append, a rotation and a server restart
+	appendLine("2024-01-15 12:00:01 ERROR: Disk failure on sdb")
+	appendLine("2024-01-15 12:00:02 INFO: Not an error")
+	time.Sleep(500 * time.Millisecond)
+	os.Rename("followlogs/app.log", "followlogs/app.log.1")
+	appendLine("2024-01-15 12:00:03 ERROR: Replica promoted")
+	time.Sleep(500 * time.Millisecond)
+	server.Process.Kill()
+	server.Wait()
+	if server = startServer(); server == nil {
+		return
+	}
+	time.Sleep(2500 * time.Millisecond)
+	appendLine("2024-01-15 12:00:04 ERROR: Cache rebuilt")
+
+	want := []string{"Disk failure on sdb", "Replica promoted", "Cache rebuilt"}
+	var output string
+	for attempt := 0; attempt < 20; attempt++ {
+		time.Sleep(250 * time.Millisecond)
+		data, _ := os.ReadFile("followlogs/out.txt")
+		output = string(data)
+		if strings.Contains(output, want[len(want)-1]) {
+			break
+		}
+	}
+	client.Process.Signal(os.Interrupt)
+	client.Wait()
+
+	missing := []string{}
+	for _, line := range want {
+		if !strings.Contains(output, line) {
+			missing = append(missing, line)
+		}
+	}
+	switch {
+	case len(missing) > 0:
+		fmt.Printf("❌ Follow output is missing %q:\n%s", missing, output)
+	case strings.Contains(output, "before following") || strings.Contains(output, "Not an error"):
+		fmt.Printf("❌ Follow output has lines it should not:\n%s", output)
+	default:
+		fmt.Printf("✅ Follow streamed new lines across rotation and a server restart\n")
+	}
+}
+
+// indexStatus fetches the index report of one server
+func indexStatus(address string) (*pb.IndexStatusResponse, error) {
+	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return pb.NewLogQueryClient(conn).IndexStatus(ctx, &pb.IndexStatusRequest{})
+}
+
+func testAggregate() {
+	fmt.Println("\n--- Testing Aggregation ---")
+
+	aggregateAll := func(req *pb.AggregateRequest) (*aggregate.Merged, error) {
+		merged := aggregate.NewMerged()
+		for _, port := range []string{"8080", "8081", "8082"} {
+			conn, err := grpc.Dial("localhost:"+port, grpc.WithTransportCredentials(insecure.NewCredentials()))
+			if err != nil {
+				return nil, err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			resp, err := pb.NewLogQueryClient(conn).Aggregate(ctx, req)
+			cancel()
+			conn.Close()
+			if err != nil {
+				return nil, err
+			}
+			if !resp.Success {
+				return nil, fmt.Errorf("machine %s: %s", port, resp.Error)
+			}
+			var rows []aggregate.Row
+			for _, group := range resp.Groups {
+				row := aggregate.Row{Values: group.Values, Count: group.Count}
+				if group.Bucket != nil {
+					row.Bucket = group.Bucket.AsTime().Local()
+				}
+				rows = append(rows, row)
+			}
+			merged.Add(port, rows, resp.OtherCount)
+		}
+		return merged, nil
+	}
+
+	// Every line, by level
+	merged, err := aggregateAll(&pb.AggregateRequest{Query: &pb.QueryRequest{Pattern: "."}, GroupBy: []string{"level"}})
+	if err != nil {
+		fmt.Printf("❌ Aggregation by level failed: %v\n", err)
+	} else {
+		got := map[string]int64{}
+		for _, row := range merged.Rows() {
+			got[row.Values[0]] = row.Count
+		}
+		want := map[string]int64{"INFO": 13, "ERROR": 12, "WARN": 7, "DEBUG": 3, "CRITICAL": 2}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			fmt.Printf("❌ Expected counts by level %v, got %v\n", want, got)
+		} else {
+			fmt.Printf("✅ Counts by level merged across machines: %v\n", got)
+		}
+	}
+
+	// ERROR lines per minute; each machine logged in a different minute
+	merged, err = aggregateAll(&pb.AggregateRequest{
+		Query:  &pb.QueryRequest{Pattern: "ERROR"},
+		Bucket: durationpb.New(time.Minute),
+	})
+	if err != nil {
+		fmt.Printf("❌ Aggregation by minute failed: %v\n", err)
+	} else {
+		var got []string
+		for _, row := range merged.Rows() {
+			got = append(got, fmt.Sprintf("%s=%d", row.Bucket.Format("15:04"), row.Count))
+		}
+		if strings.Join(got, " ") != "10:30=5 10:31=4 10:32=3" {
+			fmt.Printf("❌ Expected ERROR lines per minute 10:30=5 10:31=4 10:32=3, got %v\n", got)
+		} else {
+			fmt.Printf("✅ ERROR lines per minute: %v\n", got)
+		}
+	}
+
+	_, err = aggregateAll(&pb.AggregateRequest{Query: &pb.QueryRequest{Pattern: "ERROR"}, GroupBy: []string{"host"}})
+	if status.Code(err) == codes.InvalidArgument {
+		fmt.Printf("✅ Unknown group-by field rejected: %v\n", status.Convert(err).Message())
+	} else {
+		fmt.Printf("❌ Expected InvalidArgument for an unknown group-by field, got %v\n", err)
+	}
+}
+
+// queryServers queries the specified servers with the given pattern and options
+func queryServers(pattern, options string, servers ...string) []QueryResult {
+	if len(servers) == 0 {
+		servers = []string{"localhost:8080", "localhost:8081", "localhost:8082"}
+	}
+
+	serverConfigs := make([]ServerConfig, len(servers))
+	for i, addr := range servers {
+		parts := strings.Split(addr, ":")
+		machineID := "1"
+		if len(parts) > 1 {
+			machineID = parts[1]
+		}
+
+		serverConfigs[i] = ServerConfig{
+			MachineID: machineID,
+			Address:   addr,
+		}
+	}
+
+	queryOptions, err := grepopts.Parse(options)
+	if err != nil {
+		fmt.Printf("❌ Invalid options %q: %v\n", options, err)
+		return nil
+	}
+
+	client := NewLogQueryClient(serverConfigs, 10*time.Second)
+	return client.QueryAllServers(&pb.QueryRequest{
+		Pattern:      pattern,
+		QueryOptions: queryOptions,
+	})
+}
+
+// verifyResults verifies that the query results match expected counts
+func verifyResults(results []QueryResult, expectedCounts map[string]int, testName string) {
+	totalExpected := 0
+	for _, count := range expectedCounts {
+		totalExpected += count
+	}
+
+	totalActual := 0
+	successCount := 0
+
+	for _, result := range results {
+		if result.Error != nil {
+			fmt.Printf("Server %s error: %v\n", result.MachineID, result.Error)
+			continue
+		}
+
+		if !result.Response.Success {
+			fmt.Printf("Server %s failed: %s\n", result.MachineID, result.Response.Error)
+			continue
+		}
+
+		successCount++
+		actualCount := int(result.Response.LineCount)
+		totalActual += actualCount
+
+		expectedCount, exists := expectedCounts[result.MachineID]
+		if !exists {
+			fmt.Printf("❌ Test %s: Unexpected machine ID: %s\n", testName, result.MachineID)
+			continue
+		}
+
+		if actualCount != expectedCount {
+			fmt.Printf("❌ Test %s: Machine %s expected %d lines, got %d\n",
+				testName, result.MachineID, expectedCount, actualCount)
+			return
+		}
+	}
+
+	if successCount != len(expectedCounts) {
+		fmt.Printf("❌ Test %s: %d of %d servers succeeded\n",
+			testName, successCount, len(expectedCounts))
+		return
+	}
+
+	if totalActual != totalExpected {
+		fmt.Printf("❌ Test %s: Total expected %d lines, got %d\n",
+			testName, totalExpected, totalActual)
+		return
+	}
+
+	fmt.Printf("✅ Test %s passed: %d successful servers, %d total lines\n",
+		testName, successCount, totalActual)
+}
+
+// testFieldExtraction tests returning and grouping by the named groups of
+// an extraction pattern
+func testFieldExtraction() {
+	fmt.Println("\n--- Testing Field Extraction ---")
+
+	serverConfigs := []ServerConfig{
+		{MachineID: "8080", Address: "localhost:8080"},
+		{MachineID: "8081", Address: "localhost:8081"},
+		{MachineID: "8082", Address: "localhost:8082"},
+	}
+	client := NewLogQueryClient(serverConfigs, 10*time.Second)
+
+	// Every match carries the first word of its message
+	results := client.QueryAllServers(&pb.QueryRequest{Pattern: "ERROR", Extract: `ERROR: (?P<first>\w+)`})
+	extracted := 0
+	for _, result := range results {
+		if result.Error != nil || !result.Response.Success {
+			fmt.Printf("❌ Query with extraction failed on machine %s: %v\n", result.MachineID, result.Error)
+			return
+		}
+		for _, file := range result.Response.Files {
+			for _, match := range file.Matches {
+				if first := strings.Fields(strings.SplitN(match.Line, "ERROR: ", 2)[1])[0]; match.Fields["first"] != first {
+					fmt.Printf("❌ Expected field first=%q for %q, got %v\n", first, match.Line, match.Fields)
+					return
+				}
+				extracted++
+			}
+		}
+	}
+	if extracted != 12 {
+		fmt.Printf("❌ Expected 12 matches with extracted fields, got %d\n", extracted)
+	} else {
+		fmt.Printf("✅ Fields extracted from all %d matches\n", extracted)
+	}
+
+	// Grouping by the extracted field merges machines
+	merged := aggregate.NewMerged()
+	for _, server := range serverConfigs {
+		conn, err := grpc.Dial(server.Address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			fmt.Printf("❌ Failed to connect to %s: %v\n", server.Address, err)
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		resp, err := pb.NewLogQueryClient(conn).Aggregate(ctx, &pb.AggregateRequest{
+			Query:   &pb.QueryRequest{Pattern: "ERROR", Extract: `ERROR: (?P<first>\w+)`},
+			GroupBy: []string{"first"},
+		})
+		cancel()
+		conn.Close()
+		if err != nil || !resp.Success {
+			fmt.Printf("❌ Aggregation by extracted field failed on %s: %v\n", server.Address, err)
+			return
+		}
+		var rows []aggregate.Row
+		for _, group := range resp.Groups {
+			rows = append(rows, aggregate.Row{Values: group.Values, Count: group.Count})
+		}
+		merged.Add(server.MachineID, rows, resp.OtherCount)
+	}
+	rows := merged.Rows()
+	if len(rows) != 11 || rows[0].Values[0] != "Invalid" || rows[0].Count != 2 ||
+		fmt.Sprint(rows[0].ByMachine) != "map[8080:1 8081:1]" {
+		fmt.Printf("❌ Expected 11 groups led by Invalid=2 from 8080 and 8081, got %+v\n", rows)
+	} else {
+		fmt.Printf("✅ Grouped by extracted field: %d groups, %s=%d %v\n", len(rows), rows[0].Values[0], rows[0].Count, rows[0].ByMachine)
+	}
+
+	// An extraction pattern must name a group
+	conn, err := grpc.Dial("localhost:8080", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		fmt.Printf("❌ Failed to connect: %v\n", err)
+		return
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = pb.NewLogQueryClient(conn).QueryLogs(ctx, &pb.QueryRequest{Pattern: "ERROR", Extract: `ERROR: \w+`})
+	if status.Code(err) == codes.InvalidArgument {
+		fmt.Printf("✅ Extraction without named groups rejected: %v\n", status.Convert(err).Message())
+	} else {
+		fmt.Printf("❌ Expected InvalidArgument for an extraction without named groups, got %v\n", err)
+	}
+}
+
+// testTopMessages tests finding the most frequent normalized messages and
+// merging them across machines
+func testTopMessages() {
+	fmt.Println("\n--- Testing Top Messages ---")
+
+	if err := os.MkdirAll("toplogs", 0755); err != nil {
+		fmt.Printf("❌ Failed to create test log directory: %v\n", err)
+		return
+	}
+	defer os.RemoveAll("toplogs")
+
+	// The same events with different numbers, addresses and IDs on two
+	// machines, plus a few one-off messages on the second
+	var first, second []string
+	for i := 0; i < 30; i++ {
+		first = append(first, fmt.Sprintf("2024-01-15 11:00:%02d INFO: Request %d from 10.0.0.%d took %dms", i, 4000+i, i%7, 20+i))
+	}
+	for i := 0; i < 10; i++ {
+		first = append(first, fmt.Sprintf("2024-01-15 11:01:%02d ERROR: Cache miss for key user_%d", i, i*13))
+	}
+	for i := 0; i < 20; i++ {
+		second = append(second, fmt.Sprintf("2024-01-15 11:00:%02d INFO: Request %d from 10.0.1.%d took %dms", i, 9000+i, i, 5+i))
+	}
+	for i := 0; i < 15; i++ {
+		second = append(second, fmt.Sprintf("2024-01-15 11:01:%02d ERROR: Cache miss for key user_%d", i, i*7))
+	}
+	for _, word := range []string{"alpha", "beta", "gamma", "delta", "epsilon", "zeta", "eta"} {
+		second = append(second, "2024-01-15 11:02:00 WARN: Unexpected "+word)
+	}
+	writeLogFile("toplogs/first.log", first)
+	writeLogFile("toplogs/second.log", second)
+
+	ports := map[string]string{"8090": "toplogs/first.log", "8091": "toplogs/second.log"}
+	for port, logs := range ports {
+		cmd := exec.Command("./server-grpc", "-machine="+port, "-port="+port, "-logs="+logs)
+		if err := cmd.Start(); err != nil {
+			fmt.Printf("❌ Failed to start server on port %s: %v\n", port, err)
+			return
+		}
+		defer cmd.Process.Kill()
+	}
+	time.Sleep(1 * time.Second)
+
+	topAll := func(req *pb.TopMessagesRequest) (*aggregate.TopMerge, error) {
+		merged := aggregate.NewTopMerge()
+		for _, port := range []string{"8090", "8091"} {
+			conn, err := grpc.Dial("localhost:"+port, grpc.WithTransportCredentials(insecure.NewCredentials()))
+			if err != nil {
+				return nil, err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			resp, err := pb.NewLogQueryClient(conn).TopMessages(ctx, req)
+			cancel()
+			conn.Close()
+			if err != nil {
+				return nil, err
+			}
+			if !resp.Success {
+				return nil, fmt.Errorf("machine %s: %s", port, resp.Error)
+			}
+			var candidates []aggregate.Candidate
+			for _, message := range resp.Messages {
+				candidates = append(candidates, aggregate.Candidate{Key: message.Message, Count: message.Count, Error: message.Error})
+			}
+			merged.Add(port, candidates, resp.Threshold)
+		}
+		return merged, nil
+	}
+
+	merged, err := topAll(&pb.TopMessagesRequest{Query: &pb.QueryRequest{Pattern: "."}, K: 2})
+	if err != nil {
+		fmt.Printf("❌ Top messages failed: %v\n", err)
+	} else {
+		var got []string
+		for _, candidate := range merged.Top(2) {
+			got = append(got, fmt.Sprintf("%s=%d", candidate.Key, candidate.Count))
+		}
+		want := []string{"Request <n> from <ip> took <n>ms=50", "Cache miss for key user_<n>=25"}
+		if strings.Join(got, "; ") != strings.Join(want, "; ") {
+			fmt.Printf("❌ Expected top messages %v, got %v\n", want, got)
+		} else {
+			fmt.Printf("✅ Top messages merged across machines: %v\n", got)
+		}
+
+		// Both machines listed both messages, so the counts are exact
+		exact := true
+		for _, candidate := range merged.Top(2) {
+			exact = exact && candidate.Lower == candidate.Count && candidate.Upper == candidate.Count
+		}
+		if exact {
+			fmt.Println("✅ Counts of messages every machine listed are exact")
+		} else {
+			fmt.Printf("❌ Expected exact counts, got %+v\n", merged.Top(2))
+		}
+	}
+
+	// Only ERROR lines: the request messages drop out entirely
+	merged, err = topAll(&pb.TopMessagesRequest{Query: &pb.QueryRequest{Pattern: "ERROR"}, K: 5})
+	if err != nil {
+		fmt.Printf("❌ Top ERROR messages failed: %v\n", err)
+	} else if top := merged.Top(5); len(top) != 1 || top[0].Count != 25 {
+		fmt.Printf("❌ Expected a single ERROR message seen 25 times, got %+v\n", top)
+	} else {
+		fmt.Printf("✅ Top ERROR messages: %s=%d\n", top[0].Key, top[0].Count)
+	}
+
+	_, err = topAll(&pb.TopMessagesRequest{Query: &pb.QueryRequest{Pattern: "."}, K: 100000})
+	if status.Code(err) == codes.InvalidArgument {
+		fmt.Printf("✅ Oversized k rejected: %v\n", status.Convert(err).Message())
+	} else {
+		fmt.Printf("❌ Expected InvalidArgument for an oversized k, got %v\n", err)
+	}
+}
+
+// testAdmissionControl tests the concurrency limit, the rejection of
+// searches beyond the queue, client retries and per-search budgets
+func testAdmissionControl() {
+	fmt.Println("\n--- Testing Admission Control ---")
+
+	if err := os.MkdirAll("admitlogs", 0755); err != nil {
+		fmt.Printf("❌ Failed to create test log directory: %v\n", err)
+		return
+	}
+	defer os.RemoveAll("admitlogs")
+
+	var lines []string
+	for i := 0; i < 40000; i++ {
+		lines = append(lines, fmt.Sprintf("2024-01-15 12:%02d:%02d INFO: Request %d served", i/60%60, i%60, i))
+	}
+	writeLogFile("admitlogs/app.log", lines)
+
+	// One search at a time and no queue on 8092; a byte budget on 8093
+	for _, args := range [][]string{
+		{"-machine=11", "-port=8092", "-max-searches=1", "-max-queued=0"},
+		{"-machine=12", "-port=8093", "-max-query-bytes=100000"},
+	} {
+		cmd := exec.Command("./server-grpc", append(args, "-logs=admitlogs/app.log")...)
+		if err := cmd.Start(); err != nil {
+			fmt.Printf("❌ Failed to start server: %v\n", err)
+			return
+		}
+		defer cmd.Process.Kill()
+	}
+	time.Sleep(1 * time.Second)
+
+	conn, err := grpc.Dial("localhost:8092", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		fmt.Printf("❌ Failed to connect: %v\n", err)
+		return
+	}
+	defer conn.Close()
+	client := pb.NewLogQueryClient(conn)
+
+	// A stream that is never read holds the only slot once the server
+	// blocks sending to it
+	streamCtx, stopStream := context.WithCancel(context.Background())
+	defer stopStream()
+	if _, err := client.StreamQueryLogs(streamCtx, &pb.QueryRequest{Pattern: "Request"}); err != nil {
+		fmt.Printf("❌ Failed to start stream: %v\n", err)
+		return
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	load, err := client.ServerLoad(ctx, &pb.ServerLoadRequest{})
+	if err != nil || load.ActiveSearches != 1 || load.MaxActiveSearches != 1 {
+		fmt.Printf("❌ Expected 1 of 1 searches running, got %v (%v)\n", load, err)
+	} else {
+		fmt.Printf("✅ Load reported: %d/%d searches running\n", load.ActiveSearches, load.MaxActiveSearches)
+	}
+
+	var trailer metadata.MD
+	_, err = client.QueryLogs(ctx, &pb.QueryRequest{Pattern: "Request"}, grpc.Trailer(&trailer))
+	if status.Code(err) != codes.ResourceExhausted || len(trailer.Get("grpc-retry-pushback-ms")) != 1 {
+		fmt.Printf("❌ Expected ResourceExhausted with a retry pushback while busy, got %v (trailer %v)\n", err, trailer)
+	} else {
+		fmt.Printf("✅ Search rejected while busy: %s (retry in %sms)\n", status.Convert(err).Message(), trailer.Get("grpc-retry-pushback-ms")[0])
+	}
+
+	// The client retries once the slot frees up
+	cmd := exec.Command("./client-grpc", "-servers=localhost:8092", "-c", "Request 3999")
+	done := make(chan []byte)
+	go func() {
+		output, _ := cmd.CombinedOutput()
+		done <- output
+	}()
+	time.Sleep(700 * time.Millisecond)
+	stopStream()
+	if output := string(<-done); !strings.Contains(output, "Successful servers: 1/1") {
+		fmt.Printf("❌ Expected the client to retry until admitted, got:\n%s\n", output)
+	} else {
+		fmt.Println("✅ Client retried a rejected search until admitted")
+	}
+
+	// Searches that read more than their budget are stopped
+	budgetConn, err := grpc.Dial("localhost:8093", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		fmt.Printf("❌ Failed to connect: %v\n", err)
+		return
+	}
+	defer budgetConn.Close()
+	_, err = pb.NewLogQueryClient(budgetConn).QueryLogs(ctx, &pb.QueryRequest{Pattern: "Request 39999"})
+	if status.Code(err) == codes.ResourceExhausted && strings.Contains(err.Error(), "budget") {
+		fmt.Printf("✅ Search over its byte budget stopped: %s\n", status.Convert(err).Message())
+	} else {
+		fmt.Printf("❌ Expected ResourceExhausted for a search over its budget, got %v\n", err)
+	}
+}
+
+func testResultCache() {
+	fmt.Println("\n--- Testing Result Cache ---")
+
+	if err := os.MkdirAll("cachelogs", 0755); err != nil {
+		fmt.Printf("❌ Failed to create test log directory: %v\n", err)
+		return
+	}
+	defer os.RemoveAll("cachelogs")
+
+	var lines []string
+	for i := 1; i <= 1000; i++ {
+		level := "INFO"
+		if i%100 == 0 {
+			level = "ERROR"
+		}
+		lines = append(lines, fmt.Sprintf("2024-01-15 12:%02d:%02d %s: Request %d served", i/60%60, i%60, level, i))
+	}
+	writeLogFile("cachelogs/app.log", lines)
+
+	cmd := exec.Command("./server-grpc", "-machine=13", "-port=8094", "-logs=cachelogs/app.log")
+	if err := cmd.Start(); err != nil {
+		fmt.Printf("❌ Failed to start server: %v\n", err)
+		return
+	}
+	defer cmd.Process.Kill()
+	time.Sleep(1 * time.Second)
+
+	conn, err := grpc.Dial("localhost:8094", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		fmt.Printf("❌ Failed to connect: %v\n", err)
+		return
+	}
+	defer conn.Close()
+	client := pb.NewLogQueryClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := func() (*pb.FileResult, []int64) {
+		resp, err := client.QueryLogs(ctx, &pb.QueryRequest{Pattern: "ERROR"})
+		if err != nil || !resp.Success || len(resp.Files) != 1 {
+			fmt.Printf("❌ Query failed: %v %v\n", resp, err)
+			return nil, nil
+		}
+		var numbers []int64
+		for _, match := range resp.Files[0].Matches {
+			numbers = append(numbers, match.LineNumber)
+		}
+		return resp.Files[0], numbers
+	}
+
+	first, _ := query()
+	second, numbers := query()
+	if first == nil || second == nil {
+		return
+	}
+	if first.Cached || !second.Cached || second.LineCount != 10 || second.BytesScanned != 0 {
+		fmt.Printf("❌ Expected a repeated query to be answered from the cache, got cached=%v count=%d scanned=%d\n",
+			second.Cached, second.LineCount, second.BytesScanned)
+	} else {
+		fmt.Printf("✅ Repeated query answered from the cache: %d matches, no bytes scanned\n", second.LineCount)
+	}
+
+	// Appended lines are scanned on their own and numbered after the rest
+	file, err := os.OpenFile("cachelogs/app.log", os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Printf("❌ Failed to append: %v\n", err)
+		return
+	}
+	appended := "2024-01-15 13:00:00 ERROR: Request 1001 failed\n2024-01-15 13:00:01 INFO: Request 1002 served\n"
+	file.WriteString(appended)
+	file.Close()
+
+	grown, numbers := query()
+	if grown == nil {
+		return
+	}
+	if !grown.Cached || grown.LineCount != 11 || numbers[len(numbers)-1] != 1001 || grown.BytesScanned != int64(len(appended)) {
+		fmt.Printf("❌ Expected only the appended lines to be scanned, got cached=%v count=%d last line=%d scanned=%d\n",
+			grown.Cached, grown.LineCount, numbers[len(numbers)-1], grown.BytesScanned)
+	} else {
+		fmt.Printf("✅ Appended lines merged with the cached result: %d matches, %d bytes scanned\n", grown.LineCount, grown.BytesScanned)
+	}
+
+	// A rotated file is searched again in full
+	writeLogFile("cachelogs/app.log.new", lines[:500])
+	os.Rename("cachelogs/app.log.new", "cachelogs/app.log")
+	rotated, _ := query()
+	if rotated == nil {
+		return
+	}
+	if rotated.Cached || rotated.LineCount != 5 {
+		fmt.Printf("❌ Expected a rotated file to be searched again, got cached=%v count=%d\n", rotated.Cached, rotated.LineCount)
+	} else {
+		fmt.Printf("✅ Rotated file searched again: %d matches\n", rotated.LineCount)
+	}
+
+	load, err := client.ServerLoad(ctx, &pb.ServerLoadRequest{})
+	if err != nil || load.Cache.GetHits() != 1 || load.Cache.GetPartialHits() != 1 || load.Cache.GetMisses() != 2 {
+		fmt.Printf("❌ Expected 1 hit, 1 partial hit and 2 misses, got %v (%v)\n", load.GetCache(), err)
+	} else {
+		fmt.Printf("✅ Cache use reported: %d hits, %d partial, %d misses\n", load.Cache.Hits, load.Cache.PartialHits, load.Cache.Misses)
+	}
+}
+
+func testListFiles() {
+	fmt.Println("\n--- Testing File Listing ---")
+
+	if err := os.MkdirAll("listlogs", 0755); err != nil {
+		fmt.Printf("❌ Failed to create test log directory: %v\n", err)
+		return
+	}
+	defer os.RemoveAll("listlogs")
+
+	var lines []string
+	for i := 0; i < 20000; i++ {
+		lines = append(lines, fmt.Sprintf("2024-01-15 %02d:%02d:%02d INFO: Request %d served", i/3600, i/60%60, i%60, i))
+	}
+	writeLogFile("listlogs/app.log", lines)
+
+	gzFile, err := os.Create("listlogs/app.log.1.gz")
+	if err != nil {
+		fmt.Printf("❌ Failed to create compressed log: %v\n", err)
+		return
+	}
+	gz := gzip.NewWriter(gzFile)
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(gz, "2024-01-14 23:58:%02d INFO: Old request %d\n", i%60, i)
+	}
+	gz.Close()
+	gzFile.Close()
+
+	cmd := exec.Command("./server-grpc", "-machine=14", "-port=8095", "-logs=listlogs")
+	if err := cmd.Start(); err != nil {
+		fmt.Printf("❌ Failed to start server: %v\n", err)
+		return
+	}
+	defer cmd.Process.Kill()
+	time.Sleep(1 * time.Second)
+
+	conn, err := grpc.Dial("localhost:8095", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		fmt.Printf("❌ Failed to connect: %v\n", err)
+		return
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := pb.NewLogQueryClient(conn).ListFiles(ctx, &pb.ListFilesRequest{IncludeRotated: true})
+	if err != nil || len(resp.Files) != 2 {
+		fmt.Printf("❌ Expected the live log and its rotated copy, got %v (%v)\n", resp, err)
+		return
+	}
+	rotated, live := resp.Files[0], resp.Files[1]
+
+	// The live log is sampled, so its line count is an estimate
+	wantFirst := time.Date(2024, 1, 15, 0, 0, 0, 0, time.Local)
+	wantLast := time.Date(2024, 1, 15, 5, 33, 19, 0, time.Local)
+	if live.Rotated || live.Compression != pb.Compression_COMPRESSION_NONE || live.LinesExact ||
+		live.Lines < 18000 || live.Lines > 22000 ||
+		!live.FirstTimestamp.AsTime().Equal(wantFirst) || !live.LastTimestamp.AsTime().Equal(wantLast) {
+		fmt.Printf("❌ Unexpected description of the live log: %v\n", live)
+	} else {
+		fmt.Printf("✅ Live log described: %d bytes, ~%d lines, %s to %s\n", live.Size, live.Lines,
+			live.FirstTimestamp.AsTime().Local().Format(time.TimeOnly), live.LastTimestamp.AsTime().Local().Format(time.TimeOnly))
+	}
+
+	// The compressed copy is read in full and counted exactly
+	if !rotated.Rotated || rotated.Compression != pb.Compression_COMPRESSION_GZIP || !rotated.LinesExact || rotated.Lines != 100 ||
+		!rotated.LastTimestamp.AsTime().Equal(time.Date(2024, 1, 14, 23, 58, 39, 0, time.Local)) {
+		fmt.Printf("❌ Unexpected description of the rotated log: %v\n", rotated)
+	} else {
+		fmt.Printf("✅ Rotated gzip log described: %d lines, exact\n", rotated.Lines)
+	}
+
+	output, _ := exec.Command("./client-grpc", "files", "-servers=localhost:8095").CombinedOutput()
+	if !strings.Contains(string(output), "listlogs/app.log") || strings.Contains(string(output), "app.log.1.gz") ||
+		!strings.Contains(string(output), "1 files on 1/1 servers") {
+		fmt.Printf("❌ Expected the files subcommand to list the live log, got:\n%s\n", output)
+	} else {
+		fmt.Println("✅ files subcommand printed the inventory")
+	}
+
+	testListFilesBudget()
+}
+
+// testListFilesBudget checks that decompressing rotated logs to describe
+// them is charged to the query budget like a search
+func testListFilesBudget() {
+	if err := os.MkdirAll("listbudgetlogs", 0755); err != nil {
+		fmt.Printf("❌ Failed to create test log directory: %v\n", err)
+		return
+	}
+	defer os.RemoveAll("listbudgetlogs")
+
+	writeLogFile("listbudgetlogs/app.log", []string{"2024-01-15 10:00:00 INFO: Started"})
+	gzFile, err := os.Create("listbudgetlogs/app.log.1.gz")
+	if err != nil {
+		fmt.Printf("❌ Failed to create compressed log: %v\n", err)
+		return
+	}
+	gz := gzip.NewWriter(gzFile)
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(gz, "2024-01-14 %02d:%02d:%02d INFO: Old request %d\n", i/3600, i/60%60, i%60, i)
+	}
+	gz.Close()
+	gzFile.Close()
+
+	cmd := exec.Command("./server-grpc", "-machine=20", "-port=8100", "-logs=listbudgetlogs", "-max-query-bytes=100000")
+	if err := cmd.Start(); err != nil {
+		fmt.Printf("❌ Failed to start server: %v\n", err)
+		return
+	}
+	defer cmd.Process.Kill()
+	time.Sleep(1 * time.Second)
+
+	conn, err := grpc.Dial("localhost:8100", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		fmt.Printf("❌ Failed to connect: %v\n", err)
+		return
+	}
+	defer conn.Close()
+	client := pb.NewLogQueryClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if resp, err := client.ListFiles(ctx, &pb.ListFilesRequest{}); err != nil || len(resp.Files) != 1 {
+		fmt.Printf("❌ Expected the live log to be listed within the budget, got %v (%v)\n", resp, err)
+		return
+	}
+	_, listErr := client.ListFiles(ctx, &pb.ListFilesRequest{IncludeRotated: true})
+	if status.Code(listErr) != codes.ResourceExhausted || !strings.Contains(listErr.Error(), "budget") {
+		fmt.Printf("❌ Expected ResourceExhausted for decompressing past the budget, got %v\n", listErr)
+		return
+	}
+	load, err := client.ServerLoad(ctx, &pb.ServerLoadRequest{})
+	if err != nil || load.Admitted != 2 || load.BudgetExceeded != 1 {
+		fmt.Printf("❌ Expected both listings admitted and one over budget, got %v (%v)\n", load, err)
+	} else {
+		fmt.Printf("✅ Listing rotated logs admitted and stopped by the byte budget: %s\n", status.Convert(listErr).Message())
+	}
+}
+
+func testHealth() {
+	fmt.Println("\n--- Testing Health Checks and Reflection ---")
+
+	if err := os.MkdirAll("healthlogs", 0755); err != nil {
+		fmt.Printf("❌ Failed to create test log directory: %v\n", err)
+		return
+	}
+	defer os.RemoveAll("healthlogs")
+	writeLogFile("healthlogs/app.log", []string{"2024-01-15 10:00:00 ERROR: Disk full"})
+
+	// 8097 is configured with a log that does not exist yet
+	for _, args := range [][]string{
+		{"-machine=15", "-port=8096", "-logs=healthlogs/app.log"},
+		{"-machine=16", "-port=8097", "-logs=healthlogs/missing.log", "-health-interval=200ms"},
+	} {
+		cmd := exec.Command("./server-grpc", args...)
+		if err := cmd.Start(); err != nil {
+			fmt.Printf("❌ Failed to start server: %v\n", err)
+			return
+		}
+		defer cmd.Process.Kill()
+	}
+	time.Sleep(1 * time.Second)
+
+	check := func(address string) (healthpb.HealthCheckResponse_ServingStatus, error) {
+		conn, err := grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			return 0, err
+		}
+		defer conn.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: "logquery.LogQuery"})
+		return resp.GetStatus(), err
+	}
+
+	healthy, err1 := check("localhost:8096")
+	unhealthy, err2 := check("localhost:8097")
+	if healthy != healthpb.HealthCheckResponse_SERVING || unhealthy != healthpb.HealthCheckResponse_NOT_SERVING {
+		fmt.Printf("❌ Expected SERVING and NOT_SERVING, got %v (%v) and %v (%v)\n", healthy, err1, unhealthy, err2)
+	} else {
+		fmt.Println("✅ Health reflects whether the logs can be read: SERVING and NOT_SERVING")
+	}
+
+	// The client skips the unhealthy server without waiting for it
+	start := time.Now()
+	output, _ := exec.Command("./client-grpc", "-servers=localhost:8096,localhost:8097", "-timeout=30s", "ERROR").CombinedOutput()
+	if !strings.Contains(string(output), "Successful servers: 1/2") || !strings.Contains(string(output), "NOT_SERVING") ||
+		time.Since(start) > 5*time.Second {
+		fmt.Printf("❌ Expected the client to skip the NOT_SERVING server, got (after %v):\n%s\n", time.Since(start), output)
+	} else {
+		fmt.Printf("✅ Client skipped the NOT_SERVING server in %v\n", time.Since(start).Round(time.Millisecond))
+	}
+
+	// Health recovers once the log appears
+	writeLogFile("healthlogs/missing.log", []string{"2024-01-15 10:00:00 INFO: Started"})
+	time.Sleep(500 * time.Millisecond)
+	if recovered, err := check("localhost:8097"); recovered != healthpb.HealthCheckResponse_SERVING {
+		fmt.Printf("❌ Expected SERVING once the log exists, got %v (%v)\n", recovered, err)
+	} else {
+		fmt.Println("✅ Health recovered once the log could be read")
+	}
+
+	// Reflection lists the services for tools such as grpcurl
+	conn, err := grpc.Dial("localhost:8096", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		fmt.Printf("❌ Failed to connect: %v\n", err)
+		return
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var services []string
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err == nil {
+		err = stream.Send(&reflectionpb.ServerReflectionRequest{
+			MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+		})
+	}
+	if err == nil {
+		var resp *reflectionpb.ServerReflectionResponse
+		if resp, err = stream.Recv(); err == nil {
+			for _, service := range resp.GetListServicesResponse().GetService() {
+				services = append(services, service.Name)
+			}
+		}
+	}
+	listed := strings.Join(services, ",")
+	if err != nil || !strings.Contains(listed, "logquery.LogQuery") || !strings.Contains(listed, "grpc.health.v1.Health") {
+		fmt.Printf("❌ Expected reflection to list the LogQuery and health services, got %v (%v)\n", services, err)
+	} else {
+		fmt.Printf("✅ Reflection lists %s\n", listed)
+	}
+}
+
+// testCA is an ephemeral certificate authority for the TLS tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCA creates a CA and writes its certificate to path
+func newTestCA(name, path string) (*testCA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &testCA{cert: cert, key: key}, writePEM(path, "CERTIFICATE", der)
+}
+
+// issue signs a certificate for localhost, usable by servers and clients,
+// and writes it and its key to certPath and keyPath
+func (ca *testCA) issue(name, certPath, keyPath string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := writePEM(certPath, "CERTIFICATE", der); err != nil {
+		return err
+	}
+	return writePEM(keyPath, "EC PRIVATE KEY", keyDER)
+}
+
+func writePEM(path, blockType string, der []byte) error {
+	return os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600)
+}
+
+func testTLS() {
+	fmt.Println("\n--- Testing TLS ---")
+
+	if err := os.MkdirAll("tlslogs", 0755); err != nil {
+		fmt.Printf("❌ Failed to create test directory: %v\n", err)
+		return
+	}
+	defer os.RemoveAll("tlslogs")
+	writeLogFile("tlslogs/app.log", []string{"2024-01-15 10:00:00 ERROR: Secret user data"})
+
+	// A CA for the cluster, and a rogue one whose certificates must be refused
+	ca, err := newTestCA("cluster CA", "tlslogs/ca.pem")
+	if err == nil {
+		err = ca.issue("server", "tlslogs/server.pem", "tlslogs/server-key.pem")
+	}
+	if err == nil {
+		err = ca.issue("client", "tlslogs/client.pem", "tlslogs/client-key.pem")
+	}
+	var rogue *testCA
+	if err == nil {
+		rogue, err = newTestCA("rogue CA", "tlslogs/rogue-ca.pem")
+	}
+	if err == nil {
+		err = rogue.issue("intruder", "tlslogs/rogue.pem", "tlslogs/rogue-key.pem")
+	}
+	if err != nil {
+		fmt.Printf("❌ Failed to generate certificates: %v\n", err)
+		return
+	}
+
+	cmd := exec.Command("./server-grpc", "-machine=17", "-port=8098", "-logs=tlslogs/app.log",
+		"-tls-cert=tlslogs/server.pem", "-tls-key=tlslogs/server-key.pem", "-tls-ca=tlslogs/ca.pem", "-tls-verify-clients")
+	if err := cmd.Start(); err != nil {
+		fmt.Printf("❌ Failed to start server: %v\n", err)
+		return
+	}
+	defer cmd.Process.Kill()
+	time.Sleep(1 * time.Second)
+
+	search := func(args ...string) bool {
+		args = append([]string{"-servers=localhost:8098", "-timeout=5s"}, append(args, "Secret")...)
+		output, _ := exec.Command("./client-grpc", args...).CombinedOutput()
+		return strings.Contains(string(output), "Successful servers: 1/1")
+	}
+	withCert := []string{"-tls-ca=tlslogs/ca.pem", "-tls-cert=tlslogs/client.pem", "-tls-key=tlslogs/client-key.pem"}
+
+	if search(withCert...) {
+		fmt.Println("✅ Client with a certificate from the cluster CA searched over mutual TLS")
+	} else {
+		fmt.Println("❌ Expected the client with a valid certificate to be served")
+	}
+	for _, refused := range []struct {
+		name string
+		args []string
+	}{
+		{"a plaintext client", nil},
+		{"a client without a certificate", []string{"-tls-ca=tlslogs/ca.pem"}},
+		{"a client with a rogue certificate", []string{"-tls-ca=tlslogs/ca.pem", "-tls-cert=tlslogs/rogue.pem", "-tls-key=tlslogs/rogue-key.pem"}},
+		{"a client that does not trust the server", []string{"-tls-ca=tlslogs/rogue-ca.pem", "-tls-cert=tlslogs/client.pem", "-tls-key=tlslogs/client-key.pem"}},
+	} {
+		if search(refused.args...) {
+			fmt.Printf("❌ Expected %s to be refused\n", refused.name)
+		} else {
+			fmt.Printf("✅ Refused %s\n", refused.name)
+		}
+	}
+
+	// Rotate the server certificate to one from a new CA and reload it
+	rotated, err := newTestCA("rotated CA", "tlslogs/rotated-ca.pem")
+	if err == nil {
+		err = rotated.issue("server", "tlslogs/server.pem", "tlslogs/server-key.pem")
+	}
+	if err != nil {
+		fmt.Printf("❌ Failed to generate certificates: %v\n", err)
+		return
+	}
+	cmd.Process.Signal(syscall.SIGHUP)
+	time.Sleep(500 * time.Millisecond)
+
+	withRotated := []string{"-tls-ca=tlslogs/rotated-ca.pem", "-tls-cert=tlslogs/client.pem", "-tls-key=tlslogs/client-key.pem"}
+	if search(withRotated...) && !search(withCert...) {
+		fmt.Println("✅ Server presented the rotated certificate after SIGHUP, without a restart")
+	} else {
+		fmt.Println("❌ Expected the rotated certificate to be in use after SIGHUP")
+	}
+}
+
+func testAuthorization() {
+	fmt.Println("\n--- Testing Authorization ---")
+
+	if err := os.MkdirAll("authlogs", 0755); err != nil {
+		fmt.Printf("❌ Failed to create test directory: %v\n", err)
+		return
+	}
+	defer os.RemoveAll("authlogs")
+	writeLogFile("authlogs/app.log", []string{"2024-01-15 10:00:00 ERROR: Checkout failed", "2024-01-15 10:00:01 INFO: Checkout done"})
+	writeLogFile("authlogs/secrets.log", []string{"2024-01-15 10:00:00 ERROR: Key rotation failed"})
+
+	ca, err := newTestCA("cluster CA", "authlogs/ca.pem")
+	if err == nil {
+		err = ca.issue("server", "authlogs/server.pem", "authlogs/server-key.pem")
+	}
+	if err == nil {
+		err = ca.issue("dashboard", "authlogs/dashboard.pem", "authlogs/dashboard-key.pem")
+	}
+	if err != nil {
+		fmt.Printf("❌ Failed to generate certificates: %v\n", err)
+		return
+	}
+
+	digest := func(token string) string {
+		sum := sha256.Sum256([]byte(token))
+		return hex.EncodeToString(sum[:])
+	}
+	policy := fmt.Sprintf(`{"identities": [
+		{"name": "oncall", "token_sha256": [%q], "files": ["*"]},
+		{"name": "analyst", "token_sha256": [%q], "files": ["app.log"], "deny": ["invert"]},
+		{"name": "dashboard", "certificates": ["dashboard"], "files": ["app.log"], "deny": ["follow"]}
+	]}`, digest("oncall-secret"), digest("analyst-secret"))
+	os.WriteFile("authlogs/policy.json", []byte(policy), 0600)
+	os.WriteFile("authlogs/analyst.token", []byte("analyst-secret\n"), 0600)
+
+	cmd := exec.Command("./server-grpc", "-machine=18", "-port=8099", "-logs=authlogs/app.log,authlogs/secrets.log",
+		"-tls-cert=authlogs/server.pem", "-tls-key=authlogs/server-key.pem", "-tls-ca=authlogs/ca.pem",
+		"-auth-policy=authlogs/policy.json")
+	if err := cmd.Start(); err != nil {
+		fmt.Printf("❌ Failed to start server: %v\n", err)
+		return
+	}
+	defer cmd.Process.Kill()
+	time.Sleep(1 * time.Second)
+
+	connect := func(files tlsconfig.Files) (pb.LogQueryClient, func()) {
+		config, err := tlsconfig.ClientConfig(files, "")
+		if err != nil {
+			fmt.Printf("❌ Failed to load TLS files: %v\n", err)
+			return nil, func() {}
+		}
+		conn, err := grpc.Dial("localhost:8099", grpc.WithTransportCredentials(credentials.NewTLS(config)))
+		if err != nil {
+			fmt.Printf("❌ Failed to connect: %v\n", err)
+			return nil, func() {}
+		}
+		return pb.NewLogQueryClient(conn), func() { conn.Close() }
+	}
+	client, closeConn := connect(tlsconfig.Files{CA: "authlogs/ca.pem"})
+	defer closeConn()
+	dashboard, closeDashboard := connect(tlsconfig.Files{CA: "authlogs/ca.pem", Cert: "authlogs/dashboard.pem", Key: "authlogs/dashboard-key.pem"})
+	defer closeDashboard()
+	if client == nil || dashboard == nil {
+		return
+	}
+
+	query := func(client pb.LogQueryClient, token string, req *pb.QueryRequest) ([]string, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if token != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+		}
+		resp, err := client.QueryLogs(ctx, req)
+		var searched []string
+		for _, file := range resp.GetFiles() {
+			searched = append(searched, file.Filename)
+		}
+		return searched, err
+	}
+
+	// Callers without known credentials are turned away
+	_, err1 := query(client, "", &pb.QueryRequest{Pattern: "ERROR"})
+	_, err2 := query(client, "guessed-secret", &pb.QueryRequest{Pattern: "ERROR"})
+	if status.Code(err1) != codes.Unauthenticated || status.Code(err2) != codes.Unauthenticated {
+		fmt.Printf("❌ Expected Unauthenticated without valid credentials, got %v and %v\n", err1, err2)
+	} else {
+		fmt.Println("✅ Calls without a known token or certificate rejected as Unauthenticated")
+	}
+
+	// Each identity searches only the files it may read
+	all, err1 := query(client, "oncall-secret", &pb.QueryRequest{Pattern: "ERROR"})
+	some, err2 := query(client, "analyst-secret", &pb.QueryRequest{Pattern: "ERROR"})
+	if err1 != nil || err2 != nil || len(all) != 2 || len(some) != 1 || !strings.HasSuffix(some[0], "app.log") {
+		fmt.Printf("❌ Expected oncall to search 2 files and analyst only app.log, got %v (%v) and %v (%v)\n", all, err1, some, err2)
+	} else {
+		fmt.Printf("✅ Searches narrowed to the identity's files: oncall %d, analyst %d\n", len(all), len(some))
+	}
+
+	// Denied files and features
+	_, err1 = query(client, "analyst-secret", &pb.QueryRequest{Pattern: "ERROR", FileFilter: "secrets.log"})
+	_, err2 = query(client, "analyst-secret", &pb.QueryRequest{Pattern: "ERROR", QueryOptions: &pb.QueryOptions{Invert: true}})
+	if status.Code(err1) != codes.PermissionDenied || status.Code(err2) != codes.PermissionDenied {
+		fmt.Printf("❌ Expected PermissionDenied for a forbidden file and -v, got %v and %v\n", err1, err2)
+	} else {
+		fmt.Printf("✅ Forbidden file and feature denied: %s; %s\n", status.Convert(err1).Message(), status.Convert(err2).Message())
+	}
+
+	// A boolean NOT selects lines by what they lack, like -v, unless it is
+	// ANDed with a term they contain
+	_, err1 = query(client, "analyst-secret", &pb.QueryRequest{Query: "NOT Checkout"})
+	_, err2 = query(client, "analyst-secret", &pb.QueryRequest{Query: "ERROR OR NOT Checkout"})
+	narrowed, err3 := query(client, "analyst-secret", &pb.QueryRequest{Query: "ERROR NOT timeout"})
+	if status.Code(err1) != codes.PermissionDenied || status.Code(err2) != codes.PermissionDenied || err3 != nil || len(narrowed) != 1 {
+		fmt.Printf("❌ Expected NOT queries denied like -v unless ANDed with a term, got %v, %v and %v\n", err1, err2, err3)
+	} else {
+		fmt.Printf("✅ NOT query denied like -v: %s; ERROR NOT timeout allowed\n", status.Convert(err1).Message())
+	}
+
+	// A denied stream is turned away before it is admitted as a search
+	admitted := func() int64 {
+		ctx, cancel := context.WithTimeout(metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer oncall-secret"), 5*time.Second)
+		defer cancel()
+		load, err := client.ServerLoad(ctx, &pb.ServerLoadRequest{})
+		if err != nil {
+			fmt.Printf("❌ ServerLoad failed: %v\n", err)
+			return -1
+		}
+		return load.Admitted + load.Rejected + int64(load.ActiveSearches) + int64(load.QueuedSearches)
+	}
+	before := admitted()
+	streamCtx, cancelStream := context.WithTimeout(metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer analyst-secret"), 5*time.Second)
+	defer cancelStream()
+	var streamErr error
+	if stream, err := client.StreamQueryLogs(streamCtx, &pb.QueryRequest{Pattern: "ERROR", QueryOptions: &pb.QueryOptions{Invert: true}}); err != nil {
+		streamErr = err
+	} else {
+		_, streamErr = stream.Recv()
+	}
+	if after := admitted(); status.Code(streamErr) != codes.PermissionDenied || before < 0 || after != before {
+		fmt.Printf("❌ Expected a denied stream to leave the server load untouched, got %v and load %d -> %d\n", streamErr, before, after)
+	} else {
+		fmt.Println("✅ Denied stream rejected before admission; server load unchanged")
+	}
+
+	// A client certificate names an identity too
+	searched, err := query(dashboard, "", &pb.QueryRequest{Pattern: "Checkout"})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var followErr error
+	if stream, err := dashboard.FollowLogs(ctx, &pb.QueryRequest{Pattern: "Checkout"}); err != nil {
+		followErr = err
+	} else {
+		_, followErr = stream.Recv()
+	}
+	if err != nil || len(searched) != 1 || status.Code(followErr) != codes.PermissionDenied {
+		fmt.Printf("❌ Expected the dashboard certificate to search but not follow, got %v (%v), follow %v\n", searched, err, followErr)
+	} else {
+		fmt.Println("✅ mTLS identity authorized to search and denied following")
+	}
+
+	// The client reads its token from a file
+	search := func(args ...string) string {
+		args = append([]string{"-servers=localhost:8099", "-tls-ca=authlogs/ca.pem", "-token-file=authlogs/analyst.token"}, append(args, "ERROR")...)
+		output, _ := exec.Command("./client-grpc", args...).CombinedOutput()
+		return string(output)
+	}
+	allowed, denied := search(), search("-options=-v")
+	if !strings.Contains(allowed, "Successful servers: 1/1") || !strings.Contains(denied, "PermissionDenied") {
+		fmt.Printf("❌ Expected the client's token to be accepted and -v denied, got:\n%s\n%s\n", allowed, denied)
+	} else {
+		fmt.Println("✅ Client authenticated with its token file; -v denied by policy")
+	}
 }
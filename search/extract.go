@@ -0,0 +1,67 @@
+package search
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Extractor pulls named fields out of lines with the named capture groups
+// of a regular expression, such as uid in `user_(?P<uid>[0-9]+)`
+type Extractor struct {
+	re     *regexp.Regexp
+	fields []string
+}
+
+// NewExtractor compiles expr, a Go regular expression that must name at
+// least one of its groups. Unnamed groups are only used for grouping
+func NewExtractor(expr string, ignoreCase bool) (*Extractor, error) {
+	source := expr
+	if ignoreCase {
+		source = "(?i)" + source
+	}
+	re, err := regexp.Compile(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid extraction pattern %q: %v", expr, err)
+	}
+
+	e := &Extractor{re: re}
+	seen := map[string]bool{}
+	for _, name := range re.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("extraction pattern %q names field %q more than once", expr, name)
+		}
+		seen[name] = true
+		e.fields = append(e.fields, name)
+	}
+	if len(e.fields) == 0 {
+		return nil, fmt.Errorf("extraction pattern %q has no named groups such as (?P<name>...)", expr)
+	}
+	return e, nil
+}
+
+// Fields returns the names of the fields extracted, in the order their
+// groups appear in the pattern
+func (e *Extractor) Fields() []string {
+	return append([]string(nil), e.fields...)
+}
+
+// Extract returns the fields captured by the leftmost match in line, or nil
+// when the pattern does not match. Groups that took no part in the match
+// are left out
+func (e *Extractor) Extract(line []byte) map[string]string {
+	loc := e.re.FindSubmatchIndex(line)
+	if loc == nil {
+		return nil
+	}
+	fields := map[string]string{}
+	for i, name := range e.re.SubexpNames() {
+		if name == "" || loc[2*i] < 0 {
+			continue
+		}
+		fields[name] = string(line[loc[2*i]:loc[2*i+1]])
+	}
+	return fields
+}
@@ -0,0 +1,186 @@
+package search
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"time"
+)
+
+// readBufferSize is the size of the buffered reader used to stream log files
+const readBufferSize = 64 * 1024
+
+// cancelCheckInterval is how many lines are scanned between context checks
+const cancelCheckInterval = 4096
+
+// LineKind tells a selected line apart from the context reported around it
+type LineKind int
+
+const (
+	// Selected is a line chosen by the matcher and options
+	Selected LineKind = iota
+	// Before is a context line preceding the next selected line
+	Before
+	// After is a context line following the previous selected line
+	After
+)
+
+// Line is a line reported by Scan, either a selected line or a context line
+// printed around one
+type Line struct {
+	Text   []byte
+	Number int   // 1-based line number
+	Offset int64 // Byte offset of the start of the line in the stream
+	Kind   LineKind
+	Spans  [][]int // [start, end) match ranges within Text; selected lines only
+}
+
+// Position locates the start of a line within a stream
+type Position struct {
+	Offset int64 // Byte offset of the line
+	Line   int   // 1-based number of the line
+}
+
+// Scan streams r line by line and calls emit for each line selected by m
+// and opts, along with any requested context lines. It returns the number
+// of selected lines. When opts.CountOnly is set, emit is never called.
+// Line.Text is only valid for the duration of the call
+func Scan(ctx context.Context, r io.Reader, m Matcher, opts Options, emit func(line Line) error) (int, error) {
+	return ScanAt(ctx, r, Position{Line: 1}, m, opts, emit)
+}
+
+// ScanAt is like Scan for a reader positioned at start, which is used to
+// number the lines and offsets it reports
+func ScanAt(ctx context.Context, r io.Reader, start Position, m Matcher, opts Options, emit func(line Line) error) (int, error) {
+	reader := bufio.NewReaderSize(r, readBufferSize)
+	maxLine := opts.MaxLineLength
+	if maxLine <= 0 {
+		maxLine = DefaultMaxLineLength
+	}
+	var long []byte
+	skipped := 0 // bytes of the current line past maxLine
+	count := 0
+	number := start.Line - 1
+	offset, nextOffset := start.Offset, start.Offset
+
+	// current is the timestamp in effect for the line being scanned, and
+	// level the severity level
+	var current time.Time
+	var level string
+
+	// before holds copies of the most recent unselected lines; afterLeft is
+	// the number of context lines still owed after the last selected line
+	var before []Line
+	afterLeft := 0
+	output := !opts.CountOnly
+
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			// Line is longer than the buffer; accumulate it up to maxLine
+			// and skip the rest
+			keep := min(len(chunk), maxLine-len(long))
+			if opts.Charge != nil && keep > 0 {
+				if chargeErr := opts.Charge(keep); chargeErr != nil {
+					return count, chargeErr
+				}
+			}
+			long = append(long, chunk[:keep]...)
+			skipped += len(chunk) - keep
+			continue
+		}
+		if err != nil && err != io.EOF {
+			return count, err
+		}
+
+		text := chunk
+		if len(long) > 0 || skipped > 0 || len(chunk) > maxLine {
+			keep := min(len(chunk), maxLine-len(long))
+			text = append(long, chunk[:keep]...)
+			skipped += len(chunk) - keep
+			long = long[:0]
+		}
+		if len(text) == 0 && skipped == 0 && err == io.EOF {
+			return count, nil
+		}
+		offset = nextOffset
+		nextOffset += int64(len(text) + skipped)
+		skipped = 0
+		text = bytes.TrimSuffix(text, []byte{'\n'})
+
+		number++
+		if number%cancelCheckInterval == 0 {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return count, ctxErr
+			}
+		}
+
+		inRange := true
+		if rng := opts.Range; rng != nil {
+			if t, ok := rng.Timestamp(text); ok {
+				current = t
+			}
+			if rng.Sorted && !rng.Until.IsZero() && !current.Before(rng.Until) {
+				// Everything from here on is past the window
+				return count, nil
+			}
+			inRange = !current.IsZero() && rng.Contains(current)
+		}
+		if levels := opts.Levels; levels != nil {
+			if l := levels.Level(text); l != "" {
+				level = l
+			}
+			inRange = inRange && level != "" && levels.Accept(level)
+		}
+
+		quiet := offset < opts.SkipBefore
+		limitReached := opts.MaxCount > 0 && count >= opts.MaxCount
+		if inRange && !limitReached && m.Match(text) != opts.Invert {
+			if quiet {
+				// Reported before; its context is not owed again
+				before = before[:0]
+				afterLeft = opts.AfterContext
+				continue
+			}
+			count++
+			if output {
+				for _, ctxLine := range before {
+					if emitErr := emit(ctxLine); emitErr != nil {
+						return count, emitErr
+					}
+				}
+				before = before[:0]
+				selected := Line{Text: text, Number: number, Offset: offset, Kind: Selected}
+				if !opts.Invert {
+					selected.Spans = m.FindAll(text)
+				}
+				if emitErr := emit(selected); emitErr != nil {
+					return count, emitErr
+				}
+				afterLeft = opts.AfterContext
+			}
+		} else if output && afterLeft > 0 {
+			afterLeft--
+			if quiet {
+				continue
+			}
+			if emitErr := emit(Line{Text: text, Number: number, Offset: offset, Kind: After}); emitErr != nil {
+				return count, emitErr
+			}
+		} else if limitReached {
+			// Nothing more can be selected and trailing context is done
+			return count, nil
+		} else if output && opts.BeforeContext > 0 {
+			if len(before) == opts.BeforeContext {
+				copy(before, before[1:])
+				before = before[:len(before)-1]
+			}
+			before = append(before, Line{Text: append([]byte(nil), text...), Number: number, Offset: offset, Kind: Before})
+		}
+
+		if err == io.EOF {
+			return count, nil
+		}
+	}
+}
@@ -0,0 +1,258 @@
+// Package search implements the in-process line matching engine used by the
+// log query server in place of an external grep binary
+package search
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Mode selects how a pattern is interpreted
+type Mode int
+
+const (
+	// BasicRegexp interprets the pattern as a POSIX basic regular expression (grep -G)
+	BasicRegexp Mode = iota
+	// ExtendedRegexp interprets the pattern as an extended regular expression (grep -E)
+	ExtendedRegexp
+	// FixedString interprets the pattern as a literal string (grep -F)
+	FixedString
+)
+
+// String returns the grep flag name for the mode
+func (m Mode) String() string {
+	switch m {
+	case BasicRegexp:
+		return "basic"
+	case ExtendedRegexp:
+		return "extended"
+	case FixedString:
+		return "fixed"
+	default:
+		return fmt.Sprintf("Mode(%d)", int(m))
+	}
+}
+
+// Options controls how lines are matched and selected
+type Options struct {
+	Mode       Mode
+	IgnoreCase bool // -i: case-insensitive matching
+	Invert     bool // -v: select non-matching lines
+	WordRegexp bool // -w: match only whole words
+	LineRegexp bool // -x: match only whole lines
+	CountOnly  bool // -c: report only the number of selected lines
+
+	MaxCount      int // -m: stop after this many selected lines (0 = unlimited)
+	BeforeContext int // -B: context lines to report before each selected line
+	AfterContext  int // -A: context lines to report after each selected line
+
+	// Range, when set, restricts selection to lines logged inside a window
+	Range *TimeRange
+	// Levels, when set, restricts selection to lines at accepted severities
+	Levels *LevelFilter
+
+	// SkipBefore makes lines starting before this offset give context only:
+	// they are scanned as usual, so that the lines after them get the same
+	// context, but neither counted nor reported. It resumes a scan midway
+	SkipBefore int64
+
+	// MaxLineLength bounds the bytes kept of a single line, or
+	// DefaultMaxLineLength when 0. The rest of a longer line is skipped:
+	// only the bytes kept are matched and reported
+	MaxLineLength int
+	// Charge, when set, is told of the bytes buffered to assemble lines
+	// longer than the read buffer, and stops the scan with its error
+	Charge func(n int) error
+}
+
+// DefaultMaxLineLength is the longest line kept whole unless
+// Options.MaxLineLength says otherwise
+const DefaultMaxLineLength = 1 << 20
+
+// TimeRange restricts a scan to the lines logged in [Since, Until). Lines
+// without a timestamp of their own, such as stack trace continuations, take
+// the timestamp of the line before them
+type TimeRange struct {
+	Since time.Time // zero for no lower bound
+	Until time.Time // zero for no upper bound
+
+	// Timestamp extracts the timestamp at the start of a line
+	Timestamp func(line []byte) (time.Time, bool)
+
+	// Sorted declares the input to be in chronological order, so a scan can
+	// stop at the first line past Until and SeekTime can be used
+	Sorted bool
+}
+
+// Contains reports whether t falls inside the range
+func (r *TimeRange) Contains(t time.Time) bool {
+	return (r.Since.IsZero() || !t.Before(r.Since)) && (r.Until.IsZero() || t.Before(r.Until))
+}
+
+// LevelFilter restricts a scan to lines logged at accepted severity levels.
+// Like TimeRange, lines without a level of their own take the level of the
+// line before them
+type LevelFilter struct {
+	// Level extracts the level of a line, or "" if it has none. The returned
+	// string must not alias line
+	Level func(line []byte) string
+
+	// Accept reports whether lines at level are selected
+	Accept func(level string) bool
+}
+
+// Matcher reports whether a single log line matches a pattern
+type Matcher interface {
+	// Match reports whether line contains a match
+	Match(line []byte) bool
+	// FindAll returns the [start, end) byte ranges of every non-empty match
+	// in line, in order
+	FindAll(line []byte) [][]int
+}
+
+// NewMatcher compiles pattern according to opts. As with grep -e, a pattern
+// containing newlines matches a line if any of its newline-separated parts do
+func NewMatcher(pattern string, opts Options) (Matcher, error) {
+	expr, err := Expr(pattern, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.WordRegexp && !opts.LineRegexp {
+		return newWordMatcher(pattern, expr)
+	}
+	re, err := compileLongest(pattern, expr)
+	if err != nil {
+		return nil, err
+	}
+	return &regexpMatcher{re: re}, nil
+}
+
+// compileLongest compiles expr, translated from pattern, to report the
+// leftmost-longest match like POSIX tools do
+func compileLongest(pattern, expr string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+	}
+	re.Longest()
+	return re, nil
+}
+
+// Expr returns the Go regular expression NewMatcher compiles for pattern.
+// Word matching is checked separately and is not part of the expression
+func Expr(pattern string, opts Options) (string, error) {
+	parts := strings.Split(pattern, "\n")
+	exprs := make([]string, 0, len(parts))
+	for _, part := range parts {
+		expr, err := translate(part, opts.Mode)
+		if err != nil {
+			return "", err
+		}
+		exprs = append(exprs, expr)
+	}
+
+	expr := strings.Join(exprs, "|")
+	if len(exprs) > 1 {
+		expr = "(?:" + expr + ")"
+	}
+	if opts.LineRegexp {
+		expr = "^(?:" + expr + ")$"
+	}
+	if opts.IgnoreCase {
+		expr = "(?i)" + expr
+	}
+	return expr, nil
+}
+
+// translate converts a pattern in the given mode to Go regexp syntax
+func translate(pattern string, mode Mode) (string, error) {
+	switch mode {
+	case FixedString:
+		return regexp.QuoteMeta(pattern), nil
+	case BasicRegexp:
+		return translateBasic(pattern)
+	case ExtendedRegexp:
+		return translateExtended(pattern)
+	default:
+		return "", fmt.Errorf("unknown pattern mode %v", mode)
+	}
+}
+
+// regexpMatcher matches lines against a compiled regular expression
+type regexpMatcher struct {
+	re *regexp.Regexp
+}
+
+func (m *regexpMatcher) Match(line []byte) bool {
+	return m.re.Match(line)
+}
+
+func (m *regexpMatcher) FindAll(line []byte) [][]int {
+	return nonEmpty(m.re.FindAllIndex(line, -1))
+}
+
+// nonWord matches a byte that is not a word constituent (letter, digit or
+// underscore)
+const nonWord = `[^0-9A-Za-z_]`
+
+// wordMatcher accepts a match only when it is not preceded or followed by a
+// word constituent, mirroring grep -w. Like grep, a match that fails the
+// check is retried with shorter ends and then later starts: the boundaries
+// are part of the expressions, so the regexp engine tries every start and
+// end that could stand alone as a word
+type wordMatcher struct {
+	first *regexp.Regexp // the pattern in group 1, bounded at the start of a line or by a non-word byte
+	next  *regexp.Regexp // the pattern in group 1, bounded by a non-word byte, to resume after a match
+}
+
+// newWordMatcher compiles the word matching expressions for expr
+func newWordMatcher(pattern, expr string) (*wordMatcher, error) {
+	first, err := compileLongest(pattern, `(?:^|`+nonWord+`)(`+expr+`)(?:`+nonWord+`|$)`)
+	if err != nil {
+		return nil, err
+	}
+	next, err := compileLongest(pattern, nonWord+`(`+expr+`)(?:`+nonWord+`|$)`)
+	if err != nil {
+		return nil, err
+	}
+	return &wordMatcher{first: first, next: next}, nil
+}
+
+func (m *wordMatcher) Match(line []byte) bool {
+	return m.first.Match(line)
+}
+
+// FindAll returns the words matched, leftmost first. The byte after each
+// match may be the one before the next, so the search resumes from it with
+// the expression that requires a non-word byte before the match; it starts
+// the slice, which keeps ^ in the pattern from matching there
+func (m *wordMatcher) FindAll(line []byte) [][]int {
+	var spans [][]int
+	re, pos := m.first, 0
+	for pos <= len(line) {
+		loc := re.FindSubmatchIndex(line[pos:])
+		if loc == nil {
+			break
+		}
+		spans = append(spans, []int{pos + loc[2], pos + loc[3]})
+		re, pos = m.next, pos+loc[3]
+	}
+	return nonEmpty(spans)
+}
+
+// nonEmpty drops zero-length matches, which cannot be highlighted
+func nonEmpty(spans [][]int) [][]int {
+	kept := spans[:0]
+	for _, span := range spans {
+		if span[1] > span[0] {
+			kept = append(kept, span)
+		}
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	return kept
+}
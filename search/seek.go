@@ -0,0 +1,151 @@
+package search
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"time"
+)
+
+// seekGranularity is the span below which SeekTime stops bisecting and
+// leaves the remainder to the scan
+const seekGranularity = 64 * 1024
+
+// seekProbeLines bounds how many lines a probe reads looking for a timestamp
+const seekProbeLines = 64
+
+// SeekTime uses binary search over a chronologically sorted file of the
+// given size to find a line start at or shortly before the first line logged
+// at or after since. Skipped lines are not matched; they are only counted
+// so that line numbers reported by ScanAt remain exact
+func SeekTime(r io.ReaderAt, size int64, since time.Time, timestamp func(line []byte) (time.Time, bool)) (Position, error) {
+	if since.IsZero() {
+		return Position{Line: 1}, nil
+	}
+
+	// lo is always the start of a line logged before since (or 0)
+	lo, hi := int64(0), size
+	for hi-lo > seekGranularity {
+		mid := lo + (hi-lo)/2
+		start, t, ok, err := probe(r, size, mid, timestamp)
+		if err != nil {
+			return Position{}, err
+		}
+		if !ok || start >= hi {
+			// No timestamp between mid and hi; the answer lies below mid
+			hi = mid
+			continue
+		}
+		if t.Before(since) {
+			lo = start
+		} else {
+			hi = mid
+		}
+	}
+
+	lines, err := countLines(io.NewSectionReader(r, 0, lo))
+	if err != nil {
+		return Position{}, err
+	}
+	return Position{Offset: lo, Line: lines + 1}, nil
+}
+
+// probe finds the first timestamped line starting after offset and returns
+// its start and timestamp
+func probe(r io.ReaderAt, size, offset int64, timestamp func(line []byte) (time.Time, bool)) (int64, time.Time, bool, error) {
+	reader := bufio.NewReader(io.NewSectionReader(r, offset, size-offset))
+
+	// Skip the partial line containing offset, unless offset starts a line
+	pos := offset
+	if offset > 0 {
+		var prev [1]byte
+		if _, err := r.ReadAt(prev[:], offset-1); err != nil {
+			return 0, time.Time{}, false, err
+		}
+		if prev[0] != '\n' {
+			skipped, err := reader.ReadSlice('\n')
+			pos += int64(len(skipped))
+			if err == io.EOF {
+				return 0, time.Time{}, false, nil
+			}
+			if err != nil && err != bufio.ErrBufferFull {
+				return 0, time.Time{}, false, err
+			}
+			for err == bufio.ErrBufferFull {
+				skipped, err = reader.ReadSlice('\n')
+				pos += int64(len(skipped))
+			}
+			if err == io.EOF {
+				return 0, time.Time{}, false, nil
+			}
+		}
+	}
+
+	for i := 0; i < seekProbeLines; i++ {
+		line, err := reader.ReadSlice('\n')
+		if len(line) > 0 {
+			if t, ok := timestamp(line); ok {
+				return pos, t, true, nil
+			}
+		}
+		pos += int64(len(line))
+		for err == bufio.ErrBufferFull {
+			line, err = reader.ReadSlice('\n')
+			pos += int64(len(line))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, time.Time{}, false, err
+		}
+	}
+	return 0, time.Time{}, false, nil
+}
+
+// BackLines returns the start of the line n lines before the one at start,
+// or of the first line if there are fewer, reading r backwards from start
+func BackLines(r io.ReaderAt, start Position, n int) (Position, error) {
+	buf := make([]byte, readBufferSize)
+	// The byte before start ends the previous line; the newline before that
+	// starts it, and so on
+	end := start.Offset - 1
+	found := 0
+	for end > 0 {
+		from := max(end-int64(len(buf)), 0)
+		chunk := buf[:end-from]
+		if _, err := r.ReadAt(chunk, from); err != nil && err != io.EOF {
+			return Position{}, err
+		}
+		for i := len(chunk) - 1; i >= 0; i-- {
+			if chunk[i] != '\n' {
+				continue
+			}
+			found++
+			if found == n {
+				return Position{Offset: from + int64(i) + 1, Line: start.Line - n}, nil
+			}
+		}
+		end = from
+	}
+	if start.Offset == 0 || n == 0 {
+		return start, nil
+	}
+	return Position{Line: start.Line - found - 1}, nil
+}
+
+// countLines counts the newlines in r
+func countLines(r io.Reader) (int, error) {
+	buf := make([]byte, readBufferSize)
+	lines := 0
+	for {
+		n, err := r.Read(buf)
+		lines += bytes.Count(buf[:n], []byte{'\n'})
+		if err == io.EOF {
+			return lines, nil
+		}
+		if err != nil {
+			return lines, err
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package search
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// translateBasic converts a POSIX basic regular expression, including the
+// common GNU extensions (\+, \?, \|, \<, \>), to Go regexp syntax
+func translateBasic(pattern string) (string, error) {
+	var b strings.Builder
+	// atStart is true where '*' is literal and '^' is an anchor
+	atStart := true
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '\\':
+			if i+1 == len(pattern) {
+				return "", fmt.Errorf("trailing backslash in pattern")
+			}
+			i++
+			next := pattern[i]
+			switch next {
+			case '(', '|':
+				b.WriteByte(next)
+				atStart = true
+				continue
+			case ')', '{', '}', '+', '?':
+				b.WriteByte(next)
+			default:
+				esc, err := translateEscape(next)
+				if err != nil {
+					return "", err
+				}
+				b.WriteString(esc)
+			}
+		case c == '[':
+			end, class, err := translateBracket(pattern, i)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(class)
+			i = end
+		case c == '*' && atStart:
+			b.WriteString(`\*`)
+		case c == '^':
+			if atStart {
+				b.WriteByte('^')
+				// A '*' directly after a leading anchor is still literal
+				continue
+			}
+			b.WriteString(`\^`)
+		case c == '$':
+			if atEnd(pattern, i+1) {
+				b.WriteByte('$')
+			} else {
+				b.WriteString(`\$`)
+			}
+		case strings.IndexByte("(){}|+?", c) >= 0:
+			// Unescaped ERE metacharacters are literals in a BRE
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+		atStart = false
+	}
+	return b.String(), nil
+}
+
+// atEnd reports whether position i of a BRE is the end of an expression,
+// where '$' acts as an anchor
+func atEnd(pattern string, i int) bool {
+	rest := pattern[i:]
+	return rest == "" || strings.HasPrefix(rest, `\)`) || strings.HasPrefix(rest, `\|`)
+}
+
+// translateExtended converts a POSIX extended regular expression to Go
+// regexp syntax. Most of the syntax is shared; escapes and bracket
+// expressions need rewriting
+func translateExtended(pattern string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '\\':
+			if i+1 == len(pattern) {
+				return "", fmt.Errorf("trailing backslash in pattern")
+			}
+			i++
+			esc, err := translateEscape(pattern[i])
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(esc)
+		case '[':
+			end, class, err := translateBracket(pattern, i)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(class)
+			i = end
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), nil
+}
+
+// translateEscape converts the backslash escape \c to Go regexp syntax
+func translateEscape(c byte) (string, error) {
+	switch {
+	case c >= '1' && c <= '9':
+		return "", fmt.Errorf("back-references are not supported")
+	case c == '<' || c == '>':
+		return `\b`, nil
+	case strings.IndexByte("wWsSbB", c) >= 0:
+		return `\` + string(c), nil
+	default:
+		return regexp.QuoteMeta(string(c)), nil
+	}
+}
+
+// translateBracket converts the bracket expression starting at pattern[start]
+// and returns the index of its closing ']' along with the Go equivalent
+func translateBracket(pattern string, start int) (int, string, error) {
+	var b strings.Builder
+	b.WriteByte('[')
+	i := start + 1
+	if i < len(pattern) && pattern[i] == '^' {
+		b.WriteByte('^')
+		i++
+	}
+	// A ']' immediately after the opening bracket is a literal member
+	if i < len(pattern) && pattern[i] == ']' {
+		b.WriteString(`\]`)
+		i++
+	}
+	for ; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case ']':
+			b.WriteByte(']')
+			return i, b.String(), nil
+		case '[':
+			if i+1 < len(pattern) && pattern[i+1] == ':' {
+				end := strings.Index(pattern[i+2:], ":]")
+				if end < 0 {
+					return 0, "", fmt.Errorf("unterminated character class in pattern")
+				}
+				b.WriteString(pattern[i : i+2+end+2])
+				i += 2 + end + 1
+				continue
+			}
+			b.WriteString(`\[`)
+		case '\\':
+			// Backslash has no special meaning inside POSIX brackets
+			b.WriteString(`\\`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return 0, "", fmt.Errorf("unmatched [ in pattern")
+}
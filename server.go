@@ -1,119 +1,2122 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
-	"os/exec"
+	"os/signal"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
+	"github.com/sujayx23/g71_test/admission"
+	"github.com/sujayx23/g71_test/aggregate"
+	"github.com/sujayx23/g71_test/authz"
+	"github.com/sujayx23/g71_test/cache"
+	"github.com/sujayx23/g71_test/index"
+	"github.com/sujayx23/g71_test/logparse"
 	pb "github.com/sujayx23/g71_test/logquery"
+	"github.com/sujayx23/g71_test/logsource"
+	"github.com/sujayx23/g71_test/query"
+	"github.com/sujayx23/g71_test/search"
+	"github.com/sujayx23/g71_test/tlsconfig"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// ServerOptions configures a LogQueryServer
+type ServerOptions struct {
+	// LogPatterns lists the log files, globs or directories to search. With
+	// none given the server searches vm<ID>.log
+	LogPatterns []string
+	// SortedLogs declares log lines to be in chronological order, letting
+	// time-range queries binary search files and stop early
+	SortedLogs bool
+	// Parser names the registered logparse parser used to build LogRecords
+	Parser string
+	// IndexDir enables trigram indexes of the uncompressed log files, kept
+	// in this directory. Empty disables indexing
+	IndexDir string
+	// MaxQueryTime caps how long a single query may search, on top of any
+	// deadline set by the caller. Zero leaves queries bounded only by the
+	// caller
+	MaxQueryTime time.Duration
+	// MaxSearches is the number of searches run at once; more wait in a
+	// queue of up to MaxQueued, and beyond that are rejected with
+	// ResourceExhausted. Zero uses defaultMaxSearches
+	MaxSearches int
+	MaxQueued   int
+	// Budget stops any single search that reads or computes too much
+	Budget admission.Budget
+	// CacheSize bounds the memory, in bytes, of the cache of recent
+	// results per query and file. Zero disables caching
+	CacheSize int64
+	// Policy authenticates callers and limits what each may do; nil lets
+	// anyone who can connect do anything
+	Policy *authz.Authorizer
+}
+
+// defaultMaxSearches is the number of searches run at once unless
+// configured otherwise: half the CPUs, leaving room for the host's own
+// workload
+func defaultMaxSearches() int {
+	return max(runtime.NumCPU()/2, 1)
+}
+
 // LogQueryServer implements the gRPC LogQuery service
 type LogQueryServer struct {
 	pb.UnimplementedLogQueryServer
 	machineID string
-	logFile   string
+	sources   *logsource.Set
+	options   ServerOptions
+	indexes   *index.Manager // nil when indexing is disabled
+	admission *admission.Controller
+	results   *cache.LRU[resultKey, *cachedResult]      // nil when caching is disabled
+	summaries *cache.LRU[summaryKey, logsource.Summary] // descriptions of compressed files, which are read in full
+	pageKey   []byte                                    // signs page tokens; random per process, so tokens do not survive a restart
+
+	budgetExceeded   atomic.Int64 // searches stopped by their budget
+	cacheHits        atomic.Int64 // file searches answered from the cache
+	cachePartialHits atomic.Int64 // file searches that only scanned appended lines
+	cacheMisses      atomic.Int64 // file searches run in full
+}
+
+// NewLogQueryServer creates a new server instance
+func NewLogQueryServer(machineID string, options ServerOptions) *LogQueryServer {
+	if len(options.LogPatterns) == 0 {
+		options.LogPatterns = []string{fmt.Sprintf("vm%s.log", machineID)}
+	}
+	if options.Parser == "" {
+		options.Parser = logparse.DefaultParser
+	}
+	if options.MaxSearches <= 0 {
+		options.MaxSearches = defaultMaxSearches()
+	}
+	pageKey := make([]byte, pageTokenKeySize)
+	if _, err := rand.Read(pageKey); err != nil {
+		log.Fatalf("Failed to generate page token key: %v", err)
+	}
+	server := &LogQueryServer{
+		machineID: machineID,
+		sources:   logsource.NewSet(options.LogPatterns),
+		options:   options,
+		admission: admission.New(options.MaxSearches, options.MaxQueued),
+		summaries: cache.New[summaryKey, logsource.Summary](maxSummaries),
+		pageKey:   pageKey,
+	}
+	if options.IndexDir != "" {
+		server.indexes = index.NewManager(options.IndexDir, 0)
+	}
+	if options.CacheSize > 0 {
+		server.results = cache.New[resultKey, *cachedResult](options.CacheSize)
+	}
+	return server
+}
+
+// updateHealth reports the server, and its LogQuery service, as serving
+// while at least one of its live log files can be read, and as not serving
+// otherwise
+func (s *LogQueryServer) updateHealth(reporter *health.Server) {
+	serving := healthpb.HealthCheckResponse_SERVING
+	err := s.checkLogs()
+	if err != nil {
+		serving = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+
+	current, _ := reporter.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if current.GetStatus() != serving {
+		if err != nil {
+			log.Printf("Health: %v (%v)", serving, err)
+		} else {
+			log.Printf("Health: %v", serving)
+		}
+	}
+	reporter.SetServingStatus("", serving)
+	reporter.SetServingStatus(pb.LogQuery_ServiceDesc.ServiceName, serving)
+}
+
+// checkLogs returns nil if at least one live log file can be opened and
+// read, and otherwise why none can
+func (s *LogQueryServer) checkLogs() error {
+	logs, err := s.sources.Logs()
+	if err != nil {
+		return err
+	}
+	if len(logs) == 0 {
+		return fmt.Errorf("no log files found in %s", strings.Join(s.sources.Patterns(), ", "))
+	}
+	for _, l := range logs {
+		var file *os.File
+		if file, err = os.Open(l.Path); err != nil {
+			continue
+		}
+		_, err = file.Read(make([]byte, 1))
+		file.Close()
+		if err == nil || err == io.EOF {
+			return nil
+		}
+	}
+	return err
+}
+
+// maintainIndexes keeps the trigram index of every uncompressed log file up
+// to date, extending or rebuilding them every interval. It runs until the
+// process exits
+func (s *LogQueryServer) maintainIndexes(interval time.Duration) {
+	for {
+		logs, err := s.sources.Logs()
+		if err != nil {
+			log.Printf("Listing logs to index failed: %v", err)
+		}
+		var files []string
+		for _, l := range logs {
+			files = append(files, l.Files(true)...)
+		}
+		s.indexes.Refresh(files)
+		time.Sleep(interval)
+	}
+}
+
+// authorizeUnary authenticates callers of the LogQuery service against the
+// policy, when there is one, and rejects requests using files or features
+// their identity is not allowed
+func (s *LogQueryServer) authorizeUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	id, err := s.authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorize(id, info.FullMethod, req); err != nil {
+		return nil, err
+	}
+	return handler(authz.NewContext(ctx, id), req)
+}
+
+// authorizeStream is authorizeUnary for streaming RPCs, whose request is
+// checked as the handler receives it. That is still before the search is
+// admitted, so denied requests never take a search slot
+func (s *LogQueryServer) authorizeStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	id, err := s.authenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authorizedStream{
+		ServerStream: ss,
+		ctx:          authz.NewContext(ss.Context(), id),
+		authorize:    func(req any) error { return s.authorize(id, info.FullMethod, req) },
+	})
+}
+
+// authorizedStream carries the caller's identity and checks each request
+// received on the stream
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx       context.Context
+	authorize func(req any) error
+}
+
+func (s *authorizedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *authorizedStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return s.authorize(m)
+}
+
+// authenticate identifies the caller of a LogQuery method. It returns a
+// nil identity, allowed everything, without a policy and for the health
+// and reflection services
+func (s *LogQueryServer) authenticate(ctx context.Context, method string) (*authz.Identity, error) {
+	if s.options.Policy == nil || !strings.HasPrefix(method, "/"+pb.LogQuery_ServiceDesc.ServiceName+"/") {
+		return nil, nil
+	}
+	id, err := s.options.Policy.Policy().Authenticate(ctx)
+	if err != nil {
+		log.Printf("Rejected %s: %v", method, err)
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return id, nil
+}
+
+// authorize checks that id may use every feature req asks for and read
+// at least one of the log files it selects. Which of those files are then
+// searched is narrowed down as the request is served
+func (s *LogQueryServer) authorize(id *authz.Identity, method string, req any) error {
+	if id == nil {
+		return nil
+	}
+	features, filter, readsLogs := requestScope(method, req)
+	if err := id.Check(features); err != nil {
+		log.Printf("Denied %s: %v", method, err)
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	if !readsLogs {
+		return nil
+	}
+
+	logs, err := s.sources.Logs()
+	if err != nil {
+		return nil // left for the handler to report
+	}
+	selected := logsource.Filter(logs, filter)
+	for _, l := range selected {
+		if id.CanRead(l.Path) {
+			return nil
+		}
+	}
+	if len(selected) == 0 {
+		return nil // nothing matches; the handler says so
+	}
+	err = fmt.Errorf("%s may not read the log files matching %q", id.Name, filter)
+	if filter == "" {
+		err = fmt.Errorf("%s may not read any log files on this server", id.Name)
+	}
+	log.Printf("Denied %s: %v", method, err)
+	return status.Error(codes.PermissionDenied, err.Error())
+}
+
+// requestScope returns the features a request to method uses and whether
+// it reads log files, along with the filter selecting them
+func requestScope(method string, req any) ([]authz.Feature, string, bool) {
+	switch req := req.(type) {
+	case *pb.QueryRequest:
+		features := queryFeatures(req)
+		if method == pb.LogQuery_FollowLogs_FullMethodName {
+			features = append(features, authz.Follow)
+		}
+		return features, req.FileFilter, true
+	case *pb.AggregateRequest:
+		return append(queryFeatures(req.GetQuery()), authz.Aggregate), req.GetQuery().GetFileFilter(), true
+	case *pb.TopMessagesRequest:
+		return append(queryFeatures(req.GetQuery()), authz.Top), req.GetQuery().GetFileFilter(), true
+	case *pb.IndexStatusRequest:
+		if req.IncludeRotated {
+			return []authz.Feature{authz.Rotated}, "", false
+		}
+	case *pb.ListFilesRequest:
+		if req.IncludeRotated {
+			return []authz.Feature{authz.Rotated}, "", false
+		}
+	}
+	return nil, "", false
+}
+
+// queryFeatures lists the features a query uses
+func queryFeatures(q *pb.QueryRequest) []authz.Feature {
+	var features []authz.Feature
+	opts := q.GetQueryOptions()
+	if opts.GetInvert() {
+		features = append(features, authz.Invert)
+	} else if q.GetQuery() != "" {
+		// NOT can select every line without a term, as -v does. A query
+		// that does not parse is rejected when it is served
+		if expr, err := query.Parse(q.GetQuery()); err == nil && query.Negated(expr) {
+			features = append(features, authz.Invert)
+		}
+	}
+	if opts.GetBeforeContext() > 0 || opts.GetAfterContext() > 0 {
+		features = append(features, authz.Context)
+	}
+	if q.GetParseRecords() {
+		features = append(features, authz.Records)
+	}
+	if q.GetIncludeRotated() {
+		features = append(features, authz.Rotated)
+	}
+	if q.GetExtract() != "" {
+		features = append(features, authz.Extract)
+	}
+	return features
+}
+
+// readable keeps the logs that the caller of ctx may read
+func readable(ctx context.Context, logs []logsource.Log) []logsource.Log {
+	id := authz.FromContext(ctx)
+	kept := []logsource.Log{}
+	for _, l := range logs {
+		if id.CanRead(l.Path) {
+			kept = append(kept, l)
+		}
+	}
+	return kept
+}
+
+// searchMethods are the RPCs that scan logs and so must be admitted before
+// they run. ListFiles is among them since it reads compressed files in
+// full. Following is left out: it holds its stream open indefinitely but
+// only ever reads what is appended
+var searchMethods = map[string]bool{
+	pb.LogQuery_QueryLogs_FullMethodName:       true,
+	pb.LogQuery_StreamQueryLogs_FullMethodName: true,
+	pb.LogQuery_Aggregate_FullMethodName:       true,
+	pb.LogQuery_TopMessages_FullMethodName:     true,
+	pb.LogQuery_ListFiles_FullMethodName:       true,
+}
+
+// retryPushback is the trailer telling gRPC clients how many milliseconds
+// to wait before retrying, or, when negative, not to retry at all
+const retryPushback = "grpc-retry-pushback-ms"
+
+// admitUnary holds unary searches until the admission controller lets
+// them run
+func (s *LogQueryServer) admitUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if !searchMethods[info.FullMethod] {
+		return handler(ctx, req)
+	}
+	release, trailer, err := s.admit(ctx, info.FullMethod)
+	if err != nil {
+		grpc.SetTrailer(ctx, trailer)
+		return nil, err
+	}
+	defer release()
+
+	resp, err := handler(ctx, req)
+	if status.Code(err) == codes.ResourceExhausted {
+		// The search spent its budget; trying again would only do the same
+		grpc.SetTrailer(ctx, metadata.Pairs(retryPushback, "-1"))
+	}
+	return resp, err
+}
+
+// admitStream is admitUnary for streaming searches. The search is only
+// admitted once the handler has received its request, which by then has
+// been authorized
+func (s *LogQueryServer) admitStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !searchMethods[info.FullMethod] {
+		return handler(srv, ss)
+	}
+	stream := &admittedStream{ServerStream: ss, server: s, method: info.FullMethod}
+	defer stream.release()
+
+	err := handler(srv, stream)
+	if stream.admitted != nil && status.Code(err) == codes.ResourceExhausted {
+		// The search spent its budget; trying again would only do the same
+		ss.SetTrailer(metadata.Pairs(retryPushback, "-1"))
+	}
+	return err
+}
+
+// admittedStream waits for a search slot when its request is received
+type admittedStream struct {
+	grpc.ServerStream
+	server   *LogQueryServer
+	method   string
+	admitted func() // gives back the slot; nil until admitted
+}
+
+func (s *admittedStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil || s.admitted != nil {
+		return err
+	}
+	release, trailer, err := s.server.admit(s.Context(), s.method)
+	if err != nil {
+		s.SetTrailer(trailer)
+		return err
+	}
+	s.admitted = release
+	return nil
+}
+
+// release gives back the search slot, if one was taken
+func (s *admittedStream) release() {
+	if s.admitted != nil {
+		s.admitted()
+	}
+}
+
+// admit waits for a search slot. When the server is too busy to queue the
+// search, it returns ResourceExhausted along with a trailer suggesting when
+// to retry
+func (s *LogQueryServer) admit(ctx context.Context, method string) (func(), metadata.MD, error) {
+	release, err := s.admission.Admit(ctx)
+	switch {
+	case errors.Is(err, admission.ErrBusy):
+		load := s.admission.Load()
+		log.Printf("Rejected %s: %d searches running and %d queued", method, load.Active, load.Queued)
+		trailer := metadata.Pairs(retryPushback, strconv.FormatInt(load.RetryAfter.Milliseconds(), 10))
+		return nil, trailer, status.Errorf(codes.ResourceExhausted,
+			"server busy: %d searches running and %d queued; retry in %v", load.Active, load.Queued, load.RetryAfter)
+	case err != nil:
+		return nil, nil, s.contextStatus(ctx, err)
+	}
+	return release, nil, nil
+}
+
+const (
+	// maxContextLines bounds the before/after context a client may request
+	maxContextLines = 1000
+
+	// streamBatchMatches is the maximum number of matches sent per stream message
+	streamBatchMatches = 500
+	// streamBatchBytes caps the payload of a stream message well below the
+	// default 4 MB gRPC message limit
+	streamBatchBytes = 1 << 20
+
+	// followInterval is how often followed files are checked for new lines
+	followInterval = 250 * time.Millisecond
+	// maxFollowRetry bounds the wait between attempts to follow a log that
+	// could not be opened, which doubles from followInterval
+	maxFollowRetry = 30 * time.Second
+
+	// maxAggregateGroups bounds the groups an aggregation returns
+	maxAggregateGroups = 10000
+
+	// defaultTopK and maxTopK are the default and largest number of top
+	// messages a client may ask for
+	defaultTopK = 10
+	maxTopK     = 1000
+	// Each server counts messages in a sketch of topSketchFactor*k
+	// counters, but at least minTopSketch, and returns topCandidateFactor*k
+	// candidates for the client to merge
+	topSketchFactor    = 100
+	minTopSketch       = 10000
+	topCandidateFactor = 3
+)
+
+// queryPlan is a validated query ready to run against a set of files
+type queryPlan struct {
+	matcher search.Matcher
+	opts    search.Options
+	files   []string
+	parser  logparse.Parser   // set when matches should carry LogRecords
+	extract *search.Extractor // set when matches should carry extracted fields
+	page    *page
+	meter   *admission.Meter // charges the search to its budget, once it runs
+
+	// cacheable is set when results may be cached and reused, which is
+	// not done for paginated queries
+	cacheable bool
+
+	// trigrams selects the index blocks worth scanning; nil when the index
+	// is disabled or cannot narrow down this query
+	trigrams *index.Query
+}
+
+// page tracks a query's progress through its max_results limit
+type page struct {
+	limit       int        // most matches to return, 0 for no limit
+	returned    int        // matches returned so far
+	fingerprint string     // identifies the query, to tie page tokens to it
+	key         []byte     // signs the page tokens handed out
+	resume      *pageToken // where in the first file to continue, if anywhere
+	next        *pageToken // set once the page is full
+}
+
+// errPageFull stops a search once a page holds max_results matches
+var errPageFull = errors.New("page full")
+
+// pageToken is the cursor behind QueryRequest.page_token. It points at the
+// first match not yet returned, by byte offset within a file identified by
+// device and inode, so it stays valid as the file is appended to and even
+// after rotation renames it
+type pageToken struct {
+	Fingerprint string           `json:"q"`
+	File        logsource.FileID `json:"f"`
+	Path        string           `json:"p"` // name of the file when the token was issued
+	Offset      int64            `json:"o"`
+	Line        int              `json:"l"`
+	Selected    int              `json:"s"` // lines already selected in the file, for max_count
+}
+
+// errPageTokenSignature rejects page tokens this server did not sign
+var errPageTokenSignature = errors.New("page_token was not issued by this server, or the server has restarted since")
+
+// pageTokenKeySize is the size of the key signing page tokens
+const pageTokenKeySize = 32
+
+// encode renders the token in the opaque form handed to clients: the
+// cursor followed by an HMAC of it under key, so that clients cannot forge
+// positions of their own
+func (t *pageToken) encode(key []byte) string {
+	data, _ := json.Marshal(t)
+	cursor := base64.RawURLEncoding.EncodeToString(data)
+	return cursor + "." + base64.RawURLEncoding.EncodeToString(signPageToken(key, cursor))
+}
+
+// signPageToken returns the HMAC of an encoded cursor under key
+func signPageToken(key []byte, cursor string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(cursor))
+	return mac.Sum(nil)
+}
+
+// decodePageToken parses a token produced by encode with the same key. It
+// returns errPageTokenSignature for tokens that fail the HMAC check
+func decodePageToken(token string, key []byte) (*pageToken, error) {
+	cursor, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, errPageTokenSignature
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, signPageToken(key, cursor)) {
+		return nil, errPageTokenSignature
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	t := &pageToken{}
+	if err := json.Unmarshal(data, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// queryFingerprint identifies what a request searches for, ignoring the
+// fields that legitimately change from one page to the next
+func queryFingerprint(req *pb.QueryRequest) string {
+	stable := proto.Clone(req).(*pb.QueryRequest)
+	stable.MachineId = ""
+	stable.MaxResults = 0
+	stable.PageToken = ""
+	data, _ := proto.MarshalOptions{Deterministic: true}.Marshal(stable)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// nextPageToken returns the token for the page after this one, if any
+func (p *queryPlan) nextPageToken() string {
+	if p.page.next == nil {
+		return ""
+	}
+	return p.page.next.encode(p.page.key)
+}
+
+// match converts a selected line into its protobuf form, without context
+func (p *queryPlan) match(line search.Line) *pb.Match {
+	match := &pb.Match{
+		Line:       string(line.Text),
+		LineNumber: int64(line.Number),
+		ByteOffset: line.Offset,
+	}
+	for _, span := range line.Spans {
+		match.Spans = append(match.Spans, &pb.Span{Start: int32(span[0]), End: int32(span[1])})
+	}
+	if p.parser != nil {
+		match.Record = logRecord(p.parser.Parse(line.Text))
+	}
+	if p.extract != nil {
+		match.Fields = p.extract.Extract(line.Text)
+	}
+	return match
+}
+
+// filenames describes the files covered by the plan
+func (p *queryPlan) filenames() string {
+	return strings.Join(p.files, ", ")
+}
+
+// QueryLogs implements the gRPC QueryLogs method
+func (s *LogQueryServer) QueryLogs(ctx context.Context, req *pb.QueryRequest) (*pb.QueryResponse, error) {
+	log.Printf("Received query: pattern='%s', query='%s', options={%v}, files='%s'",
+		req.Pattern, req.Query, req.GetQueryOptions(), req.FileFilter)
+
+	opts, err := s.validateRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, errMsg := s.prepareQuery(ctx, req, opts)
+	if errMsg != "" {
+		return &pb.QueryResponse{
+			MachineId: s.machineID,
+			Filename:  strings.Join(s.sources.Patterns(), ", "),
+			Error:     errMsg,
+			Success:   false,
+		}, nil
+	}
+
+	// Execute search
+	files, lineCount, err := s.searchFiles(ctx, plan, func(result *pb.FileResult, match *pb.Match) error {
+		result.Matches = append(result.Matches, match)
+		return nil
+	})
+	if stErr := s.contextStatus(ctx, err); stErr != nil {
+		return nil, stErr
+	}
+	if err != nil {
+		return &pb.QueryResponse{
+			MachineId: s.machineID,
+			Filename:  plan.filenames(),
+			Error:     fmt.Sprintf("Search failed: %v", err),
+			Success:   false,
+		}, nil
+	}
+
+	log.Printf("Found %d matching lines in %s", lineCount, plan.filenames())
+
+	return &pb.QueryResponse{
+		MachineId:     s.machineID,
+		LineCount:     int32(lineCount),
+		Filename:      plan.filenames(),
+		Success:       true,
+		Files:         files,
+		NextPageToken: plan.nextPageToken(),
+		Truncated:     plan.page.next != nil,
+		BytesScanned:  bytesScanned(files),
+	}, nil
+}
+
+// StreamQueryLogs implements the gRPC StreamQueryLogs method
+func (s *LogQueryServer) StreamQueryLogs(req *pb.QueryRequest, stream pb.LogQuery_StreamQueryLogsServer) error {
+	log.Printf("Received streaming query: pattern='%s', query='%s', options={%v}, files='%s'",
+		req.Pattern, req.Query, req.GetQueryOptions(), req.FileFilter)
+
+	opts, err := s.validateRequest(req)
+	if err != nil {
+		return err
+	}
+
+	plan, errMsg := s.prepareQuery(stream.Context(), req, opts)
+	if errMsg != "" {
+		return s.sendTrailer(stream, strings.Join(s.sources.Patterns(), ", "), &pb.QueryTrailer{Error: errMsg})
+	}
+
+	// Accumulate matches per file and flush whenever a batch fills up or the
+	// search moves on to the next file
+	batchFile := ""
+	batch := []*pb.Match{}
+	batchBytes := 0
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := stream.Send(&pb.QueryChunk{
+			MachineId: s.machineID,
+			Filename:  batchFile,
+			Matches:   batch,
+		})
+		batch = []*pb.Match{}
+		batchBytes = 0
+		return err
+	}
+
+	files, lineCount, err := s.searchFiles(stream.Context(), plan, func(result *pb.FileResult, match *pb.Match) error {
+		if result.Filename != batchFile {
+			if err := flush(); err != nil {
+				return err
+			}
+			batchFile = result.Filename
+		}
+		batch = append(batch, match)
+		batchBytes += proto.Size(match)
+		if len(batch) >= streamBatchMatches || batchBytes >= streamBatchBytes {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if stErr := s.contextStatus(stream.Context(), err); stErr != nil {
+		return stErr
+	}
+	if err != nil {
+		return s.sendTrailer(stream, plan.filenames(), &pb.QueryTrailer{
+			LineCount: int32(lineCount),
+			Error:     fmt.Sprintf("Search failed: %v", err),
+			Files:     files,
+		})
+	}
+
+	log.Printf("Streamed %d matching lines from %s", lineCount, plan.filenames())
+
+	return s.sendTrailer(stream, plan.filenames(), &pb.QueryTrailer{
+		LineCount:     int32(lineCount),
+		Success:       true,
+		Files:         files,
+		NextPageToken: plan.nextPageToken(),
+		Truncated:     plan.page.next != nil,
+		BytesScanned:  bytesScanned(files),
+	})
+}
+
+// sendTrailer sends the final message of a streamed query
+func (s *LogQueryServer) sendTrailer(stream pb.LogQuery_StreamQueryLogsServer, filename string, trailer *pb.QueryTrailer) error {
+	return stream.Send(&pb.QueryChunk{
+		MachineId: s.machineID,
+		Filename:  filename,
+		Trailer:   trailer,
+	})
+}
+
+// FollowLogs implements the gRPC FollowLogs method
+func (s *LogQueryServer) FollowLogs(req *pb.QueryRequest, stream pb.LogQuery_FollowLogsServer) error {
+	log.Printf("Received follow: pattern='%s', query='%s', options={%v}, files='%s'",
+		req.Pattern, req.Query, req.GetQueryOptions(), req.FileFilter)
+
+	opts, err := s.validateRequest(req)
+	if err != nil {
+		return err
+	}
+	if err := validateFollow(req); err != nil {
+		return err
+	}
+
+	plan, errMsg := s.prepareQuery(stream.Context(), req, opts)
+	if errMsg != "" {
+		return s.sendTrailer(stream, strings.Join(s.sources.Patterns(), ", "), &pb.QueryTrailer{Error: errMsg})
+	}
+	// Tell the client the follow has started, as matches may be long in
+	// coming
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	// Follow every live log, picking up logs that appear later on; those
+	// are read from their first line
+	ctx := stream.Context()
+	tails := map[string]*logsource.Tail{}
+	failed := map[string]*followRetry{}
+	defer func() {
+		for _, tail := range tails {
+			tail.Close()
+		}
+	}()
+	ticker := time.NewTicker(followInterval)
+	defer ticker.Stop()
+
+	for started := false; ; started = true {
+		paths, err := s.liveFiles(stream.Context(), req.FileFilter)
+		if err != nil {
+			log.Printf("Listing logs to follow failed: %v", err)
+		}
+		for _, path := range paths {
+			retry := failed[path]
+			if tails[path] != nil || (retry != nil && time.Now().Before(retry.next)) {
+				continue
+			}
+			tail, err := logsource.Follow(path, started)
+			if err != nil {
+				if retry == nil {
+					log.Printf("Following %s failed, retrying: %v", path, err)
+					retry = &followRetry{}
+					failed[path] = retry
+				}
+				retry.delay = min(max(2*retry.delay, followInterval), maxFollowRetry)
+				retry.next = time.Now().Add(retry.delay)
+				continue
+			}
+			if retry != nil {
+				log.Printf("Following %s again", path)
+				delete(failed, path)
+			}
+			tails[path] = tail
+		}
+
+		for _, path := range paths {
+			if tail := tails[path]; tail != nil {
+				if err := s.followFile(ctx, tail, plan, stream); err != nil {
+					return s.followStatus(ctx, err)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return s.followStatus(ctx, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// followRetry schedules the next attempt to follow a log that could not be
+// opened
+type followRetry struct {
+	delay time.Duration // wait before the next attempt, doubling each time
+	next  time.Time
+}
+
+// followFile sends the matches among the lines appended to a followed file
+// since it was last polled
+func (s *LogQueryServer) followFile(ctx context.Context, tail *logsource.Tail, plan *queryPlan, stream pb.LogQuery_FollowLogsServer) error {
+	for {
+		chunk, err := tail.Poll()
+		if err != nil {
+			// Keep following; the file may be readable again next time
+			log.Printf("Following %s failed: %v", chunk.Path, err)
+			return nil
+		}
+		if len(chunk.Data) == 0 {
+			return nil
+		}
+
+		batch := []*pb.Match{}
+		batchBytes := 0
+		flush := func() error {
+			if len(batch) == 0 {
+				return nil
+			}
+			err := stream.Send(&pb.QueryChunk{
+				MachineId: s.machineID,
+				Filename:  chunk.Path,
+				Matches:   batch,
+			})
+			batch = []*pb.Match{}
+			batchBytes = 0
+			return err
+		}
+		start := search.Position{Offset: chunk.Offset, Line: chunk.Line}
+		_, err = search.ScanAt(ctx, bytes.NewReader(chunk.Data), start, plan.matcher, plan.opts, func(line search.Line) error {
+			match := plan.match(line)
+			batch = append(batch, match)
+			batchBytes += proto.Size(match)
+			if len(batch) >= streamBatchMatches || batchBytes >= streamBatchBytes {
+				return flush()
+			}
+			return nil
+		})
+		if err == nil {
+			err = flush()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// followStatus returns the gRPC status a follow ends with
+func (s *LogQueryServer) followStatus(ctx context.Context, err error) error {
+	if stErr := s.contextStatus(ctx, err); stErr != nil {
+		return stErr
+	}
+	log.Printf("Follow failed: %v", err)
+	return err
+}
+
+// validateFollow rejects the options that make no sense for a search that
+// never finishes
+func validateFollow(req *pb.QueryRequest) error {
+	opts := req.GetQueryOptions()
+	var unsupported string
+	switch {
+	case opts.GetCountOnly():
+		unsupported = "count_only"
+	case opts.GetMaxCount() > 0:
+		unsupported = "max_count"
+	case opts.GetBeforeContext() > 0 || opts.GetAfterContext() > 0:
+		unsupported = "context lines"
+	case req.IncludeRotated:
+		unsupported = "include_rotated"
+	case req.Since != nil || req.Until != nil:
+		unsupported = "since and until"
+	case req.MaxResults > 0 || req.PageToken != "":
+		unsupported = "max_results and page_token"
+	default:
+		return nil
+	}
+	return status.Errorf(codes.InvalidArgument, "%s cannot be used when following logs", unsupported)
+}
+
+// liveFiles lists the live log files whose path or name matches filter and
+// that the caller of ctx may read
+func (s *LogQueryServer) liveFiles(ctx context.Context, filter string) ([]string, error) {
+	logs, err := s.sources.Logs()
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, l := range readable(ctx, logsource.Filter(logs, filter)) {
+		paths = append(paths, l.Path)
+	}
+	return paths, nil
+}
+
+// Aggregate implements the gRPC Aggregate method
+func (s *LogQueryServer) Aggregate(ctx context.Context, req *pb.AggregateRequest) (*pb.AggregateResponse, error) {
+	q := req.GetQuery()
+	log.Printf("Received aggregate: pattern='%s', query='%s', options={%v}, files='%s', group_by=%v, bucket=%v",
+		q.GetPattern(), q.GetQuery(), q.GetQueryOptions(), q.GetFileFilter(), req.GroupBy, req.GetBucket().AsDuration())
+
+	spec, err := validateAggregate(req)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := aggregate.NewCounts(spec)
+	values := make([]string, len(spec.Fields))
+	files, lineCount, errMsg, err := s.summarize(ctx, q, func(result *pb.FileResult, match *pb.Match) {
+		for i, field := range spec.Fields {
+			switch field {
+			case aggregate.FieldLevel:
+				values[i] = match.Record.Level
+			case aggregate.FieldFile:
+				values[i] = result.Filename
+			default:
+				values[i] = match.Fields[field]
+			}
+		}
+		var logged time.Time
+		if match.Record.Timestamp != nil {
+			logged = match.Record.Timestamp.AsTime()
+		}
+		counts.Add(values, logged)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if errMsg != "" {
+		return &pb.AggregateResponse{MachineId: s.machineID, Error: errMsg}, nil
+	}
+
+	limit := int(req.MaxGroups)
+	if limit == 0 || limit > maxAggregateGroups {
+		limit = maxAggregateGroups
+	}
+	rows, other := counts.Top(limit)
+	log.Printf("Aggregated %d matching lines into %d groups", lineCount, len(rows))
+
+	resp := &pb.AggregateResponse{
+		MachineId:  s.machineID,
+		Success:    true,
+		LineCount:  int64(lineCount),
+		OtherCount: other,
+		Files:      files,
+	}
+	for _, row := range rows {
+		group := &pb.AggregateGroup{Values: row.Values, Count: row.Count}
+		if !row.Bucket.IsZero() {
+			group.Bucket = timestamppb.New(row.Bucket)
+		}
+		resp.Groups = append(resp.Groups, group)
+	}
+	return resp, nil
+}
+
+// TopMessages implements the gRPC TopMessages method
+func (s *LogQueryServer) TopMessages(ctx context.Context, req *pb.TopMessagesRequest) (*pb.TopMessagesResponse, error) {
+	q := req.GetQuery()
+	log.Printf("Received top messages: pattern='%s', query='%s', options={%v}, files='%s', k=%d",
+		q.GetPattern(), q.GetQuery(), q.GetQueryOptions(), q.GetFileFilter(), req.K)
+
+	k := int(req.K)
+	switch {
+	case k < 0 || k > maxTopK:
+		return nil, status.Errorf(codes.InvalidArgument, "k must be between 1 and %d, got %d", maxTopK, k)
+	case k == 0:
+		k = defaultTopK
+	}
+
+	// The sketch holds many more counters than the candidates returned, so
+	// that the candidates' counts are close to exact
+	sketch := aggregate.NewSketch(max(topSketchFactor*k, minTopSketch))
+	files, lineCount, errMsg, err := s.summarize(ctx, q, func(result *pb.FileResult, match *pb.Match) {
+		message := match.Record.Message
+		if message == "" {
+			message = match.Record.Raw
+		}
+		sketch.Add(aggregate.Normalize(message), message)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if errMsg != "" {
+		return &pb.TopMessagesResponse{MachineId: s.machineID, Error: errMsg}, nil
+	}
+
+	// Return more candidates than asked for: a message that is only third
+	// or fourth here can still make the global top k
+	candidates, threshold := sketch.Top(topCandidateFactor * k)
+	log.Printf("Counted %d matching lines into %d candidate messages", lineCount, len(candidates))
+
+	resp := &pb.TopMessagesResponse{
+		MachineId: s.machineID,
+		Success:   true,
+		LineCount: int64(lineCount),
+		Threshold: threshold,
+		Files:     files,
+	}
+	for _, candidate := range candidates {
+		resp.Messages = append(resp.Messages, &pb.MessageCount{
+			Message: candidate.Key,
+			Count:   candidate.Count,
+			Error:   candidate.Error,
+			Example: candidate.Example,
+		})
+	}
+	return resp, nil
+}
+
+// summarize runs a query whose selected lines are summarized rather than
+// returned, passing each one, parsed, to add. Invalid requests fail with a
+// gRPC error; failures the client should see in the response come back as
+// a message
+func (s *LogQueryServer) summarize(ctx context.Context, q *pb.QueryRequest, add func(result *pb.FileResult, match *pb.Match)) ([]*pb.FileResult, int, string, error) {
+	if err := validateSummaryQuery(q); err != nil {
+		return nil, 0, "", err
+	}
+	opts, err := s.validateRequest(q)
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	// Summaries work on each line's parsed level, timestamp and message
+	q = proto.Clone(q).(*pb.QueryRequest)
+	q.ParseRecords = true
+	plan, errMsg := s.prepareQuery(ctx, q, opts)
+	if errMsg != "" {
+		return nil, 0, errMsg, nil
+	}
+
+	files, lineCount, err := s.searchFiles(ctx, plan, func(result *pb.FileResult, match *pb.Match) error {
+		add(result, match)
+		return nil
+	})
+	if stErr := s.contextStatus(ctx, err); stErr != nil {
+		return nil, 0, "", stErr
+	}
+	if err != nil {
+		return nil, 0, fmt.Sprintf("Search failed: %v", err), nil
+	}
+	return files, lineCount, "", nil
+}
+
+// validateSummaryQuery rejects the query options that only make sense when
+// lines are returned
+func validateSummaryQuery(q *pb.QueryRequest) error {
+	if q == nil {
+		return status.Error(codes.InvalidArgument, "query is required")
+	}
+	var unsupported string
+	switch opts := q.GetQueryOptions(); {
+	case opts.GetCountOnly():
+		unsupported = "count_only"
+	case opts.GetBeforeContext() > 0 || opts.GetAfterContext() > 0:
+		unsupported = "context lines"
+	case q.MaxResults > 0 || q.PageToken != "":
+		unsupported = "max_results and page_token"
+	default:
+		return nil
+	}
+	return status.Errorf(codes.InvalidArgument, "%s cannot be used when aggregating", unsupported)
+}
+
+// validateAggregate checks the grouping of an aggregation request and
+// returns it
+func validateAggregate(req *pb.AggregateRequest) (aggregate.Spec, error) {
+	if req.MaxGroups < 0 {
+		return aggregate.Spec{}, status.Errorf(codes.InvalidArgument, "max_groups must not be negative, got %d", req.MaxGroups)
+	}
+
+	extract, err := extractor(req.GetQuery())
+	if err != nil {
+		return aggregate.Spec{}, err
+	}
+	spec := aggregate.Spec{Fields: req.GroupBy}
+	if extract != nil {
+		spec.Extracted = extract.Fields()
+	}
+	if req.Bucket != nil {
+		if err := req.Bucket.CheckValid(); err != nil {
+			return aggregate.Spec{}, status.Errorf(codes.InvalidArgument, "invalid bucket: %v", err)
+		}
+		spec.Bucket = req.Bucket.AsDuration()
+	}
+	if err := spec.Validate(); err != nil {
+		return aggregate.Spec{}, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return spec, nil
+}
+
+// IndexStatus implements the gRPC IndexStatus method
+func (s *LogQueryServer) IndexStatus(ctx context.Context, req *pb.IndexStatusRequest) (*pb.IndexStatusResponse, error) {
+	if err := logsource.ValidateFilter(req.FileFilter); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	resp := &pb.IndexStatusResponse{MachineId: s.machineID, Enabled: s.indexes != nil}
+	if s.indexes == nil {
+		return resp, nil
+	}
+
+	logs, err := s.sources.Logs()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "listing log files: %v", err)
+	}
+	var files []string
+	for _, l := range readable(ctx, logsource.Filter(logs, req.FileFilter)) {
+		files = append(files, l.Files(req.IncludeRotated)...)
+	}
+	for _, st := range s.indexes.Status(files) {
+		file := &pb.FileIndexStatus{
+			Filename:     st.Path,
+			State:        indexStates[st.State],
+			FileSize:     st.Size,
+			IndexedBytes: st.Covered,
+			LagBytes:     st.Lag(),
+			Blocks:       int32(st.Blocks),
+			Rebuilds:     int32(st.Rebuilds),
+		}
+		if !st.Updated.IsZero() {
+			file.Updated = timestamppb.New(st.Updated)
+		}
+		if st.Err != nil {
+			file.Error = st.Err.Error()
+		}
+		resp.Files = append(resp.Files, file)
+	}
+	return resp, nil
 }
 
-// NewLogQueryServer creates a new server instance
-func NewLogQueryServer(machineID string) *LogQueryServer {
-	return &LogQueryServer{
-		machineID: machineID,
-		logFile:   fmt.Sprintf("vm%s.log", machineID),
+// indexStates maps index states to their protobuf form
+var indexStates = map[index.State]pb.IndexState{
+	index.Missing:     pb.IndexState_INDEX_STATE_MISSING,
+	index.Current:     pb.IndexState_INDEX_STATE_CURRENT,
+	index.Behind:      pb.IndexState_INDEX_STATE_BEHIND,
+	index.Stale:       pb.IndexState_INDEX_STATE_STALE,
+	index.Unsupported: pb.IndexState_INDEX_STATE_UNSUPPORTED,
+}
+
+// ServerLoad implements the gRPC ServerLoad method
+func (s *LogQueryServer) ServerLoad(ctx context.Context, req *pb.ServerLoadRequest) (*pb.ServerLoadResponse, error) {
+	load := s.admission.Load()
+	resp := &pb.ServerLoadResponse{
+		MachineId:         s.machineID,
+		ActiveSearches:    int32(load.Active),
+		MaxActiveSearches: int32(load.MaxActive),
+		QueuedSearches:    int32(load.Queued),
+		MaxQueuedSearches: int32(load.MaxQueued),
+		Admitted:          load.Admitted,
+		Rejected:          load.Rejected,
+		BudgetExceeded:    s.budgetExceeded.Load(),
+		RetryAfter:        durationpb.New(load.RetryAfter),
+		MaxQueryBytes:     s.options.Budget.MaxBytes,
+	}
+	if s.options.Budget.MaxCPU > 0 {
+		resp.MaxQueryCpu = durationpb.New(s.options.Budget.MaxCPU)
+	}
+	resp.Cache = &pb.CacheStats{
+		Enabled:     s.results != nil,
+		Hits:        s.cacheHits.Load(),
+		PartialHits: s.cachePartialHits.Load(),
+		Misses:      s.cacheMisses.Load(),
+		Capacity:    s.options.CacheSize,
+	}
+	if s.results != nil {
+		stats := s.results.Stats()
+		resp.Cache.Entries = int32(stats.Entries)
+		resp.Cache.Bytes = stats.Size
+		resp.Cache.Evictions = stats.Evictions
 	}
+	return resp, nil
 }
 
-// QueryLogs implements the gRPC QueryLogs method
-func (s *LogQueryServer) QueryLogs(ctx context.Context, req *pb.QueryRequest) (*pb.QueryResponse, error) {
-	log.Printf("Received query: pattern='%s', options='%s'", req.Pattern, req.Options)
+// maxSummaries is the number of compressed file descriptions kept
+const maxSummaries = 1024
 
-	// Check if log file exists
-	if _, err := os.Stat(s.logFile); os.IsNotExist(err) {
-		return &pb.QueryResponse{
-			MachineId: s.machineID,
-			Filename:  s.logFile,
-			Error:     fmt.Sprintf("Log file '%s' not found", s.logFile),
-			Success:   false,
-		}, nil
+// summaryKey identifies the description of a file, whose timestamps depend
+// on the layout they were parsed with
+type summaryKey struct {
+	path   string
+	layout string
+}
+
+// ListFiles implements the gRPC ListFiles method
+func (s *LogQueryServer) ListFiles(ctx context.Context, req *pb.ListFilesRequest) (*pb.ListFilesResponse, error) {
+	if err := logsource.ValidateFilter(req.FileFilter); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	logs, err := s.sources.Logs()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "listing log files: %v", err)
 	}
 
-	// Sanitize the pattern to prevent command injection
-	sanitizedPattern := sanitizePattern(req.Pattern)
-	if sanitizedPattern == "" {
-		return &pb.QueryResponse{
-			MachineId: s.machineID,
-			Filename:  s.logFile,
-			Error:     "Invalid or empty pattern",
-			Success:   false,
-		}, nil
+	// Describing files is bounded like a search: by the server's time
+	// limit and by the budget, which is charged whatever is read
+	if s.options.MaxQueryTime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.options.MaxQueryTime)
+		defer cancel()
+	}
+	meter := s.options.Budget.Start()
+	defer meter.Stop()
+	charge := func(n int) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return meter.Charge(n)
+	}
+
+	timestamps := logparse.NewTimestampParser(req.TimestampLayout, time.Local)
+	resp := &pb.ListFilesResponse{MachineId: s.machineID}
+	for _, l := range readable(ctx, logsource.Filter(logs, req.FileFilter)) {
+		for _, path := range l.Files(req.IncludeRotated) {
+			if err := ctx.Err(); err != nil {
+				return nil, s.contextStatus(ctx, err)
+			}
+			file := &pb.LogFile{Filename: path, Rotated: path != l.Path}
+			resp.Files = append(resp.Files, file)
+
+			summary, err := s.describeFile(path, timestamps, charge)
+			if stErr := s.contextStatus(ctx, err); stErr != nil {
+				return nil, stErr
+			}
+			if err != nil {
+				file.Error = err.Error()
+				continue
+			}
+			file.Size = summary.Size
+			file.Modified = timestamppb.New(summary.ModTime)
+			file.Lines = summary.Lines
+			file.LinesExact = summary.LinesExact
+			file.Compression = compressions[summary.Compression]
+			if !summary.First.IsZero() {
+				file.FirstTimestamp = timestamppb.New(summary.First)
+			}
+			if !summary.Last.IsZero() {
+				file.LastTimestamp = timestamppb.New(summary.Last)
+			}
+		}
+	}
+	return resp, nil
+}
+
+// describeFile summarizes the file at path, charging what it reads to
+// charge. Compressed files have to be read in full, so their descriptions
+// are kept until the file changes
+func (s *LogQueryServer) describeFile(path string, timestamps *logparse.TimestampParser, charge func(n int) error) (logsource.Summary, error) {
+	key := summaryKey{path: path, layout: timestamps.Layout()}
+	if summary, ok := s.summaries.Get(key); ok {
+		if info, err := os.Stat(path); err == nil && logsource.Identify(info) == summary.ID &&
+			info.Size() == summary.Size && info.ModTime().Equal(summary.ModTime) {
+			return summary, nil
+		}
 	}
 
-	// Execute grep command
-	lines, lineCount, err := s.executeGrep(sanitizedPattern, req.Options)
+	summary, err := logsource.Summarize(path, timestamps.Parse, charge)
 	if err != nil {
-		return &pb.QueryResponse{
-			MachineId: s.machineID,
-			Filename:  s.logFile,
-			Error:     fmt.Sprintf("Grep execution failed: %v", err),
-			Success:   false,
-		}, nil
+		return summary, err
 	}
+	if summary.Compression != logsource.None {
+		s.summaries.Put(key, summary, 1)
+	}
+	return summary, nil
+}
 
-	log.Printf("Found %d matching lines in %s", lineCount, s.logFile)
+// compressions maps compression formats to their protobuf form
+var compressions = map[logsource.Compression]pb.Compression{
+	logsource.None:  pb.Compression_COMPRESSION_NONE,
+	logsource.Gzip:  pb.Compression_COMPRESSION_GZIP,
+	logsource.Bzip2: pb.Compression_COMPRESSION_BZIP2,
+}
 
-	return &pb.QueryResponse{
-		MachineId: s.machineID,
-		LineCount: int32(lineCount),
-		Filename:  s.logFile,
-		Lines:     lines,
-		Success:   true,
+// prepareQuery resolves the files to search, sanitizes the pattern and
+// compiles it. It returns the plan, or an error message for the client
+func (s *LogQueryServer) prepareQuery(ctx context.Context, req *pb.QueryRequest, opts search.Options) (*queryPlan, string) {
+	// Resolve the configured log sources to existing files
+	logs, err := s.sources.Logs()
+	if err != nil {
+		return nil, err.Error()
+	}
+	if len(logs) == 0 {
+		return nil, fmt.Sprintf("No log files found matching '%s'", strings.Join(s.sources.Patterns(), ", "))
+	}
+
+	logs = readable(ctx, logsource.Filter(logs, req.FileFilter))
+	if len(logs) == 0 {
+		return nil, fmt.Sprintf("No log files match filter '%s'", req.FileFilter)
+	}
+
+	// Search each log's rotated history, if requested, before the live file
+	files := []string{}
+	for _, l := range logs {
+		files = append(files, l.Files(req.IncludeRotated)...)
+	}
+
+	var matcher search.Matcher
+	var trigrams *index.Query
+	if req.Query != "" {
+		// Syntax errors carry the column they were found at
+		expr, err := query.Parse(req.Query)
+		if err == nil {
+			matcher, err = query.Compile(expr, opts)
+		}
+		if err != nil {
+			return nil, fmt.Sprintf("Invalid query: %v", err)
+		}
+		trigrams = queryTrigrams(expr, opts)
+	} else {
+		// Sanitize the pattern to prevent command injection
+		sanitizedPattern := sanitizePattern(req.Pattern)
+		if sanitizedPattern == "" {
+			return nil, "Invalid or empty pattern"
+		}
+
+		if matcher, err = search.NewMatcher(sanitizedPattern, opts); err != nil {
+			return nil, fmt.Sprintf("Search failed: %v", err)
+		}
+		trigrams = patternTrigrams(sanitizedPattern, opts)
+	}
+
+	plan := &queryPlan{matcher: matcher, opts: opts, files: files, page: &page{
+		limit:       int(req.MaxResults),
+		fingerprint: queryFingerprint(req),
+		key:         s.pageKey,
+	}}
+	if req.PageToken != "" {
+		if errMsg := plan.resumeFrom(req.PageToken); errMsg != "" {
+			return nil, errMsg
+		}
+	}
+	if s.indexes != nil && indexable(opts) && !trigrams.IsAll() {
+		plan.trigrams = trigrams
+	}
+	plan.cacheable = s.results != nil && req.MaxResults == 0 && req.PageToken == ""
+	if req.ParseRecords {
+		timestamps := logparse.NewTimestampParser(req.TimestampLayout, time.Local)
+		if plan.parser, err = logparse.NewParser(s.options.Parser, timestamps); err != nil {
+			return nil, err.Error()
+		}
+	}
+	if plan.extract, err = extractor(req); err != nil {
+		return nil, status.Convert(err).Message()
+	}
+
+	return plan, ""
+}
+
+// indexable reports whether a search with opts may skip the lines an index
+// rules out. Inverted matches and context need every line, and the time and
+// level filters carry each line's timestamp and level on to the next
+func indexable(opts search.Options) bool {
+	return !opts.Invert && opts.BeforeContext == 0 && opts.AfterContext == 0 &&
+		opts.Range == nil && opts.Levels == nil
+}
+
+// patternTrigrams derives the trigrams that lines matching pattern must
+// contain. It returns index.All when the pattern cannot be decomposed
+func patternTrigrams(pattern string, opts search.Options) *index.Query {
+	expr, err := search.Expr(pattern, opts)
+	if err != nil {
+		return index.All()
+	}
+	q, err := index.RegexpQuery(expr)
+	if err != nil {
+		return index.All()
+	}
+	return q
+}
+
+// queryTrigrams is patternTrigrams for a boolean query. NOT terms match by
+// the absence of text, so they cannot narrow the search
+func queryTrigrams(node query.Node, opts search.Options) *index.Query {
+	switch n := node.(type) {
+	case *query.Term:
+		return patternTrigrams(n.Text, query.TermOptions(n, opts))
+	case *query.And:
+		return index.And(queryTrigrams(n.Left, opts), queryTrigrams(n.Right, opts))
+	case *query.Or:
+		return index.Or(queryTrigrams(n.Left, opts), queryTrigrams(n.Right, opts))
+	default:
+		return index.All()
+	}
+}
+
+// resumeFrom positions the plan at the match a page token points to,
+// dropping the files searched by earlier pages. It returns an error message
+// for the client if the token cannot be used
+func (p *queryPlan) resumeFrom(encoded string) string {
+	token, err := decodePageToken(encoded, p.page.key)
+	if err != nil || token.Fingerprint != p.page.fingerprint {
+		return "Invalid page token: it does not belong to this query"
+	}
+
+	// Look the file up by identity, since rotation may have renamed it
+	for i, path := range p.files {
+		info, err := os.Stat(path)
+		if err != nil || logsource.Identify(info) != token.File {
+			continue
+		}
+		// A file that shrank below the cursor was truncated in place
+		if compression, err := logsource.DetectCompression(path); err != nil ||
+			(compression == logsource.None && info.Size() < token.Offset) {
+			break
+		}
+		p.files = p.files[i:]
+		p.page.resume = token
+		return ""
+	}
+	return fmt.Sprintf("Page token has expired: %s was truncated, rotated away or removed", token.Path)
+}
+
+// validateRequest validates the typed query options, file filter and time
+// range and converts them to matching engine options. Anything a client may
+// not ask for is rejected with InvalidArgument
+func (s *LogQueryServer) validateRequest(req *pb.QueryRequest) (search.Options, error) {
+	if req.GetOptions() != "" {
+		return search.Options{}, status.Errorf(codes.InvalidArgument,
+			"raw grep options %q are not accepted; set query_options instead", req.GetOptions())
+	}
+	if err := logsource.ValidateFilter(req.GetFileFilter()); err != nil {
+		return search.Options{}, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if req.GetQuery() != "" && req.GetPattern() != "" {
+		return search.Options{}, status.Error(codes.InvalidArgument, "set either pattern or query, not both")
+	}
+
+	qo := req.GetQueryOptions()
+	opts := search.Options{
+		IgnoreCase: qo.GetCaseInsensitive(),
+		Invert:     qo.GetInvert(),
+		WordRegexp: qo.GetWholeWord(),
+		LineRegexp: qo.GetWholeLine(),
+		CountOnly:  qo.GetCountOnly(),
+	}
+
+	switch qo.GetRegexFlavor() {
+	case pb.RegexFlavor_REGEX_FLAVOR_BASIC:
+		opts.Mode = search.BasicRegexp
+	case pb.RegexFlavor_REGEX_FLAVOR_EXTENDED:
+		opts.Mode = search.ExtendedRegexp
+	case pb.RegexFlavor_REGEX_FLAVOR_FIXED:
+		opts.Mode = search.FixedString
+	default:
+		return search.Options{}, status.Errorf(codes.InvalidArgument,
+			"unknown regex_flavor %d", qo.GetRegexFlavor())
+	}
+
+	if qo.GetMaxCount() < 0 {
+		return search.Options{}, status.Errorf(codes.InvalidArgument,
+			"max_count must not be negative, got %d", qo.GetMaxCount())
+	}
+	opts.MaxCount = int(qo.GetMaxCount())
+	if req.GetMaxResults() < 0 {
+		return search.Options{}, status.Errorf(codes.InvalidArgument,
+			"max_results must not be negative, got %d", req.GetMaxResults())
+	}
+	if req.GetPageToken() != "" {
+		if _, err := decodePageToken(req.GetPageToken(), s.pageKey); errors.Is(err, errPageTokenSignature) {
+			return search.Options{}, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	for _, c := range []struct {
+		name  string
+		value int32
+	}{
+		{"before_context", qo.GetBeforeContext()},
+		{"after_context", qo.GetAfterContext()},
+	} {
+		if c.value < 0 || c.value > maxContextLines {
+			return search.Options{}, status.Errorf(codes.InvalidArgument,
+				"%s must be between 0 and %d, got %d", c.name, maxContextLines, c.value)
+		}
+	}
+	opts.BeforeContext = int(qo.GetBeforeContext())
+	opts.AfterContext = int(qo.GetAfterContext())
+
+	// Restrict the search to a time window when one is given
+	if req.Since != nil || req.Until != nil {
+		rng := &search.TimeRange{Sorted: s.options.SortedLogs}
+		for _, bound := range []struct {
+			name  string
+			value *timestamppb.Timestamp
+			dest  *time.Time
+		}{
+			{"since", req.Since, &rng.Since},
+			{"until", req.Until, &rng.Until},
+		} {
+			if bound.value == nil {
+				continue
+			}
+			if err := bound.value.CheckValid(); err != nil {
+				return search.Options{}, status.Errorf(codes.InvalidArgument, "invalid %s: %v", bound.name, err)
+			}
+			*bound.dest = bound.value.AsTime()
+		}
+		if !rng.Since.IsZero() && !rng.Until.IsZero() && !rng.Since.Before(rng.Until) {
+			return search.Options{}, status.Errorf(codes.InvalidArgument,
+				"since (%s) must be before until (%s)", rng.Since.Format(time.RFC3339), rng.Until.Format(time.RFC3339))
+		}
+
+		rng.Timestamp = logparse.NewTimestampParser(req.TimestampLayout, time.Local).Parse
+		opts.Range = rng
+	}
+
+	levels, err := s.levelFilter(req)
+	if err != nil {
+		return search.Options{}, err
+	}
+	opts.Levels = levels
+
+	if _, err := extractor(req); err != nil {
+		return search.Options{}, err
+	}
+
+	return opts, nil
+}
+
+// extractor compiles the request's extraction pattern, or returns nil when
+// it has none
+func extractor(req *pb.QueryRequest) (*search.Extractor, error) {
+	if req.GetExtract() == "" {
+		return nil, nil
+	}
+	extract, err := search.NewExtractor(req.GetExtract(), req.GetQueryOptions().GetCaseInsensitive())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return extract, nil
+}
+
+// levelFilter builds the severity filter for min_level or levels, or returns
+// nil when the request has neither. Levels are compared on the parsed level
+// of each line, not its raw text
+func (s *LogQueryServer) levelFilter(req *pb.QueryRequest) (*search.LevelFilter, error) {
+	if req.MinLevel == pb.Level_LEVEL_UNSPECIFIED && len(req.Levels) == 0 {
+		return nil, nil
+	}
+	if req.MinLevel != pb.Level_LEVEL_UNSPECIFIED && len(req.Levels) > 0 {
+		return nil, status.Error(codes.InvalidArgument, "set either min_level or levels, not both")
+	}
+
+	// logparse severities share the numbering of the Level enum
+	known := func(level pb.Level) bool {
+		return level > pb.Level_LEVEL_UNSPECIFIED && level <= pb.Level_LEVEL_CRITICAL
+	}
+	if req.MinLevel != pb.Level_LEVEL_UNSPECIFIED && !known(req.MinLevel) {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown min_level %d", req.MinLevel)
+	}
+	minLevel := logparse.Severity(req.MinLevel)
+	accepted := map[logparse.Severity]bool{}
+	for _, level := range req.Levels {
+		if !known(level) {
+			return nil, status.Errorf(codes.InvalidArgument, "unknown level %d in levels", level)
+		}
+		accepted[logparse.Severity(level)] = true
+	}
+
+	parser, err := logparse.NewParser(s.options.Parser, logparse.NewTimestampParser(req.TimestampLayout, time.Local))
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &search.LevelFilter{
+		Level: parser.Level,
+		Accept: func(level string) bool {
+			severity := logparse.ParseSeverity(level)
+			if minLevel != logparse.SeverityUnknown {
+				return severity >= minLevel
+			}
+			return accepted[severity]
+		},
 	}, nil
 }
 
-// executeGrep runs the grep command and returns matching lines
-func (s *LogQueryServer) executeGrep(pattern, options string) ([]string, int, error) {
-	// Build grep command
-	args := []string{}
+// contextStatus converts a search stopped by cancellation, a deadline or
+// its budget into the matching gRPC status, telling the caller's deadline
+// apart from the server's MaxQueryTime. It returns nil for any other outcome
+func (s *LogQueryServer) contextStatus(ctx context.Context, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, admission.ErrBudgetExceeded):
+		s.budgetExceeded.Add(1)
+		log.Printf("Query stopped: %v", err)
+		return status.Errorf(codes.ResourceExhausted, "query stopped: %v", err)
+	case errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled):
+		log.Printf("Query canceled by client")
+		return status.Error(codes.Canceled, "query canceled")
+	case ctx.Err() != nil:
+		log.Printf("Query exceeded client deadline")
+		return status.Error(codes.DeadlineExceeded, "query exceeded its deadline")
+	case errors.Is(err, context.DeadlineExceeded):
+		log.Printf("Query exceeded server limit of %v", s.options.MaxQueryTime)
+		return status.Errorf(codes.DeadlineExceeded, "query exceeded the server's %v limit", s.options.MaxQueryTime)
+	}
+	return nil
+}
 
-	// Add options if provided
-	if options != "" {
-		optionList := strings.Fields(options)
-		args = append(args, optionList...)
+// searchFiles runs the plan over each file in turn, calling emit for every
+// match, with its context, and the result of the file it came from. Files
+// that cannot be read are reported in their result rather than failing the
+// query; an error from emit aborts the search
+func (s *LogQueryServer) searchFiles(ctx context.Context, plan *queryPlan, emit func(result *pb.FileResult, match *pb.Match) error) ([]*pb.FileResult, int, error) {
+	// Stop when the caller cancels or its deadline passes, or at the
+	// server's own limit if that comes first
+	if s.options.MaxQueryTime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.options.MaxQueryTime)
+		defer cancel()
 	}
 
-	// Add pattern and filename
-	args = append(args, "-e", pattern, "--", s.logFile)
+	// Charge everything the search reads and computes to its budget
+	plan.meter = s.options.Budget.Start()
+	defer plan.meter.Stop()
+
+	results := make([]*pb.FileResult, 0, len(plan.files))
+	total := 0
+
+	for _, path := range plan.files {
+		if err := ctx.Err(); err != nil {
+			return results, total, err
+		}
+
+		result := &pb.FileResult{Filename: path}
+		results = append(results, result)
+
+		count, err := s.executeSearch(ctx, path, plan, result, func(match *pb.Match) error {
+			return emit(result, match)
+		})
+		result.LineCount = int32(count)
+		total += count
+
+		if plan.page.next != nil {
+			// The page is full; later files belong to the next page
+			break
+		}
+		if err != nil {
+			var pathErr *os.PathError
+			if errors.As(err, &pathErr) {
+				result.Error = err.Error()
+				continue
+			}
+			return results, total, err
+		}
+	}
 
-	// Execute grep command with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	return results, total, nil
+}
 
-	cmd := exec.CommandContext(ctx, "grep", args...)
-	output, err := cmd.Output()
+// executeSearch scans a single log file with the in-process matching engine
+// and returns the number of matches. Context lines reported by the engine
+// are attached to the match they belong to, and each match is emitted once
+// its trailing context is complete. Compressed files are decompressed on
+// the fly. A cached result is reused while the file is unchanged, and only
+// the lines appended since are scanned when it has merely grown. The bytes
+// read, and whether an index or the cache was used, are recorded in result
+func (s *LogQueryServer) executeSearch(ctx context.Context, path string, plan *queryPlan, result *pb.FileResult, emit func(match *pb.Match) error) (int, error) {
+	file, err := logsource.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
 
+	info, err := file.Stat()
 	if err != nil {
-		// Check if it's just "no matches found" (exit code 1)
-		if exitError, ok := err.(*exec.ExitError); ok && exitError.ExitCode() == 1 {
-			return []string{}, 0, nil
+		return 0, err
+	}
+	id := logsource.Identify(info)
+
+	// Reuse what the same query found in this file before: all of it while
+	// the file is unchanged, or up to where lines were appended to it
+	key := resultKey{query: plan.page.fingerprint, path: path}
+	var reuse *cachedResult
+	if plan.cacheable {
+		if cached, ok := s.results.Get(key); ok {
+			switch cached.reusable(file, info, appendable(plan.opts)) {
+			case reuseAll:
+				s.cacheHits.Add(1)
+				result.Cached = true
+				for _, match := range cached.matches {
+					if err := emit(match); err != nil {
+						return 0, err
+					}
+				}
+				return cached.count, nil
+			case reuseAppended:
+				reuse = cached
+			}
+		}
+		if reuse != nil {
+			s.cachePartialHits.Add(1)
+			result.Cached = true
+			for _, match := range reuse.matches {
+				if err := emit(match); err != nil {
+					return 0, err
+				}
+			}
+		} else {
+			s.cacheMisses.Add(1)
+		}
+	}
+
+	// Continue after the cached lines, or where the last page of a
+	// paginated query stopped, or binary search sorted, uncompressed files
+	// for the start of the time window
+	opts := plan.opts
+	start := search.Position{Line: 1}
+	selected := 0
+	if reuse != nil {
+		start = reuse.end
+		selected = reuse.count
+	} else if resume := plan.page.resume; resume != nil {
+		plan.page.resume = nil
+		start = search.Position{Offset: resume.Offset, Line: resume.Line}
+		selected = resume.Selected
+		if opts.BeforeContext > 0 {
+			// Scan again, without reporting, the lines that may be the
+			// first match's before context, and those that may be after
+			// context of earlier matches and so not repeated, so that the
+			// page reads as it would unpaged. Compressed files cannot be
+			// read backwards and are scanned from the start
+			opts.SkipBefore = start.Offset
+			if readerAt, _, ok := file.ReaderAt(); ok {
+				start, err = search.BackLines(readerAt, start, opts.BeforeContext+opts.AfterContext)
+				if err != nil {
+					return 0, err
+				}
+			} else {
+				start = search.Position{Line: 1}
+			}
+		}
+	} else if rng := opts.Range; rng != nil && rng.Sorted && !rng.Since.IsZero() {
+		if readerAt, size, ok := file.ReaderAt(); ok {
+			start, err = search.SeekTime(readerAt, size, rng.Since, rng.Timestamp)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	// Scan only the blocks the index says may match, when it can be used
+	spans := []scanSpan{{start: start, length: -1}}
+	if plan.trigrams != nil && reuse == nil {
+		if readerAt, _, ok := file.ReaderAt(); ok {
+			if idx := s.indexes.Lookup(path, info, readerAt); idx != nil {
+				spans = indexedSpans(idx, plan.trigrams, start)
+				result.Indexed = true
+			}
+		}
+	}
+
+	// Record the matches for the next run of the same query, scanning no
+	// further than the size recorded with them, so that lines appended
+	// later are known to start there
+	var record *cachedResult
+	if plan.cacheable {
+		record = &cachedResult{id: id, size: info.Size(), modTime: info.ModTime()}
+		if reuse != nil {
+			record.matches = slices.Clip(reuse.matches)
+		}
+		emitNow := emit
+		emit = func(match *pb.Match) error {
+			record.matches = append(record.matches, match)
+			return emitNow(match)
+		}
+		if file.Compression() == logsource.None {
+			for i := range spans {
+				if spans[i].length < 0 {
+					spans[i].length = max(info.Size()-spans[i].start.Offset, 0)
+				}
+			}
+		}
+	}
+
+	var current *pb.Match
+	var before []string
+	flush := func() error {
+		if current == nil {
+			return nil
+		}
+		match := current
+		current = nil
+		return emit(match)
+	}
+
+	collect := func(line search.Line) error {
+		switch line.Kind {
+		case search.Before:
+			if err := flush(); err != nil {
+				return err
+			}
+			before = append(before, string(line.Text))
+		case search.After:
+			if current != nil {
+				current.After = append(current.After, string(line.Text))
+			}
+		default:
+			if err := flush(); err != nil {
+				return err
+			}
+			if p := plan.page; p.limit > 0 && p.returned == p.limit {
+				// Leave this match to start the next page
+				p.next = &pageToken{
+					Fingerprint: p.fingerprint,
+					File:        id,
+					Path:        path,
+					Offset:      line.Offset,
+					Line:        line.Number,
+					Selected:    selected,
+				}
+				return errPageFull
+			}
+			plan.page.returned++
+			selected++
+			current = plan.match(line)
+			current.Before = before
+			before = nil
+		}
+		return nil
+	}
+
+	var source io.Reader = file
+	if plan.meter != nil {
+		source = plan.meter.Reader(file)
+		// Lines too long for the read buffer are held in memory whole
+		opts.Charge = plan.meter.Charge
+	}
+	reader := &countingReader{r: source}
+	defer func() { result.BytesScanned = reader.n }()
+
+	count := 0
+	if reuse != nil {
+		count = reuse.count
+	}
+	var last *lineCounter // the last span scanned
+	for _, span := range spans {
+		if span.start.Offset > 0 {
+			if err := file.SeekTo(span.start.Offset); err != nil {
+				return count, err
+			}
+		}
+		var r io.Reader = reader
+		if span.length >= 0 {
+			r = io.LimitReader(reader, span.length)
+		}
+		if record != nil {
+			last = &lineCounter{r: r, start: span.start}
+			r = last
+		}
+
+		// max_count applies to the file as a whole
+		spanOpts := opts
+		if opts.MaxCount > 0 {
+			spanOpts.MaxCount = opts.MaxCount - selected
+			if spanOpts.MaxCount <= 0 {
+				break
+			}
+		}
+
+		n, err := search.ScanAt(ctx, r, span.start, plan.matcher, spanOpts, collect)
+		if err == errPageFull {
+			return count + n - 1, nil
+		}
+		count += n
+		if err != nil {
+			return count, err
+		}
+	}
+
+	if err := flush(); err != nil {
+		return count, err
+	}
+	if record != nil {
+		record.count = count
+		record.complete = opts.MaxCount > 0 && count >= opts.MaxCount
+		record.finish(file, last)
+		s.results.Put(key, record, record.cost())
+	}
+	return count, nil
+}
+
+// resultKey identifies the cached result of a query over one file
+type resultKey struct {
+	query string // fingerprint of the query
+	path  string
+}
+
+// cachedResult is what a query found in a file, as the file was then
+type cachedResult struct {
+	id      logsource.FileID
+	size    int64
+	modTime time.Time
+	tail    []byte // the last bytes of the file, to recognise it once grown
+
+	matches  []*pb.Match
+	count    int
+	complete bool // max_count was reached, so lines appended later cannot match
+
+	// end is where lines appended later start, or zero when the file did
+	// not end in a whole line when searched
+	end search.Position
+}
+
+// resultTail is the number of bytes kept from the end of a searched file to
+// check that it has only grown
+const resultTail = 64
+
+// reuse says how much of a cached result still holds
+type reuse int
+
+const (
+	reuseNone     reuse = iota // the file has to be searched again
+	reuseAll                   // the result is unchanged
+	reuseAppended              // lines were appended; only they need searching
+)
+
+// reusable checks how much of the result still holds for the file now
+// described by info. Only results of appendable queries can be extended
+// over appended lines
+func (c *cachedResult) reusable(file *logsource.File, info os.FileInfo, appendable bool) reuse {
+	switch {
+	case logsource.Identify(info) != c.id || info.Size() < c.size:
+		return reuseNone
+	case info.Size() == c.size:
+		if info.ModTime().Equal(c.modTime) {
+			return reuseAll
+		}
+		return reuseNone
+	case c.tail == nil:
+		return reuseNone
+	}
+
+	// The file has grown; check that what was searched is still there
+	readerAt, _, ok := file.ReaderAt()
+	if !ok {
+		return reuseNone
+	}
+	tail := make([]byte, len(c.tail))
+	if _, err := readerAt.ReadAt(tail, c.size-int64(len(tail))); err != nil || !bytes.Equal(tail, c.tail) {
+		return reuseNone
+	}
+	switch {
+	case !appendable:
+		return reuseNone
+	case c.complete:
+		return reuseAll
+	case c.end.Offset == c.size:
+		return reuseAppended
+	}
+	return reuseNone
+}
+
+// finish records where lines appended to the file later would start, once
+// the scan whose last span is last has completed
+func (c *cachedResult) finish(file *logsource.File, last *lineCounter) {
+	readerAt, _, ok := file.ReaderAt()
+	if !ok || c.size == 0 {
+		return
+	}
+	tail := make([]byte, min(c.size, resultTail))
+	if _, err := readerAt.ReadAt(tail, c.size-int64(len(tail))); err != nil {
+		return
+	}
+	c.tail = tail
+	if last != nil && last.start.Offset+last.bytes == c.size && tail[len(tail)-1] == '\n' {
+		c.end = search.Position{Offset: c.size, Line: last.start.Line + last.lines}
+	}
+}
+
+// cost estimates the memory taken by the cached result
+func (c *cachedResult) cost() int64 {
+	cost := int64(256 + len(c.tail))
+	for _, match := range c.matches {
+		cost += int64(proto.Size(match))
+	}
+	return cost
+}
+
+// appendable reports whether the result of a search with opts can be
+// extended by searching only lines appended to the file. Context and the
+// time and level filters depend on the lines before the appended ones
+func appendable(opts search.Options) bool {
+	return opts.BeforeContext == 0 && opts.AfterContext == 0 && opts.Range == nil && opts.Levels == nil
+}
+
+// lineCounter counts the bytes and lines read through it
+type lineCounter struct {
+	r     io.Reader
+	start search.Position // where reading started
+	bytes int64
+	lines int
+}
+
+func (c *lineCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.bytes += int64(n)
+	c.lines += bytes.Count(p[:n], []byte{'\n'})
+	return n, err
+}
+
+// bytesScanned totals the bytes read across files
+func bytesScanned(files []*pb.FileResult) int64 {
+	total := int64(0)
+	for _, file := range files {
+		total += file.BytesScanned
+	}
+	return total
+}
+
+// scanSpan is a region of a file to scan; a negative length runs to the end
+type scanSpan struct {
+	start  search.Position
+	length int64
+}
+
+// indexedSpans lists the regions of a file worth scanning according to its
+// index: the candidate blocks for q from start on, then the unindexed tail
+func indexedSpans(idx *index.Index, q *index.Query, start search.Position) []scanSpan {
+	var spans []scanSpan
+	for _, block := range idx.Candidates(q) {
+		end := block.Offset + block.Length
+		switch {
+		case end <= start.Offset:
+			continue
+		case block.Offset < start.Offset:
+			// The scan resumes partway through this block
+			spans = append(spans, scanSpan{start: start, length: end - start.Offset})
+		default:
+			spans = append(spans, scanSpan{start: search.Position{Offset: block.Offset, Line: block.Line}, length: block.Length})
 		}
-		return nil, 0, err
 	}
 
-	// Parse output into lines
-	outputStr := string(output)
-	if outputStr == "" {
-		return []string{}, 0, nil
+	tail := search.Position{Offset: idx.Covered, Line: idx.Lines + 1}
+	if tail.Offset < start.Offset {
+		tail = start
 	}
+	return append(spans, scanSpan{start: tail, length: -1})
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
 
-	lines := strings.Split(strings.TrimRight(outputStr, "\n"), "\n")
-	return lines, len(lines), nil
+// logRecord converts a parsed record to its protobuf form
+func logRecord(record logparse.Record) *pb.LogRecord {
+	pbRecord := &pb.LogRecord{
+		Level:   record.Level,
+		Message: record.Message,
+		Raw:     record.Raw,
+	}
+	if !record.Timestamp.IsZero() {
+		pbRecord.Timestamp = timestamppb.New(record.Timestamp)
+	}
+	return pbRecord
 }
 
 // sanitizePattern removes potentially dangerous characters
@@ -122,14 +2125,56 @@ func sanitizePattern(pattern string) string {
 		return ""
 	}
 
-	// Trim whitespace only; let grep handle regex and options
+	// Trim whitespace only; the matcher validates the pattern itself
 	return strings.TrimSpace(pattern)
 }
 
+// reloadOnHangup reloads the TLS certificates and the auth policy, either
+// of which may be nil, whenever the process receives SIGHUP. Files that
+// are unusable leave the ones loaded before in use
+func reloadOnHangup(certs *tlsconfig.Reloader, policy *authz.Authorizer) {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	for range hangups {
+		if certs != nil {
+			if err := certs.Reload(); err != nil {
+				log.Printf("Reloading TLS certificates failed, keeping the current ones: %v", err)
+			} else {
+				log.Printf("Reloaded TLS certificates")
+			}
+		}
+		if policy != nil {
+			if err := policy.Reload(); err != nil {
+				log.Printf("Reloading auth policy failed, keeping the current one: %v", err)
+			} else {
+				log.Printf("Reloaded auth policy")
+			}
+		}
+	}
+}
+
 func main() {
 	// Parse command line flags
 	machineID := flag.String("machine", "1", "Machine ID for this server")
 	port := flag.String("port", "8080", "Port to listen on")
+	logs := flag.String("logs", "", "Comma-separated log files, globs or directories to search (default vm<machine>.log)")
+	sorted := flag.Bool("sorted", true, "Assume log lines are in chronological order, enabling binary search for time-range queries")
+	indexDir := flag.String("index-dir", "", "Directory for trigram indexes of the log files, built in the background (default: no indexing)")
+	indexInterval := flag.Duration("index-interval", 10*time.Second, "How often to extend the trigram indexes over appended lines and rebuild those of rotated files")
+	maxQueryTime := flag.Duration("max-query-time", 30*time.Second, "Longest a single query may search, regardless of the client's deadline (0 for no limit)")
+	maxSearches := flag.Int("max-searches", defaultMaxSearches(), "Searches run at once; leave room for the host's own workload")
+	maxQueued := flag.Int("max-queued", 16, "Searches that may wait for a slot before more are rejected with RESOURCE_EXHAUSTED")
+	maxQueryBytes := flag.Int64("max-query-bytes", 0, "Bytes of log a single search may read before it is stopped (0 for no limit)")
+	maxQueryCPU := flag.Duration("max-query-cpu", 0, "CPU time a single search may use before it is stopped (0 for no limit)")
+	healthInterval := flag.Duration("health-interval", 10*time.Second, "How often to check that the log files can still be read, for the gRPC health service")
+	tlsCert := flag.String("tls-cert", "", "PEM certificate chain to serve TLS with (default: plaintext); reloaded on SIGHUP")
+	tlsKey := flag.String("tls-key", "", "PEM private key of -tls-cert; reloaded on SIGHUP")
+	tlsCA := flag.String("tls-ca", "", "PEM CAs that client certificates must be signed by; reloaded on SIGHUP")
+	verifyClients := flag.Bool("tls-verify-clients", false, "Require clients to present a certificate signed by -tls-ca (mutual TLS)")
+	policyFile := flag.String("auth-policy", "", "JSON policy mapping bearer tokens and client certificates to the log files and features they may use (default: no authentication); reloaded on SIGHUP")
+	cacheMB := flag.Int64("cache-mb", 64, "Memory for caching recent results per query and file, in megabytes (0 to disable)")
+	parser := flag.String("parser", logparse.DefaultParser,
+		fmt.Sprintf("Line parser used for parsed records (%s)", strings.Join(logparse.Parsers(), ", ")))
 	flag.Parse()
 
 	// Validate machine ID
@@ -138,12 +2183,93 @@ func main() {
 	}
 
 	// Create server instance
-	server := NewLogQueryServer(*machineID)
+	var logPatterns []string
+	for _, pattern := range strings.Split(*logs, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			logPatterns = append(logPatterns, pattern)
+		}
+	}
+	// Validate the parser name up front rather than on the first query
+	if _, err := logparse.NewParser(*parser, logparse.NewTimestampParser("", time.Local)); err != nil {
+		log.Fatal(err)
+	}
+
+	var policy *authz.Authorizer
+	if *policyFile != "" {
+		var err error
+		if policy, err = authz.NewAuthorizer(*policyFile); err != nil {
+			log.Fatalf("Invalid auth policy: %v", err)
+		}
+	}
+
+	server := NewLogQueryServer(*machineID, ServerOptions{
+		LogPatterns:  logPatterns,
+		SortedLogs:   *sorted,
+		Parser:       *parser,
+		MaxQueryTime: *maxQueryTime,
+		IndexDir:     *indexDir,
+		MaxSearches:  *maxSearches,
+		MaxQueued:    *maxQueued,
+		Budget:       admission.Budget{MaxBytes: *maxQueryBytes, MaxCPU: *maxQueryCPU},
+		CacheSize:    *cacheMB << 20,
+		Policy:       policy,
+	})
+	if *indexDir != "" {
+		if err := os.MkdirAll(*indexDir, 0755); err != nil {
+			log.Fatalf("Failed to create index directory: %v", err)
+		}
+		go server.maintainIndexes(*indexInterval)
+	}
 
 	// Create gRPC server
-	grpcServer := grpc.NewServer()
+	// Followers hold streams open indefinitely; keepalive pings notice
+	// clients that vanish without closing them, and let clients ping back.
+	// Callers are authorized before searches are admitted a limited number
+	// at a time
+	grpcOptions := []grpc.ServerOption{
+		grpc.KeepaliveParams(keepalive.ServerParameters{Time: time.Minute, Timeout: 20 * time.Second}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{MinTime: 10 * time.Second, PermitWithoutStream: true}),
+		grpc.ChainUnaryInterceptor(server.authorizeUnary, server.admitUnary),
+		grpc.ChainStreamInterceptor(server.authorizeStream, server.admitStream),
+	}
+
+	// Encrypt connections when given a certificate, reloading it on SIGHUP
+	// so it can be rotated without a restart
+	var certs *tlsconfig.Reloader
+	if *tlsCert != "" || *tlsKey != "" || *tlsCA != "" || *verifyClients {
+		var err error
+		certs, err = tlsconfig.NewReloader(tlsconfig.Files{Cert: *tlsCert, Key: *tlsKey, CA: *tlsCA})
+		if err != nil {
+			log.Fatalf("Invalid TLS configuration: %v", err)
+		}
+		config, err := certs.ServerConfig(*verifyClients)
+		if err != nil {
+			log.Fatalf("Invalid TLS configuration: %v", err)
+		}
+		grpcOptions = append(grpcOptions, grpc.Creds(credentials.NewTLS(config)))
+	}
+	if policy != nil && certs == nil {
+		// Clients only send bearer tokens over TLS, where they cannot be sniffed
+		log.Fatal("-auth-policy needs -tls-cert: credentials are only accepted over TLS")
+	}
+	if certs != nil || policy != nil {
+		go reloadOnHangup(certs, policy)
+	}
+	grpcServer := grpc.NewServer(grpcOptions...)
 	pb.RegisterLogQueryServer(grpcServer, server)
 
+	// Report health for orchestration, following whether the logs can be
+	// read, and describe the services to tools such as grpcurl
+	healthServer := health.NewServer()
+	server.updateHealth(healthServer)
+	go func() {
+		for range time.Tick(*healthInterval) {
+			server.updateHealth(healthServer)
+		}
+	}()
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+	reflection.Register(grpcServer)
+
 	// Start listening
 	lis, err := net.Listen("tcp", ":"+*port)
 	if err != nil {
@@ -151,7 +2277,17 @@ func main() {
 	}
 
 	log.Printf("gRPC server started on machine %s, listening on port %s", *machineID, *port)
-	log.Printf("Log file: %s", server.logFile)
+	log.Printf("Log sources: %s", strings.Join(server.sources.Patterns(), ", "))
+	if policy != nil {
+		log.Printf("Authorizing callers with the policy in %s", *policyFile)
+	}
+	switch {
+	case *verifyClients:
+		log.Printf("Serving mutual TLS: clients must present a certificate signed by %s", *tlsCA)
+	case *tlsCert != "":
+		log.Printf("Serving TLS with %s", *tlsCert)
+	}
+	log.Printf("Running up to %d searches at once, with %d more queued", server.options.MaxSearches, server.options.MaxQueued)
 
 	// Start serving
 	if err := grpcServer.Serve(lis); err != nil {
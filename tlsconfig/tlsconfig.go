@@ -0,0 +1,137 @@
+// Package tlsconfig builds TLS configurations for the server and the client
+// from PEM files: a certificate with its key, and the CAs trusted to verify
+// the other side. The server's files can be reloaded while it runs, so
+// certificates can be rotated without a restart
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// Files names the PEM files of one side of a connection
+type Files struct {
+	Cert string // certificate chain presented to the other side
+	Key  string // private key of the certificate
+	CA   string // CAs the other side's certificate must be signed by
+}
+
+// material is what Files hold once loaded
+type material struct {
+	cert *tls.Certificate // nil without a certificate
+	pool *x509.CertPool   // nil without a CA file
+}
+
+// load reads and parses files. The certificate and key go together
+func load(files Files) (*material, error) {
+	m := &material{}
+	switch {
+	case files.Cert != "" && files.Key != "":
+		cert, err := tls.LoadX509KeyPair(files.Cert, files.Key)
+		if err != nil {
+			return nil, fmt.Errorf("loading certificate: %v", err)
+		}
+		m.cert = &cert
+	case files.Cert != "" || files.Key != "":
+		return nil, errors.New("a certificate and its key must be given together")
+	}
+
+	if files.CA != "" {
+		data, err := os.ReadFile(files.CA)
+		if err != nil {
+			return nil, fmt.Errorf("loading CA: %v", err)
+		}
+		m.pool = x509.NewCertPool()
+		if !m.pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("loading CA: no PEM certificates in %s", files.CA)
+		}
+	}
+	return m, nil
+}
+
+// Reloader holds the server's certificate and client CAs, replacing them
+// when asked to reload. Connections made before a reload keep the
+// certificates they were established with
+type Reloader struct {
+	files   Files
+	current atomic.Pointer[material]
+}
+
+// NewReloader loads files, which must include a certificate and its key
+func NewReloader(files Files) (*Reloader, error) {
+	if files.Cert == "" || files.Key == "" {
+		return nil, errors.New("a server certificate and key are required for TLS")
+	}
+	m, err := load(files)
+	if err != nil {
+		return nil, err
+	}
+	r := &Reloader{files: files}
+	r.current.Store(m)
+	return r, nil
+}
+
+// Reload reads the files again. On failure the certificates loaded before
+// remain in use
+func (r *Reloader) Reload() error {
+	m, err := load(r.files)
+	if err != nil {
+		return err
+	}
+	r.current.Store(m)
+	return nil
+}
+
+// ServerConfig returns a configuration that presents the current
+// certificate to every new connection. With requireClientCert, clients
+// must present a certificate signed by the CAs; otherwise a certificate is
+// optional, but verified when presented and a CA file was given
+func (r *Reloader) ServerConfig(requireClientCert bool) (*tls.Config, error) {
+	if requireClientCert && r.files.CA == "" {
+		return nil, errors.New("verifying client certificates needs a CA file")
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			m := r.current.Load()
+			config := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*m.cert},
+				NextProtos:   []string{"h2"},
+			}
+			switch {
+			case requireClientCert:
+				config.ClientCAs = m.pool
+				config.ClientAuth = tls.RequireAndVerifyClientCert
+			case m.pool != nil:
+				config.ClientCAs = m.pool
+				config.ClientAuth = tls.VerifyClientCertIfGiven
+			}
+			return config, nil
+		},
+	}, nil
+}
+
+// ClientConfig loads files for a client. Servers are verified against the
+// CA file, or the system's CAs without one, and serverName, when set,
+// replaces the host name expected in their certificates. The certificate,
+// if any, is presented to servers that ask for one
+func ClientConfig(files Files, serverName string) (*tls.Config, error) {
+	m, err := load(files)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    m.pool,
+		ServerName: serverName,
+	}
+	if m.cert != nil {
+		config.Certificates = []tls.Certificate{*m.cert}
+	}
+	return config, nil
+}